@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// OIDCProvider configures login through an external OpenID Connect identity
+// provider. Endpoints are taken from the issuer's discovery document.
+type OIDCProvider struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// Password configures the password policy and how passwords are hashed.
+// Algorithm is "bcrypt" or "argon2id"; hashes made with other settings are
+// upgraded transparently on the next successful login.
+type Password struct {
+	MinLength            int    `json:"min_length"`
+	RequireUpper         bool   `json:"require_upper"`
+	RequireLower         bool   `json:"require_lower"`
+	RequireDigit         bool   `json:"require_digit"`
+	RequireSymbol        bool   `json:"require_symbol"`
+	DisallowPersonalInfo bool   `json:"disallow_personal_info"`
+	BreachedListDir      string `json:"breached_list_dir"`
+	Algorithm            string `json:"algorithm"`
+	BcryptCost           int    `json:"bcrypt_cost"`
+	Argon2Time           uint32 `json:"argon2_time"`
+	Argon2MemoryKiB      uint32 `json:"argon2_memory_kib"`
+	Argon2Threads        uint8  `json:"argon2_threads"`
+}
+
+// S3 configures an S3-compatible object store. Endpoint may point at AWS or
+// at a local stand-in such as MinIO, which usually needs UsePathStyle.
+type S3 struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	UsePathStyle bool   `json:"use_path_style"`
+	PublicURL    string `json:"public_url"`
+}
+
+type ThumbnailSize struct {
+	Name  string `json:"name"`
+	Width int    `json:"width"`
+}
+
+// Storage configures where uploaded files go. Driver is "local" or "s3".
+type Storage struct {
+	Driver         string          `json:"driver"`
+	LocalDir       string          `json:"local_dir"`
+	LocalPublicURL string          `json:"local_public_url"`
+	S3             S3              `json:"s3"`
+	MaxUploadBytes int64           `json:"max_upload_bytes"`
+	ThumbnailSizes []ThumbnailSize `json:"thumbnail_sizes"`
+}
+
+// Money configures product currencies and price conversion.
+type Money struct {
+	DefaultCurrency string `json:"default_currency"`
+	DefaultLocale   string `json:"default_locale"`
+	RatesFile       string `json:"rates_file"`
+}
+
+// Search configures product search. Driver is "memory" for the in-process
+// index or "mysql" for the FULLTEXT index.
+type Search struct {
+	Driver string `json:"driver"`
+}
+
+// Trash configures soft deletion. Trashed rows are purged for good once
+// they are older than RetentionDays; 0 keeps them forever.
+type Trash struct {
+	RetentionDays        int `json:"retention_days"`
+	PurgeIntervalMinutes int `json:"purge_interval_minutes"`
+}
+
+// Payments configures how orders are paid. Provider is "fake" for the
+// in-memory provider. Webhooks must be signed with WebhookSecret.
+type Payments struct {
+	Provider      string `json:"provider"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+// Shipping configures the flat shipping fee charged per order, keyed by
+// currency in its minor unit. Currencies without a fee ship free.
+type Shipping struct {
+	FlatFees map[string]int64 `json:"flat_fees"`
+}
+
+type Config struct {
+	OIDCProviders map[string]OIDCProvider `json:"oidc_providers"`
+	Password      Password                `json:"password"`
+	Storage       Storage                 `json:"storage"`
+	Money         Money                   `json:"money"`
+	Search        Search                  `json:"search"`
+	Trash         Trash                   `json:"trash"`
+	Payments      Payments                `json:"payments"`
+	Shipping      Shipping                `json:"shipping"`
+}
+
+var App = Config{
+	Password: Password{
+		MinLength:            8,
+		RequireLower:         true,
+		RequireDigit:         true,
+		DisallowPersonalInfo: true,
+		Algorithm:            "bcrypt",
+		BcryptCost:           12,
+		Argon2Time:           3,
+		Argon2MemoryKiB:      64 * 1024,
+		Argon2Threads:        2,
+	},
+	Storage: Storage{
+		Driver:         "local",
+		LocalDir:       "uploads",
+		LocalPublicURL: "/uploads/",
+		MaxUploadBytes: 10 << 20,
+		ThumbnailSizes: []ThumbnailSize{
+			{Name: "small", Width: 150},
+			{Name: "medium", Width: 400},
+			{Name: "large", Width: 800},
+		},
+	},
+	Money: Money{
+		DefaultCurrency: "IDR",
+		DefaultLocale:   "id-ID",
+		RatesFile:       "rates.json",
+	},
+	Search: Search{
+		Driver: "memory",
+	},
+	Trash: Trash{
+		RetentionDays:        30,
+		PurgeIntervalMinutes: 60,
+	},
+	Payments: Payments{
+		Provider: "fake",
+	},
+	Shipping: Shipping{
+		FlatFees: map[string]int64{"IDR": 20000},
+	},
+}
+
+// Load reads the JSON config file named by CONFIG_FILE (config.json by
+// default). A missing file is not an error; every section keeps its defaults.
+func Load() {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		path = "config.json"
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Printf("Config file %s not found, using defaults\n", path)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(data, &App)
+	if err != nil {
+		panic(fmt.Errorf("error parsing %s: %w", path, err))
+	}
+
+	fmt.Println("Config loaded!")
+}
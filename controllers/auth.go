@@ -7,10 +7,10 @@ import (
 	"loginApi/database"
 	"loginApi/helpers"
 	"loginApi/models"
+	"loginApi/password"
 	"loginApi/utils"
 	"net/http"
-
-	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
 func Register(w http.ResponseWriter, r *http.Request) {
@@ -23,16 +23,40 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Tambahkan log untuk nilai user setelah decoding
-	fmt.Printf("Decoded user: %+v\n", user)
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = helpers.NormalizeEmail(user.Email)
+	user.PhoneNumber = strings.TrimSpace(user.PhoneNumber)
 
 	if user.Name == "" || user.Email == "" || user.PhoneNumber == "" || user.Password == "" {
 		http.Error(w, "All fields are required", http.StatusBadRequest)
-		fmt.Printf("Validation failed: Name=%s, Email=%s, PhoneNumber=%s, Password=%s\n", user.Name, user.Email, user.PhoneNumber, user.Password)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if problems := password.Validate(user.Password, user.Name, user.Email); len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "Password does not meet the password policy",
+			"problems": problems,
+		})
+		if err != nil {
+			fmt.Printf("Error encoding response: %v\n", err)
+		}
+		return
+	}
+
+	breached, err := password.IsBreached(user.Password)
+	if err != nil {
+		http.Error(w, "Failed to check password", http.StatusInternalServerError)
+		fmt.Printf("Error checking breached passwords: %v\n", err)
+		return
+	}
+	if breached {
+		http.Error(w, "This password has appeared in a data breach, please choose another", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := password.Hash(user.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		fmt.Printf("Error hashing password: %v\n", err) // Tambahkan log error
@@ -40,9 +64,19 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Simpan user ke database
-	query := "INSERT INTO users (name, email, phone_number, password) VALUES (?,?, ?, ?, ?)"
+	query := "INSERT INTO users (name, email, phone_number, password) VALUES (?, ?, ?, ?)"
 	result, err := database.DB.Exec(query, user.Name, user.Email, user.PhoneNumber, hashedPassword)
-	if err != nil {
+	if key, ok := database.DuplicateKey(err); ok {
+		field, message := "", "User already exists"
+		switch key {
+		case "uniq_users_email":
+			field, message = "email", "Email is already registered"
+		case "uniq_users_phone_number":
+			field, message = "phone_number", "Phone number is already registered"
+		}
+		writeConflict(w, field, message)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to register user", http.StatusInternalServerError)
 		fmt.Printf("Error executing query: %v\n", err) // Tambahkan log error
 		return
@@ -55,8 +89,17 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.ID = int(id)
+	user.Password = ""
+
+	response := map[string]interface{}{"user": user}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintf(w, "User registered successfully with ID: %d", id)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding response: %v\n", err)
+	}
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +110,15 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.Email = helpers.NormalizeEmail(user.Email)
+
 	if user.Email == "" || user.Password == "" {
 		http.Error(w, "Email and Password are required", http.StatusBadRequest)
 		return
 	}
 
 	var dbUser models.User
-	query := "SELECT id, name, email, phone_number, password FROM users WHERE email = ?"
+	query := "SELECT id, name, email, COALESCE(phone_number, ''), COALESCE(password, '') FROM users WHERE email = ?"
 	row := database.DB.QueryRow(query, user.Email)
 	err = row.Scan(&dbUser.ID, &dbUser.Name, &dbUser.Email, &dbUser.PhoneNumber, &dbUser.Password)
 	if err == sql.ErrNoRows {
@@ -84,19 +129,50 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(user.Password))
+	// Accounts created through an identity provider have no local password
+	if dbUser.Password == "" {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	match, err := password.Verify(dbUser.Password, user.Password)
 	if err != nil {
+		http.Error(w, "Failed to verify password", http.StatusInternalServerError)
+		fmt.Printf("Error verifying password for user %d: %v\n", dbUser.ID, err)
+		return
+	}
+	if !match {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
+	// Upgrade the stored hash now that we have the plaintext, so raising the
+	// cost or switching algorithm takes effect without a password reset
+	if password.NeedsRehash(dbUser.Password) {
+		rehashed, err := password.Hash(user.Password)
+		if err == nil {
+			_, err = database.DB.Exec("UPDATE users SET password = ? WHERE id = ?", rehashed, dbUser.ID)
+		}
+		if err != nil {
+			fmt.Printf("Error rehashing password for user %d: %v\n", dbUser.ID, err)
+		}
+	}
+
 	// Generate JWT
-	tokenString, err := utils.GenerateJWT(dbUser.ID, dbUser.Name)
+	tokenString, err := startSession(r, dbUser.ID, dbUser.Name)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
+	// Carry over whatever was put in the cart before signing in. A stale
+	// token should not stop the login itself.
+	if cartToken := r.Header.Get(cartTokenHeader); cartToken != "" {
+		if _, err := mergeAnonymousCart(dbUser.ID, cartToken); err != nil {
+			fmt.Printf("Error merging cart for user %d: %v\n", dbUser.ID, err)
+		}
+	}
+
 	// Create the response with user details and JWT
 	response := map[string]interface{}{"user": models.LoginResponse{
 		ID:          dbUser.ID,
@@ -116,3 +192,160 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// callerIsAdmin reports whether the request acts with userID's
+// administrator rights. OAuth2 access tokens never do, whatever their
+// scope, just as RequireAdmin keeps them off the admin routes.
+func callerIsAdmin(r *http.Request, userID int) (bool, error) {
+	if _, delegated := r.Context().Value("clientID").(string); delegated {
+		return false, nil
+	}
+	return utils.IsAdmin(userID)
+}
+
+// Profile serves /me: GET returns the signed-in user, PATCH changes their
+// name and phone number. OAuth2 clients need the "profile" scope to read
+// and "profile:write" as well to patch.
+func Profile(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetProfile(w, r)
+	case http.MethodPatch:
+		PatchProfile(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var user models.User
+	query := "SELECT id, name, email, COALESCE(phone_number, '') FROM users WHERE id = ?"
+	err := database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Name, &user.Email, &user.PhoneNumber)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		fmt.Printf("Error fetching user: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{"user": user}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		fmt.Printf("Error encoding response: %v\n", err)
+		return
+	}
+}
+
+// profilePatch holds the profile fields a patch may change. The email
+// address identifies the account at sign-in and stays as registered.
+type profilePatch struct {
+	Name         string  `json:"name"`
+	Phone_number *string `json:"phone_number"`
+}
+
+// maxPhoneLength matches users.phone_number.
+const maxPhoneLength = 20
+
+// PatchProfile serves PATCH /me with a merge patch or JSON Patch. Removing
+// phone_number, or setting it to null, clears it.
+func PatchProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	patch, mediaType, ok := readPatch(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var email string
+	var current profilePatch
+	err = tx.QueryRow("SELECT email, name, phone_number FROM users WHERE id = ? FOR UPDATE", userID).Scan(&email, &current.Name, &current.Phone_number)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		fmt.Printf("Error fetching user: %v\n", err)
+		return
+	}
+
+	var patched profilePatch
+	if !applyPatch(w, mediaType, patch, current, &patched) {
+		return
+	}
+
+	patched.Name = strings.TrimSpace(patched.Name)
+	if patched.Name == "" {
+		http.Error(w, "Name is required", http.StatusUnprocessableEntity)
+		return
+	}
+	if patched.Phone_number != nil {
+		phone := strings.TrimSpace(*patched.Phone_number)
+		if len(phone) > maxPhoneLength {
+			http.Error(w, fmt.Sprintf("Phone number must be at most %d characters", maxPhoneLength), http.StatusUnprocessableEntity)
+			return
+		}
+		patched.Phone_number = &phone
+		if phone == "" {
+			patched.Phone_number = nil
+		}
+	}
+
+	_, err = tx.Exec("UPDATE users SET name = ?, phone_number = ? WHERE id = ?", patched.Name, patched.Phone_number, userID)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "phone_number", "Phone number is already registered")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	user := models.User{ID: userID, Name: patched.Name, Email: email}
+	if patched.Phone_number != nil {
+		user.PhoneNumber = *patched.Phone_number
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"user": user})
+	if err != nil {
+		fmt.Printf("Error encoding response: %v\n", err)
+	}
+}
+
+// writeConflict reports a uniqueness violation along with the field that
+// caused it, so clients can point the user at the right input.
+func writeConflict(w http.ResponseWriter, field, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+		"field": field,
+	})
+	if err != nil {
+		fmt.Printf("Error encoding response: %v\n", err)
+	}
+}
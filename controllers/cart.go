@@ -0,0 +1,574 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cartTokenHeader carries the signed token of an anonymous cart.
+const cartTokenHeader = "X-Cart-Token"
+
+var errInvalidCartToken = errors.New("invalid cart token")
+
+// cartRequest is the body of POST /cart/items and PUT /cart/items/{id}.
+type cartRequest struct {
+	Product_id int  `json:"product_id"`
+	Variant_id *int `json:"variant_id"`
+	Quantity   int  `json:"quantity"`
+}
+
+// findCart returns the cart the request refers to: the caller's own cart
+// when authenticated, otherwise the anonymous cart named by X-Cart-Token.
+// With create set a missing cart is created, and for anonymous callers the
+// new cart's token is returned so it can be handed back. A cart ID of 0
+// means there is no cart yet.
+func findCart(r *http.Request, create bool) (int, string, error) {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		var cartID int
+		err := database.DB.QueryRow("SELECT id FROM carts WHERE user_id = ?", userID).Scan(&cartID)
+		if err == sql.ErrNoRows && create {
+			now := time.Now()
+			result, err := database.DB.Exec("INSERT INTO carts (user_id, created_at, updated_at) VALUES (?, ?, ?)", userID, now, now)
+			if err != nil {
+				return 0, "", err
+			}
+			id, err := result.LastInsertId()
+			return int(id), "", err
+		} else if err == sql.ErrNoRows {
+			return 0, "", nil
+		}
+		return cartID, "", err
+	}
+
+	if token := r.Header.Get(cartTokenHeader); token != "" {
+		cartID, err := anonymousCart(database.DB, token, false)
+		return cartID, "", err
+	}
+
+	if !create {
+		return 0, "", nil
+	}
+
+	nonce, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return 0, "", err
+	}
+	now := time.Now()
+	result, err := database.DB.Exec("INSERT INTO carts (token_nonce, created_at, updated_at) VALUES (?, ?, ?)", nonce, now, now)
+	if err != nil {
+		return 0, "", err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+	return int(id), utils.SignCartToken(int(id), nonce), nil
+}
+
+// rowQueryer is implemented by both *sql.DB and *sql.Tx.
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// anonymousCart resolves a cart token to the ID of a cart that has not been
+// claimed by a user, optionally locking it.
+func anonymousCart(q rowQueryer, token string, lock bool) (int, error) {
+	cartID, nonce, ok := utils.ParseCartToken(token)
+	if !ok {
+		return 0, errInvalidCartToken
+	}
+
+	query := "SELECT id FROM carts WHERE id = ? AND token_nonce = ? AND user_id IS NULL"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	err := q.QueryRow(query, cartID, nonce).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		return 0, errInvalidCartToken
+	}
+	return cartID, err
+}
+
+// writeCartError reports a failed cart lookup.
+func writeCartError(w http.ResponseWriter, err error) {
+	if err == errInvalidCartToken {
+		http.Error(w, "Invalid or expired cart token", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+	fmt.Printf("Error fetching cart: %v\n", err)
+}
+
+// cartItemColumns selects a cart item with the product and variant data
+// needed to price it and check it can still be bought.
+const cartItemColumns = `ci.id, ci.product_id, p.category_id, ci.variant_id, ci.quantity,
+	p.name, p.currency, COALESCE(v.price, p.price), COALESCE(v.stock, p.stock), COALESCE(v.sku, ''),
+	p.status = 'published' AND p.deleted_at IS NULL`
+
+const cartItemJoins = `FROM cart_items ci
+	JOIN products p ON p.id = ci.product_id
+	LEFT JOIN product_variants v ON v.id = ci.variant_id`
+
+// scanCartItem scans a row selected with cartItemColumns and also returns
+// the stock available and whether the product is still on sale.
+func scanCartItem(row rowScanner) (models.CartItem, int, bool, error) {
+	var item models.CartItem
+	var stock int
+	var onSale bool
+	err := row.Scan(&item.ID, &item.Product_id, &item.Category_id, &item.Variant_id, &item.Quantity,
+		&item.Name, &item.Currency, &item.Unit_price, &stock, &item.SKU, &onSale)
+	if err != nil {
+		return item, 0, false, err
+	}
+
+	item.Line_total = item.Unit_price * int64(item.Quantity)
+	item.Available = onSale && stock >= item.Quantity
+	return item, stock, onSale, nil
+}
+
+// loadCart returns a cart with its items at current prices and the
+// discounts and shipping checkout would apply, with coupon if one is given.
+// Totals only count items that can be bought now. userID is nil for
+// anonymous carts, whose per-customer discount limits cannot be checked yet.
+func loadCart(r *http.Request, cartID int, userID *int, coupon string) (models.Cart, error) {
+	cart := models.Cart{ID: cartID, Items: []models.CartItem{}, Discounts: []models.AppliedDiscount{}}
+
+	var updatedAt []byte
+	err := database.DB.QueryRow("SELECT updated_at FROM carts WHERE id = ?", cartID).Scan(&updatedAt)
+	if err != nil {
+		return cart, err
+	}
+	cart.Updated_at, err = helpers.ParseDatetime(updatedAt)
+	if err != nil {
+		return cart, err
+	}
+
+	query := "SELECT " + cartItemColumns + " " + cartItemJoins + " WHERE ci.cart_id = ? ORDER BY ci.id"
+	rows, err := database.DB.Query(query, cartID)
+	if err != nil {
+		return cart, err
+	}
+	defer rows.Close()
+
+	var available []models.CartItem
+	for rows.Next() {
+		item, _, _, err := scanCartItem(rows)
+		if err != nil {
+			return cart, err
+		}
+		if cart.Currency == "" {
+			cart.Currency = item.Currency
+		}
+		if item.Available {
+			cart.Item_count += item.Quantity
+			available = append(available, item)
+		}
+		cart.Items = append(cart.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return cart, err
+	}
+
+	result, rejected, err := priceItems(database.DB, available, cart.Currency, userID, coupon, requestLocale(r), false)
+	if err != nil {
+		return cart, err
+	}
+
+	cart.Subtotal = result.Subtotal
+	cart.Discount_total = result.Discount
+	cart.Shipping = result.Shipping
+	cart.Total = result.Total
+	cart.Discounts = appliedDiscounts(result)
+	cart.Coupon = rejected
+	return cart, nil
+}
+
+// cartUser is the ID of the signed-in caller, or nil for anonymous carts.
+func cartUser(r *http.Request) *int {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		return &userID
+	}
+	return nil
+}
+
+// Cart serves /cart: the caller's cart, or an empty one if there is none.
+// ?coupon= previews what a coupon code would take off.
+func Cart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cartID, _, err := findCart(r, false)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	cart := models.Cart{Items: []models.CartItem{}, Discounts: []models.AppliedDiscount{}}
+	if cartID != 0 {
+		cart, err = loadCart(r, cartID, cartUser(r), r.URL.Query().Get("coupon"))
+		if err != nil {
+			http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+			fmt.Printf("Error loading cart: %v\n", err)
+			return
+		}
+	}
+
+	writeCart(w, http.StatusOK, cart)
+}
+
+// CartItems serves /cart/items (POST adds an item) and /cart/items/{id}
+// (PUT changes its quantity, DELETE removes it).
+func CartItems(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/cart/items"), "/")
+	if idStr == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		AddCartItem(w, r)
+		return
+	}
+
+	itemID, err := strconv.Atoi(idStr)
+	if err != nil || itemID <= 0 {
+		http.Error(w, "Invalid cart item ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		UpdateCartItem(w, r, itemID)
+	case http.MethodDelete:
+		DeleteCartItem(w, r, itemID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func AddCartItem(w http.ResponseWriter, r *http.Request) {
+	var req cartRequest
+	err := helpers.ParseJSONRequestBody(r, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if req.Product_id <= 0 {
+		http.Error(w, "product_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity <= 0 {
+		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+		return
+	}
+
+	// Check the product can be bought before creating a cart for it
+	var currency string
+	var stock, variantCount int
+	query := "SELECT currency, stock, (SELECT COUNT(*) FROM product_variants WHERE product_id = products.id) FROM products WHERE id = ? AND status = 'published' AND deleted_at IS NULL"
+	err = database.DB.QueryRow(query, req.Product_id).Scan(&currency, &stock, &variantCount)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	if variantCount > 0 && req.Variant_id == nil {
+		http.Error(w, "This product has variants: variant_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.Variant_id != nil {
+		err = database.DB.QueryRow("SELECT stock FROM product_variants WHERE id = ? AND product_id = ?", *req.Variant_id, req.Product_id).Scan(&stock)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Variant not found for this product", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch variant", http.StatusInternalServerError)
+			fmt.Printf("Error fetching variant: %v\n", err)
+			return
+		}
+	}
+
+	cartID, token, err := findCart(r, true)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	// A cart holds a single currency so it can be checked out as one order
+	var cartCurrency string
+	query = "SELECT p.currency FROM cart_items ci JOIN products p ON p.id = ci.product_id WHERE ci.cart_id = ? LIMIT 1"
+	err = database.DB.QueryRow(query, cartID).Scan(&cartCurrency)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error fetching cart currency: %v\n", err)
+		return
+	}
+	if cartCurrency != "" && cartCurrency != currency {
+		writeConflict(w, "product_id", fmt.Sprintf("Cart is priced in %s; this product is priced in %s", cartCurrency, currency))
+		return
+	}
+
+	// Adding something already in the cart raises its quantity
+	var itemID, existing int
+	query = "SELECT id, quantity FROM cart_items WHERE cart_id = ? AND product_id = ? AND variant_id <=> ?"
+	err = database.DB.QueryRow(query, cartID, req.Product_id, req.Variant_id).Scan(&itemID, &existing)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error fetching cart item: %v\n", err)
+		return
+	}
+
+	quantity := existing + req.Quantity
+	if quantity > stock {
+		http.Error(w, fmt.Sprintf("Insufficient stock: only %d available", stock), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	if itemID != 0 {
+		_, err = database.DB.Exec("UPDATE cart_items SET quantity = ?, updated_at = ? WHERE id = ?", quantity, now, itemID)
+	} else {
+		query = "INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)"
+		_, err = database.DB.Exec(query, cartID, req.Product_id, req.Variant_id, quantity, now, now)
+	}
+	if err == nil {
+		_, err = database.DB.Exec("UPDATE carts SET updated_at = ? WHERE id = ?", now, cartID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to add item to cart", http.StatusInternalServerError)
+		fmt.Printf("Error adding cart item: %v\n", err)
+		return
+	}
+
+	cart, err := loadCart(r, cartID, cartUser(r), "")
+	if err != nil {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error loading cart: %v\n", err)
+		return
+	}
+	cart.Token = token
+
+	writeCart(w, http.StatusCreated, cart)
+}
+
+func UpdateCartItem(w http.ResponseWriter, r *http.Request, itemID int) {
+	var req cartRequest
+	err := helpers.ParseJSONRequestBody(r, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if req.Quantity <= 0 {
+		http.Error(w, "Quantity must be positive; use DELETE to remove an item", http.StatusBadRequest)
+		return
+	}
+
+	cartID, _, err := findCart(r, false)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	query := "SELECT " + cartItemColumns + " " + cartItemJoins + " WHERE ci.id = ? AND ci.cart_id = ?"
+	_, stock, onSale, err := scanCartItem(database.DB.QueryRow(query, itemID, cartID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Cart item not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch cart item", http.StatusInternalServerError)
+		fmt.Printf("Error fetching cart item: %v\n", err)
+		return
+	}
+
+	if !onSale {
+		http.Error(w, "Product is no longer available", http.StatusConflict)
+		return
+	}
+	if req.Quantity > stock {
+		http.Error(w, fmt.Sprintf("Insufficient stock: only %d available", stock), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	_, err = database.DB.Exec("UPDATE cart_items SET quantity = ?, updated_at = ? WHERE id = ?", req.Quantity, now, itemID)
+	if err == nil {
+		_, err = database.DB.Exec("UPDATE carts SET updated_at = ? WHERE id = ?", now, cartID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update cart item", http.StatusInternalServerError)
+		fmt.Printf("Error updating cart item: %v\n", err)
+		return
+	}
+
+	cart, err := loadCart(r, cartID, cartUser(r), "")
+	if err != nil {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error loading cart: %v\n", err)
+		return
+	}
+
+	writeCart(w, http.StatusOK, cart)
+}
+
+func DeleteCartItem(w http.ResponseWriter, r *http.Request, itemID int) {
+	cartID, _, err := findCart(r, false)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM cart_items WHERE id = ? AND cart_id = ?", itemID, cartID)
+	if err != nil {
+		http.Error(w, "Failed to remove cart item", http.StatusInternalServerError)
+		fmt.Printf("Error deleting cart item: %v\n", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to remove cart item", http.StatusInternalServerError)
+		fmt.Printf("Error getting rows affected: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Cart item not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Cart item removed successfully")
+}
+
+// MergeCart moves the items of the anonymous cart in the body into the
+// caller's cart.
+func MergeCart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	var req struct {
+		Cart_token string `json:"cart_token"`
+	}
+	err := helpers.ParseJSONRequestBody(r, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	cartID, err := mergeAnonymousCart(userID, req.Cart_token)
+	if err != nil {
+		writeCartError(w, err)
+		return
+	}
+
+	cart, err := loadCart(r, cartID, cartUser(r), "")
+	if err != nil {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error loading cart: %v\n", err)
+		return
+	}
+
+	writeCart(w, http.StatusOK, cart)
+}
+
+// mergeAnonymousCart adds the items of the anonymous cart named by token to
+// the user's cart, creating it if needed, and deletes the anonymous cart.
+// Items already in the user's cart have their quantities added together.
+// Returns the user's cart ID.
+func mergeAnonymousCart(userID int, token string) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	anonID, err := anonymousCart(tx, token, true)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var cartID int
+	err = tx.QueryRow("SELECT id FROM carts WHERE user_id = ? FOR UPDATE", userID).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		// Nothing to merge into: the anonymous cart becomes the user's
+		_, err = tx.Exec("UPDATE carts SET user_id = ?, token_nonce = NULL, updated_at = ? WHERE id = ?", userID, now, anonID)
+		if err != nil {
+			return 0, err
+		}
+		return anonID, tx.Commit()
+	} else if err != nil {
+		return 0, err
+	}
+
+	query := `UPDATE cart_items ci
+		JOIN cart_items anon ON anon.product_id = ci.product_id AND anon.variant_id <=> ci.variant_id
+		SET ci.quantity = ci.quantity + anon.quantity, ci.updated_at = ?
+		WHERE ci.cart_id = ? AND anon.cart_id = ?`
+	_, err = tx.Exec(query, now, cartID, anonID)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `DELETE anon FROM cart_items anon
+		JOIN cart_items ci ON ci.product_id = anon.product_id AND ci.variant_id <=> anon.variant_id
+		WHERE anon.cart_id = ? AND ci.cart_id = ?`
+	_, err = tx.Exec(query, anonID, cartID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE cart_items SET cart_id = ?, updated_at = ? WHERE cart_id = ?", cartID, now, anonID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM carts WHERE id = ?", anonID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE carts SET updated_at = ? WHERE id = ?", now, cartID)
+	if err != nil {
+		return 0, err
+	}
+
+	return cartID, tx.Commit()
+}
+
+func writeCart(w http.ResponseWriter, status int, cart models.Cart) {
+	response := map[string]interface{}{
+		"cart": cart,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
@@ -14,49 +14,15 @@ import (
 )
 
 func GetCategory(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT * FROM categories"
-	rows, err := database.DB.Query(query)
-	if err != nil {
-		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
-		fmt.Printf("Error executing query: %v\n", err)
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
 		return
 	}
-	defer rows.Close()
-
-	var categories []models.Category
-
-	for rows.Next() {
-		var category models.Category
-		var createdAt []byte
-		var updatedAt []byte
-
-		err := rows.Scan(&category.ID, &category.Name, &createdAt, &updatedAt)
-		if err != nil {
-			http.Error(w, "Failed to scan category", http.StatusInternalServerError)
-			fmt.Printf("Error scanning row: %v\n", err)
-			return
-		}
-
-		category.Created_at, err = helpers.ParseDatetime(createdAt)
-		if err != nil {
-			http.Error(w, "Failed to parse created_at", http.StatusInternalServerError)
-			fmt.Printf("Error parsing created_at: %v\n", err)
-			return
-		}
 
-		category.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
-		if err != nil {
-			http.Error(w, "Failed to parse updated_at", http.StatusInternalServerError)
-			fmt.Printf("Error parsing updated_at: %v\n", err)
-			return
-		}
-
-		categories = append(categories, category)
-	}
-
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
-		fmt.Printf("Error during row iteration: %v\n", err)
+	categories, err := loadCategories(withDeleted)
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching categories: %v\n", err)
 		return
 	}
 
@@ -87,19 +53,61 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Printf("Decoded category: %+v\n", category)
 
+	category.Name = strings.TrimSpace(category.Name)
 	if category.Name == "" {
 		http.Error(w, "Name is required", http.StatusBadRequest)
 		fmt.Printf("Validation failed: Name=%s\n", category.Name)
 		return
 	}
 
+	if category.Parent_id != nil {
+		var exists bool
+		err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = ? AND deleted_at IS NULL)", *category.Parent_id).Scan(&exists)
+		if err != nil {
+			http.Error(w, "Failed to check parent category", http.StatusInternalServerError)
+			fmt.Printf("Error checking parent category: %v\n", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Parent category not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// An explicit slug must be free; one derived from the name gets a
+	// numeric suffix instead
+	if category.Slug != "" {
+		category.Slug = helpers.Slugify(category.Slug)
+		if category.Slug == "" {
+			http.Error(w, "Slug must contain letters or digits", http.StatusBadRequest)
+			return
+		}
+	} else {
+		category.Slug, err = uniqueCategorySlug(helpers.Slugify(category.Name))
+		if err != nil {
+			http.Error(w, "Failed to generate slug", http.StatusInternalServerError)
+			fmt.Printf("Error generating slug: %v\n", err)
+			return
+		}
+	}
+
+	err = database.DB.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM categories WHERE parent_id <=> ? AND deleted_at IS NULL", category.Parent_id).Scan(&category.Position)
+	if err != nil {
+		http.Error(w, "Failed to create Category", http.StatusInternalServerError)
+		fmt.Printf("Error finding next position: %v\n", err)
+		return
+	}
+
 	now := time.Now()
 	category.Created_at = now
 	category.Updated_at = sql.NullTime{Valid: false} // Set Updated_at to NULL
 
-	query := "INSERT INTO categories (name, created_at, updated_at) VALUES (?, ?, ?)"
-	result, err := database.DB.Exec(query, category.Name, category.Created_at, category.Updated_at)
-	if err != nil {
+	query := "INSERT INTO categories (parent_id, name, slug, position, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := database.DB.Exec(query, category.Parent_id, category.Name, category.Slug, category.Position, category.Created_at, category.Updated_at)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "slug", "A category with this slug already exists")
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to create Category", http.StatusInternalServerError)
 		fmt.Printf("Error executing query: %v\n", err)
 		return
@@ -125,6 +133,17 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Patch documents get PATCH semantics; plain JSON replaces the name
+	if patchType(r) != "" {
+		PatchCategory(w, r, id)
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var category models.Category
 
 	// Parse JSON body
@@ -136,6 +155,7 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
+	category.Name = strings.TrimSpace(category.Name)
 	if category.Name == "" {
 		http.Error(w, "Name is required", http.StatusBadRequest)
 		fmt.Printf("Validation failed: Name=%s\n", category.Name)
@@ -146,10 +166,29 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	category.Updated_at = sql.NullTime{Time: now, Valid: true}
 
-	// Query to update category
-	query := "UPDATE categories SET name = ?, updated_at = ? WHERE id = ?"
-	result, err := database.DB.Exec(query, category.Name, category.Updated_at, id)
-	if err != nil {
+	// Slugs are part of URLs, so renaming keeps the old one unless a new
+	// slug is given explicitly. Parent and position change through
+	// /move/categories/{id}.
+	query := "UPDATE categories SET name = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL"
+	args := []interface{}{category.Name, category.Updated_at, id}
+	if category.Slug != "" {
+		category.Slug = helpers.Slugify(category.Slug)
+		if category.Slug == "" {
+			http.Error(w, "Slug must contain letters or digits", http.StatusBadRequest)
+			return
+		}
+		query = "UPDATE categories SET name = ?, slug = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL"
+		args = []interface{}{category.Name, category.Slug, category.Updated_at, id}
+	}
+	condition, conditionArgs := versionCondition(versions)
+	query += condition
+	args = append(args, conditionArgs...)
+
+	result, err := database.DB.Exec(query, args...)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "slug", "A category with this slug already exists")
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to update category", http.StatusInternalServerError)
 		fmt.Printf("Error executing query: %v\n", err)
 		return
@@ -162,7 +201,10 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if rowsAffected == 0 {
+	if rowsAffected == 0 && versions != nil {
+		http.Error(w, errVersionMismatch.Message, errVersionMismatch.Status)
+		return
+	} else if rowsAffected == 0 {
 		http.Error(w, "Category not found", http.StatusNotFound)
 		return
 	}
@@ -170,3 +212,88 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Category updated successfully")
 }
+
+// categoryPatch holds the fields a patch may change. Parent and position
+// change through /move/categories/{id}.
+type categoryPatch struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// PatchCategory serves PATCH /update/categories/{id} with a merge patch or
+// JSON Patch applied to the category's name and slug.
+func PatchCategory(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	patch, mediaType, ok := readPatch(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var version int
+	var current categoryPatch
+	err = tx.QueryRow("SELECT version, name, slug FROM categories WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id).Scan(&version, &current.Name, &current.Slug)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category: %v\n", err)
+		return
+	}
+	if versions != nil && !containsInt(versions, version) {
+		http.Error(w, errVersionMismatch.Message, errVersionMismatch.Status)
+		return
+	}
+
+	var patched categoryPatch
+	if !applyPatch(w, mediaType, patch, current, &patched) {
+		return
+	}
+
+	patched.Name = strings.TrimSpace(patched.Name)
+	if patched.Name == "" {
+		http.Error(w, "Name is required", http.StatusUnprocessableEntity)
+		return
+	}
+	patched.Slug = helpers.Slugify(patched.Slug)
+	if patched.Slug == "" {
+		http.Error(w, "Slug must contain letters or digits", http.StatusUnprocessableEntity)
+		return
+	}
+
+	query := "UPDATE categories SET name = ?, slug = ?, updated_at = ?, version = version + 1 WHERE id = ?"
+	_, err = tx.Exec(query, patched.Name, patched.Slug, time.Now(), id)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "slug", "A category with this slug already exists")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	writePatched(w, "category", id, version+1, patched)
+}
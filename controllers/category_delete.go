@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/search"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeleteCategory serves DELETE /categories/{id}, moving the category to the
+// trash. A category that still has products or subcategories is only
+// deleted when the request says what happens to them:
+//
+//	?reassign_to={id}  products move to that category, subcategories move
+//	                   up to the deleted category's parent
+//	?cascade=true      the whole subtree is trashed with its products;
+//	                   restoring the category brings them all back
+//
+// Either way the caller must manage every product affected.
+func DeleteCategory(w http.ResponseWriter, r *http.Request, ref string) {
+	userID := r.Context().Value("userID").(int)
+
+	id, err := strconv.Atoi(ref)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", ref)
+		return
+	}
+
+	params := r.URL.Query()
+	cascade := params.Get("cascade") == "true"
+	var reassignTo int
+	if s := params.Get("reassign_to"); s != "" {
+		reassignTo, err = strconv.Atoi(s)
+		if err != nil || reassignTo <= 0 {
+			http.Error(w, "Invalid reassign_to category ID", http.StatusBadRequest)
+			return
+		}
+		if reassignTo == id {
+			http.Error(w, "A category cannot be reassigned to itself", http.StatusBadRequest)
+			return
+		}
+	}
+	if cascade && reassignTo > 0 {
+		http.Error(w, "Use either reassign_to or cascade, not both", http.StatusBadRequest)
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	var version int
+	err = tx.QueryRow("SELECT parent_id, version FROM categories WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id).Scan(&parentID, &version)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category: %v\n", err)
+		return
+	}
+	if versions != nil && !containsInt(versions, version) {
+		http.Error(w, errVersionMismatch.Message, errVersionMismatch.Status)
+		return
+	}
+
+	if reassignTo > 0 {
+		var lockedID int
+		err = tx.QueryRow("SELECT id FROM categories WHERE id = ? AND deleted_at IS NULL FOR UPDATE", reassignTo).Scan(&lockedID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Category to reassign to not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+			fmt.Printf("Error fetching category: %v\n", err)
+			return
+		}
+	}
+
+	subtree, err := categoryDescendants(tx, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch subcategories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching subcategories: %v\n", err)
+		return
+	}
+
+	// Cascade trashes the subtree's products; otherwise only the category's
+	// own products are affected
+	affected := []int{id}
+	if cascade {
+		affected = subtree
+	}
+	productIDs, foreign, err := lockCategoryProducts(tx, affected, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category products: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+
+	switch {
+	case cascade:
+		if foreign > 0 {
+			http.Error(w, fmt.Sprintf("Cannot cascade: %d products in this category tree belong to other users or to shops you do not manage", foreign), http.StatusConflict)
+			return
+		}
+
+		// Everything shares one deleted_at so a restore can tell what was
+		// trashed together
+		if len(productIDs) > 0 {
+			placeholders, args := helpers.InPlaceholders(productIDs)
+			_, err = tx.Exec(fmt.Sprintf("UPDATE products SET deleted_at = ? WHERE id IN (%s)", placeholders), append([]interface{}{now}, args...)...)
+			if err != nil {
+				http.Error(w, "Failed to delete products", http.StatusInternalServerError)
+				fmt.Printf("Error deleting products: %v\n", err)
+				return
+			}
+		}
+
+		placeholders, args := helpers.InPlaceholders(subtree)
+		_, err = tx.Exec(fmt.Sprintf("UPDATE categories SET deleted_at = ? WHERE id IN (%s)", placeholders), append([]interface{}{now}, args...)...)
+		if err != nil {
+			http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+			fmt.Printf("Error committing transaction: %v\n", err)
+			return
+		}
+		for _, productID := range productIDs {
+			if err := search.Default.Remove(productID); err != nil {
+				fmt.Printf("Error removing product %d from search: %v\n", productID, err)
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Category deleted successfully with %d subcategories and %d products", len(subtree)-1, len(productIDs))
+		return
+
+	case reassignTo > 0:
+		trashedForeign, err := lockTrashedCategoryProducts(tx, id, userID)
+		if err != nil {
+			http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+			fmt.Printf("Error fetching trashed category products: %v\n", err)
+			return
+		}
+		if foreign+trashedForeign > 0 {
+			http.Error(w, fmt.Sprintf("Cannot reassign: %d products in this category, trashed ones included, belong to other users or to shops you do not manage", foreign+trashedForeign), http.StatusConflict)
+			return
+		}
+
+		// Trashed products move too, so they can still be restored
+		_, err = tx.Exec("UPDATE products SET category_id = ?, updated_at = ?, version = version + 1 WHERE category_id = ?", reassignTo, now, id)
+		if err == nil {
+			var newParent interface{}
+			if parentID.Valid {
+				newParent = parentID.Int64
+			}
+			_, err = tx.Exec("UPDATE categories SET parent_id = ?, updated_at = ?, version = version + 1 WHERE parent_id = ? AND deleted_at IS NULL", newParent, now, id)
+		}
+		if err != nil {
+			http.Error(w, "Failed to reassign category contents", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+
+	default:
+		if len(productIDs) > 0 {
+			http.Error(w, fmt.Sprintf("Category still has %d products; pass reassign_to or cascade=true", len(productIDs)), http.StatusConflict)
+			return
+		}
+		if len(subtree) > 1 {
+			http.Error(w, "Category still has subcategories; pass reassign_to or cascade=true", http.StatusConflict)
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE categories SET deleted_at = ? WHERE id = ?", now, id)
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	for _, productID := range productIDs {
+		reindexProduct(productID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Category deleted successfully")
+}
+
+// MergeCategory serves POST /merge/categories/{id} with {"into": id}: the
+// category's products and subcategories move into the target, then the
+// category is moved to the trash. The caller must manage every product
+// that moves.
+func MergeCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/merge/categories/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Into int `json:"into"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+	if input.Into <= 0 || input.Into == id {
+		http.Error(w, "into must be the ID of another category", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to merge categories", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM categories WHERE id IN (?, ?) AND deleted_at IS NULL FOR UPDATE", id, input.Into)
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching categories: %v\n", err)
+		return
+	}
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching categories: %v\n", err)
+		return
+	}
+	if found != 2 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	// The subcategories move under the target, which therefore must not be
+	// one of them
+	subtree, err := categoryDescendants(tx, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch subcategories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching subcategories: %v\n", err)
+		return
+	}
+	for _, descendant := range subtree {
+		if descendant == input.Into {
+			http.Error(w, "A category cannot be merged into one of its subcategories", http.StatusConflict)
+			return
+		}
+	}
+
+	productIDs, foreign, err := lockCategoryProducts(tx, []int{id}, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category products: %v\n", err)
+		return
+	}
+	trashedForeign, err := lockTrashedCategoryProducts(tx, id, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching trashed category products: %v\n", err)
+		return
+	}
+	if foreign+trashedForeign > 0 {
+		http.Error(w, fmt.Sprintf("Cannot merge: %d products in this category, trashed ones included, belong to other users or to shops you do not manage", foreign+trashedForeign), http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	_, err = tx.Exec("UPDATE products SET category_id = ?, updated_at = ?, version = version + 1 WHERE category_id = ?", input.Into, now, id)
+	if err != nil {
+		http.Error(w, "Failed to move products", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	// Moved subcategories keep their order, after the target's own
+	var offset int
+	err = tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM categories WHERE parent_id = ? AND deleted_at IS NULL", input.Into).Scan(&offset)
+	if err == nil {
+		_, err = tx.Exec("UPDATE categories SET parent_id = ?, position = position + ?, updated_at = ?, version = version + 1 WHERE parent_id = ? AND deleted_at IS NULL", input.Into, offset, now, id)
+	}
+	if err != nil {
+		http.Error(w, "Failed to move subcategories", http.StatusInternalServerError)
+		fmt.Printf("Error moving subcategories: %v\n", err)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE categories SET deleted_at = ? WHERE id = ?", now, id)
+	if err != nil {
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to merge categories", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	for _, productID := range productIDs {
+		reindexProduct(productID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Category merged successfully; %d products moved", len(productIDs))
+}
+
+// lockCategoryProducts locks and returns the IDs of the live products in
+// the given categories, and counts how many of them userID could not
+// trash: products of other users and of shops userID does not manage.
+func lockCategoryProducts(tx *sql.Tx, categoryIDs []int, userID int) ([]int, int, error) {
+	placeholders, args := helpers.InPlaceholders(categoryIDs)
+	return lockManagedProducts(tx, fmt.Sprintf("p.category_id IN (%s) AND p.deleted_at IS NULL", placeholders), args, userID)
+}
+
+// lockTrashedCategoryProducts locks the trashed products of categoryID,
+// which move along when the category is reassigned or merged so they can
+// still be restored, and counts how many of them userID does not manage.
+func lockTrashedCategoryProducts(tx *sql.Tx, categoryID, userID int) (int, error) {
+	_, foreign, err := lockManagedProducts(tx, "p.category_id = ? AND p.deleted_at IS NOT NULL", []interface{}{categoryID}, userID)
+	return foreign, err
+}
+
+// lockManagedProducts locks and returns the IDs of the products matching
+// condition, and counts how many of them userID does not manage.
+func lockManagedProducts(tx *sql.Tx, condition string, args []interface{}, userID int) ([]int, int, error) {
+	query := fmt.Sprintf(`SELECT p.id, p.user_id, p.shop_id, m.role FROM products p
+		LEFT JOIN shop_members m ON m.shop_id = p.shop_id AND m.user_id = ?
+		WHERE %s FOR UPDATE`, condition)
+	rows, err := tx.Query(query, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	foreign := 0
+	for rows.Next() {
+		var id, ownerID int
+		var shopID sql.NullInt64
+		var memberRole sql.NullString
+		if err := rows.Scan(&id, &ownerID, &shopID, &memberRole); err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, id)
+		if !roleAtLeast(productRole(userID, ownerID, shopID, memberRole), models.ShopManager) {
+			foreign++
+		}
+	}
+	return ids, foreign, rows.Err()
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"loginApi/database/dbtest"
+	"loginApi/search"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMergeCategoryChecksTrashedProducts(t *testing.T) {
+	previous := search.Default
+	search.Default = search.NewMemory(nil)
+	t.Cleanup(func() { search.Default = previous })
+
+	tests := []struct {
+		name        string
+		trashedUser int
+		status      int
+	}{
+		{"own trashed product", 7, http.StatusOK},
+		{"someone else's trashed product", 8, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := dbtest.Use(t)
+			stub.On(`^SELECT id FROM categories WHERE id IN`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"id"}, []driver.Value{4}, []driver.Value{5}), nil
+			})
+			stub.On(`^WITH RECURSIVE subtree`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"id"}, []driver.Value{4}), nil
+			})
+			// Every live product is the caller's; the trashed one is tt's
+			stub.On(`FROM products p LEFT JOIN shop_members m .* p.deleted_at IS NULL FOR UPDATE`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"id", "user_id", "shop_id", "role"}, []driver.Value{10, 7, nil, nil}), nil
+			})
+			stub.On(`FROM products p LEFT JOIN shop_members m .* p.deleted_at IS NOT NULL FOR UPDATE`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"id", "user_id", "shop_id", "role"}, []driver.Value{11, tt.trashedUser, nil, nil}), nil
+			})
+			stub.On(`^UPDATE (products|categories) SET`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Result{Affected: 1}, nil
+			})
+			stub.On(`^SELECT COALESCE\(MAX\(position\)`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"offset"}, []driver.Value{0}), nil
+			})
+			stub.On(`^SELECT name, category_id, status = 'published'`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"name", "category_id", "searchable"}, []driver.Value{"Mug", 5, false}), nil
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/merge/categories/4", strings.NewReader(`{"into": 5}`))
+			r.Header.Set("Content-Type", "application/json")
+			r = r.WithContext(context.WithValue(r.Context(), "userID", 7))
+			w := httptest.NewRecorder()
+			MergeCategory(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if moved := stub.Ran(`^UPDATE products SET category_id`); moved != (tt.status == http.StatusOK) {
+				t.Fatalf("products moved = %v: %q", moved, stub.Statements())
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCategoryDepth bounds walks up the tree so a corrupt parent chain
+// cannot loop forever.
+const maxCategoryDepth = 100
+
+const categoryColumns = "id, version, parent_id, name, slug, position, created_at, updated_at, deleted_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCategory(row rowScanner) (models.Category, error) {
+	var category models.Category
+	var parentID sql.NullInt64
+	var createdAt []byte
+	var updatedAt []byte
+	var deletedAt []byte
+
+	err := row.Scan(&category.ID, &category.Version, &parentID, &category.Name, &category.Slug, &category.Position, &createdAt, &updatedAt, &deletedAt)
+	if err != nil {
+		return category, err
+	}
+
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.Parent_id = &id
+	}
+
+	category.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return category, err
+	}
+	category.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	if err != nil {
+		return category, err
+	}
+	category.Deleted_at, err = helpers.ParseNullableDatetime(deletedAt)
+	return category, err
+}
+
+// loadCategories returns the categories ordered so that siblings appear in
+// their display order. Deleted ones are left out unless withDeleted is set.
+func loadCategories(withDeleted bool) ([]models.Category, error) {
+	query := "SELECT " + categoryColumns + " FROM categories WHERE deleted_at IS NULL ORDER BY position, name, id"
+	if withDeleted {
+		query = "SELECT " + categoryColumns + " FROM categories ORDER BY position, name, id"
+	}
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// categoryDescendants returns categoryID and the IDs of every category
+// below it.
+func categoryDescendants(q queryer, categoryID int) ([]int, error) {
+	query := `WITH RECURSIVE subtree (id) AS (
+			SELECT id FROM categories WHERE id = ? AND deleted_at IS NULL
+			UNION DISTINCT
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM subtree`
+	rows, err := q.Query(query, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// categoryBreadcrumbs returns the path from the root down to categoryID.
+func categoryBreadcrumbs(categoryID int) ([]models.Breadcrumb, error) {
+	query := `WITH RECURSIVE path (id, parent_id, name, slug, depth) AS (
+			SELECT id, parent_id, name, slug, 0 FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, c.name, c.slug, p.depth + 1
+			FROM categories c JOIN path p ON c.id = p.parent_id
+			WHERE p.depth < ?
+		)
+		SELECT id, name, slug FROM path ORDER BY depth DESC`
+	rows, err := database.DB.Query(query, categoryID, maxCategoryDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breadcrumbs := []models.Breadcrumb{}
+	for rows.Next() {
+		var crumb models.Breadcrumb
+		if err := rows.Scan(&crumb.ID, &crumb.Name, &crumb.Slug); err != nil {
+			return nil, err
+		}
+		breadcrumbs = append(breadcrumbs, crumb)
+	}
+	return breadcrumbs, rows.Err()
+}
+
+// uniqueCategorySlug returns base, or base with the lowest numeric suffix
+// ("shoes-2") that no other category uses.
+func uniqueCategorySlug(base string) (string, error) {
+	if base == "" {
+		base = "category"
+	}
+
+	// Slugify output only contains [a-z0-9-], so it needs no LIKE escaping
+	rows, err := database.DB.Query("SELECT slug FROM categories WHERE slug = ? OR slug LIKE ?", base, base+"-%")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return "", err
+		}
+		taken[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	slug := base
+	for n := 2; taken[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// Categories serves /categories/tree and /categories/{id or slug}. Routes
+// only let authenticated requests through for anything but GET.
+func Categories(w http.ResponseWriter, r *http.Request) {
+	ref := strings.TrimPrefix(r.URL.Path, "/categories/")
+	if ref == "tree" {
+		GetCategoryTree(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		GetCategoryDetail(w, r, ref)
+	case http.MethodDelete:
+		DeleteCategory(w, r, ref)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetCategoryTree serves GET /categories/tree: every category nested under
+// its parent, siblings in display order.
+func GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := loadCategories(false)
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching categories: %v\n", err)
+		return
+	}
+
+	nodes := make(map[int]*models.CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &models.CategoryNode{Category: category, Children: []*models.CategoryNode{}}
+	}
+
+	// categories is already in display order, so appending keeps siblings
+	// sorted
+	roots := []*models.CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.Parent_id == nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent, ok := nodes[*category.Parent_id]
+		if !ok {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"categories": roots})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// GetCategoryDetail serves GET /categories/{id or slug} with breadcrumbs
+// and direct children.
+func GetCategoryDetail(w http.ResponseWriter, r *http.Request, ref string) {
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	query := "SELECT " + categoryColumns + " FROM categories WHERE slug = ?"
+	var arg interface{} = ref
+	if id, err := strconv.Atoi(ref); err == nil {
+		query = "SELECT " + categoryColumns + " FROM categories WHERE id = ?"
+		arg = id
+	}
+	if !withDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+
+	category, err := scanCategory(database.DB.QueryRow(query, arg))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category: %v\n", err)
+		return
+	}
+
+	detail := models.CategoryDetail{Category: category, Children: []models.Category{}}
+
+	detail.Breadcrumbs, err = categoryBreadcrumbs(category.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch breadcrumbs", http.StatusInternalServerError)
+		fmt.Printf("Error fetching breadcrumbs: %v\n", err)
+		return
+	}
+
+	rows, err := database.DB.Query("SELECT "+categoryColumns+" FROM categories WHERE parent_id = ? AND deleted_at IS NULL ORDER BY position, name, id", category.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch subcategories", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		child, err := scanCategory(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan category", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		detail.Children = append(detail.Children, child)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	writeVersionedJSON(w, r, category.Version, map[string]interface{}{"category": detail})
+}
+
+// MoveCategory serves POST /move/categories/{id}. The body names the new
+// parent (null for the root) and optionally the position among the new
+// siblings; the whole subtree moves with the category.
+func MoveCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/move/categories/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Parent_id *int `json:"parent_id"`
+		Position  *int `json:"position"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+	if input.Position != nil && *input.Position < 0 {
+		http.Error(w, "Position must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to move category", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var lockedID int
+	err = tx.QueryRow("SELECT id FROM categories WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category: %v\n", err)
+		return
+	}
+
+	// Walk up from the new parent, locking each ancestor so a concurrent
+	// move cannot close a loop behind our back. Meeting the category itself
+	// means the move would make it its own ancestor.
+	for ancestor, depth := input.Parent_id, 0; ancestor != nil; depth++ {
+		if *ancestor == id {
+			http.Error(w, "A category cannot be moved into itself or one of its descendants", http.StatusConflict)
+			return
+		}
+		if depth >= maxCategoryDepth {
+			http.Error(w, "Category tree is too deep", http.StatusConflict)
+			return
+		}
+
+		var parentID sql.NullInt64
+		err = tx.QueryRow("SELECT parent_id FROM categories WHERE id = ? AND deleted_at IS NULL FOR UPDATE", *ancestor).Scan(&parentID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Parent category not found", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch parent category", http.StatusInternalServerError)
+			fmt.Printf("Error fetching parent category: %v\n", err)
+			return
+		}
+
+		ancestor = nil
+		if parentID.Valid {
+			next := int(parentID.Int64)
+			ancestor = &next
+		}
+	}
+
+	var position int
+	if input.Position != nil {
+		// Make room at the requested position
+		position = *input.Position
+		_, err = tx.Exec("UPDATE categories SET position = position + 1, version = version + 1 WHERE parent_id <=> ? AND position >= ? AND id <> ? AND deleted_at IS NULL", input.Parent_id, position, id)
+	} else {
+		err = tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM categories WHERE parent_id <=> ? AND id <> ? AND deleted_at IS NULL", input.Parent_id, id).Scan(&position)
+	}
+	if err != nil {
+		http.Error(w, "Failed to move category", http.StatusInternalServerError)
+		fmt.Printf("Error positioning category: %v\n", err)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE categories SET parent_id = ?, position = ?, updated_at = ?, version = version + 1 WHERE id = ?", input.Parent_id, position, time.Now(), id)
+	if err != nil {
+		http.Error(w, "Failed to move category", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to move category", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Category moved successfully")
+}
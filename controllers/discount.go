@@ -0,0 +1,597 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/config"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/money"
+	"loginApi/pricing"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discountColumns selects a discount without its scopes.
+const discountColumns = `id, code, name, kind, value, currency, min_subtotal, starts_at, ends_at, usage_limit, per_user_limit, active, created_at, updated_at,
+	(SELECT COUNT(*) FROM discount_redemptions dr JOIN orders o ON o.id = dr.order_id WHERE dr.discount_id = discounts.id AND o.status <> 'cancelled')`
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,64}$`)
+
+// dbQueryer is implemented by both *sql.DB and *sql.Tx.
+type dbQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func scanDiscount(row rowScanner) (models.Discount, error) {
+	var discount models.Discount
+	var startsAt, endsAt, createdAt, updatedAt []byte
+
+	err := row.Scan(&discount.ID, &discount.Code, &discount.Name, &discount.Kind, &discount.Value, &discount.Currency, &discount.Min_subtotal,
+		&startsAt, &endsAt, &discount.Usage_limit, &discount.Per_user_limit, &discount.Active, &createdAt, &updatedAt, &discount.Times_used)
+	if err != nil {
+		return discount, err
+	}
+
+	discount.Starts_at, err = helpers.ParseOptionalDatetime(startsAt)
+	if err != nil {
+		return discount, err
+	}
+	discount.Ends_at, err = helpers.ParseOptionalDatetime(endsAt)
+	if err != nil {
+		return discount, err
+	}
+	discount.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return discount, err
+	}
+	discount.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	return discount, err
+}
+
+// loadDiscountScopes fills in the product and category IDs of discounts.
+func loadDiscountScopes(q dbQueryer, discounts []models.Discount) error {
+	if len(discounts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(discounts))
+	index := map[int]int{}
+	for i := range discounts {
+		ids[i] = discounts[i].ID
+		index[discounts[i].ID] = i
+		discounts[i].Product_ids = []int{}
+		discounts[i].Category_ids = []int{}
+	}
+	placeholders, args := helpers.InPlaceholders(ids)
+
+	scopes := []struct {
+		table, column string
+	}{
+		{"discount_products", "product_id"},
+		{"discount_categories", "category_id"},
+	}
+	for _, scope := range scopes {
+		query := fmt.Sprintf("SELECT discount_id, %s FROM %s WHERE discount_id IN (%s) ORDER BY %s", scope.column, scope.table, placeholders, scope.column)
+		rows, err := q.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var discountID, id int
+			if err := rows.Scan(&discountID, &id); err != nil {
+				rows.Close()
+				return err
+			}
+			d := &discounts[index[discountID]]
+			if scope.table == "discount_products" {
+				d.Product_ids = append(d.Product_ids, id)
+			} else {
+				d.Category_ids = append(d.Category_ids, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discountRule turns a discount into a pricing rule, expanding its
+// categories to include their subcategories.
+func discountRule(q dbQueryer, discount models.Discount) (pricing.Rule, error) {
+	rule := pricing.Rule{
+		ID:          discount.ID,
+		Name:        discount.Name,
+		Kind:        discount.Kind,
+		Value:       discount.Value,
+		MinSubtotal: discount.Min_subtotal,
+		ProductIDs:  discount.Product_ids,
+		StartsAt:    discount.Starts_at,
+		EndsAt:      discount.Ends_at,
+	}
+	if discount.Code != nil {
+		rule.Code = *discount.Code
+	}
+	if discount.Currency != nil {
+		rule.Currency = *discount.Currency
+	}
+
+	for _, categoryID := range discount.Category_ids {
+		descendants, err := categoryDescendants(q, categoryID)
+		if err != nil {
+			return rule, err
+		}
+		rule.CategoryIDs = append(rule.CategoryIDs, descendants...)
+	}
+	return rule, nil
+}
+
+// discountUses counts a discount's redemptions, or one user's, leaving out
+// cancelled orders.
+func discountUses(q dbQueryer, discountID int, userID *int) (int, error) {
+	query := "SELECT COUNT(*) FROM discount_redemptions dr JOIN orders o ON o.id = dr.order_id WHERE dr.discount_id = ? AND o.status <> 'cancelled'"
+	args := []interface{}{discountID}
+	if userID != nil {
+		query += " AND dr.user_id = ?"
+		args = append(args, *userID)
+	}
+
+	var uses int
+	err := q.QueryRow(query, args...).Scan(&uses)
+	return uses, err
+}
+
+// priceItems works out the discounts and shipping for cart items in one
+// currency. Automatic promotions that cannot be used are skipped quietly;
+// a coupon that cannot be used is returned with the reason. With lock set
+// the discount rows stay locked for the rest of the transaction, so two
+// checkouts cannot both take a coupon's last use.
+func priceItems(q dbQueryer, items []models.CartItem, currency string, userID *int, coupon, locale string, lock bool) (pricing.Result, *models.RejectedDiscount, error) {
+	basket := pricing.Basket{Currency: currency}
+	for _, item := range items {
+		basket.Lines = append(basket.Lines, pricing.Line{ProductID: item.Product_id, CategoryID: item.Category_id, LineTotal: item.Line_total})
+	}
+	if len(basket.Lines) > 0 {
+		basket.Shipping = config.App.Shipping.FlatFees[currency]
+	}
+
+	coupon = normalizeCouponCode(coupon)
+	reject := func(reason string) *models.RejectedDiscount {
+		return &models.RejectedDiscount{Code: coupon, Reason: reason}
+	}
+
+	query := "SELECT " + discountColumns + " FROM discounts WHERE active = TRUE AND (code IS NULL OR code = ?) ORDER BY id"
+	if lock {
+		query += " FOR UPDATE"
+	}
+	rows, err := q.Query(query, coupon)
+	if err != nil {
+		return pricing.Result{}, nil, err
+	}
+	var discounts []models.Discount
+	for rows.Next() {
+		discount, err := scanDiscount(rows)
+		if err != nil {
+			rows.Close()
+			return pricing.Result{}, nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return pricing.Result{}, nil, err
+	}
+
+	var rejected *models.RejectedDiscount
+	if coupon != "" {
+		rejected = reject("Unknown or inactive coupon code")
+	}
+
+	var usable []models.Discount
+	for _, discount := range discounts {
+		isCoupon := discount.Code != nil
+		if isCoupon {
+			rejected = nil
+		}
+
+		if discount.Usage_limit != nil && discount.Times_used >= *discount.Usage_limit {
+			if isCoupon {
+				rejected = reject("This coupon has been fully redeemed")
+			}
+			continue
+		}
+		if discount.Per_user_limit != nil && userID != nil {
+			uses, err := discountUses(q, discount.ID, userID)
+			if err != nil {
+				return pricing.Result{}, nil, err
+			}
+			if uses >= *discount.Per_user_limit {
+				if isCoupon {
+					rejected = reject("You have already used this coupon as many times as allowed")
+				}
+				continue
+			}
+		}
+		usable = append(usable, discount)
+	}
+
+	err = loadDiscountScopes(q, usable)
+	if err != nil {
+		return pricing.Result{}, nil, err
+	}
+
+	var rules []pricing.Rule
+	for _, discount := range usable {
+		rule, err := discountRule(q, discount)
+		if err != nil {
+			return pricing.Result{}, nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	result := pricing.Evaluate(basket, rules, time.Now(), locale)
+	for _, r := range result.Rejected {
+		if coupon != "" && r.Rule.Code == coupon {
+			rejected = reject(r.Reason)
+		}
+	}
+
+	return result, rejected, nil
+}
+
+func appliedDiscounts(result pricing.Result) []models.AppliedDiscount {
+	applied := []models.AppliedDiscount{}
+	for _, a := range result.Applied {
+		discount := models.AppliedDiscount{
+			Discount_id: a.Rule.ID,
+			Name:        a.Rule.Name,
+			Kind:        a.Rule.Kind,
+			Amount:      a.Amount,
+			Explanation: a.Explanation,
+		}
+		if a.Rule.Code != "" {
+			code := a.Rule.Code
+			discount.Code = &code
+		}
+		applied = append(applied, discount)
+	}
+	return applied
+}
+
+// requestLocale is the locale explanations are written for.
+func requestLocale(r *http.Request) string {
+	return money.MatchLocale(r.Header.Get("Accept-Language"), config.App.Money.DefaultLocale)
+}
+
+func loadOrderDiscounts(orderID int) ([]models.AppliedDiscount, error) {
+	query := "SELECT discount_id, code, name, kind, amount, explanation FROM discount_redemptions WHERE order_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discounts := []models.AppliedDiscount{}
+	for rows.Next() {
+		var discount models.AppliedDiscount
+		err := rows.Scan(&discount.Discount_id, &discount.Code, &discount.Name, &discount.Kind, &discount.Amount, &discount.Explanation)
+		if err != nil {
+			return nil, err
+		}
+		discounts = append(discounts, discount)
+	}
+	return discounts, rows.Err()
+}
+
+// CreateDiscount serves POST /create/discounts. Leaving out the code makes
+// the discount an automatic promotion.
+func CreateDiscount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var discount models.Discount
+	err := helpers.ParseJSONRequestBody(r, &discount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if discount.Code != nil {
+		code := normalizeCouponCode(*discount.Code)
+		if !couponCodePattern.MatchString(code) {
+			http.Error(w, "Code must be 3 to 64 letters, digits, hyphens or underscores", http.StatusBadRequest)
+			return
+		}
+		discount.Code = &code
+	}
+
+	discount.Name = strings.TrimSpace(discount.Name)
+	if discount.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(discount.Name) > 255 {
+		http.Error(w, "Name must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	if discount.Currency != nil {
+		currency, err := money.NormalizeCurrency(*discount.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		discount.Currency = &currency
+	}
+
+	switch discount.Kind {
+	case pricing.Percentage:
+		if discount.Value < 1 || discount.Value > 100 {
+			http.Error(w, "Percentage discounts need a value from 1 to 100", http.StatusBadRequest)
+			return
+		}
+	case pricing.FixedAmount:
+		if discount.Value <= 0 || discount.Currency == nil {
+			http.Error(w, "Fixed amount discounts need a positive value and a currency", http.StatusBadRequest)
+			return
+		}
+	case pricing.FreeShipping:
+		discount.Value = 0
+	default:
+		http.Error(w, "Kind must be percentage, fixed_amount or free_shipping", http.StatusBadRequest)
+		return
+	}
+
+	if discount.Min_subtotal < 0 {
+		http.Error(w, "min_subtotal must not be negative", http.StatusBadRequest)
+		return
+	}
+	if discount.Min_subtotal > 0 && discount.Currency == nil {
+		http.Error(w, "A minimum order value needs a currency", http.StatusBadRequest)
+		return
+	}
+	if discount.Starts_at != nil && discount.Ends_at != nil && !discount.Ends_at.After(*discount.Starts_at) {
+		http.Error(w, "ends_at must be after starts_at", http.StatusBadRequest)
+		return
+	}
+	if (discount.Usage_limit != nil && *discount.Usage_limit <= 0) || (discount.Per_user_limit != nil && *discount.Per_user_limit <= 0) {
+		http.Error(w, "Usage limits must be positive", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, scope := range []struct {
+		ids         []int
+		table, name string
+	}{
+		{discount.Product_ids, "products", "product"},
+		{discount.Category_ids, "categories", "category"},
+	} {
+		if len(scope.ids) == 0 {
+			continue
+		}
+		placeholders, args := helpers.InPlaceholders(scope.ids)
+		found, err := scanIDs(tx.Query(fmt.Sprintf("SELECT id FROM %s WHERE id IN (%s) AND deleted_at IS NULL", scope.table, placeholders), args...))
+		if err != nil {
+			http.Error(w, "Failed to check discount scope", http.StatusInternalServerError)
+			fmt.Printf("Error checking %s: %v\n", scope.table, err)
+			return
+		}
+		for _, id := range scope.ids {
+			if !containsInt(found, id) {
+				http.Error(w, fmt.Sprintf("Unknown %s ID %d", scope.name, id), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var starts, ends interface{}
+	if discount.Starts_at != nil {
+		starts = discount.Starts_at.UTC()
+	}
+	if discount.Ends_at != nil {
+		ends = discount.Ends_at.UTC()
+	}
+
+	discount.Active = true
+	discount.Created_at = time.Now()
+	query := "INSERT INTO discounts (code, name, kind, value, currency, min_subtotal, starts_at, ends_at, usage_limit, per_user_limit, active, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, discount.Code, discount.Name, discount.Kind, discount.Value, discount.Currency, discount.Min_subtotal, starts, ends, discount.Usage_limit, discount.Per_user_limit, discount.Active, discount.Created_at)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "code", "A discount with this code already exists")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create discount", http.StatusInternalServerError)
+		fmt.Printf("Error inserting discount: %v\n", err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to create discount", http.StatusInternalServerError)
+		fmt.Printf("Error getting last insert ID: %v\n", err)
+		return
+	}
+	discount.ID = int(id)
+
+	for _, productID := range discount.Product_ids {
+		_, err = tx.Exec("INSERT IGNORE INTO discount_products (discount_id, product_id) VALUES (?, ?)", discount.ID, productID)
+		if err != nil {
+			break
+		}
+	}
+	for _, categoryID := range discount.Category_ids {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT IGNORE INTO discount_categories (discount_id, category_id) VALUES (?, ?)", discount.ID, categoryID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to create discount", http.StatusInternalServerError)
+		fmt.Printf("Error saving discount scope: %v\n", err)
+		return
+	}
+
+	if discount.Product_ids == nil {
+		discount.Product_ids = []int{}
+	}
+	if discount.Category_ids == nil {
+		discount.Category_ids = []int{}
+	}
+
+	response := map[string]interface{}{
+		"discount": discount,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// GetDiscounts lists every discount, newest first, with how often each has
+// been used.
+func GetDiscounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rows, err := database.DB.Query("SELECT " + discountColumns + " FROM discounts ORDER BY id DESC")
+	if err != nil {
+		http.Error(w, "Failed to fetch discounts", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	discounts := []models.Discount{}
+	for rows.Next() {
+		discount, err := scanDiscount(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan discount", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		discounts = append(discounts, discount)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	err = loadDiscountScopes(database.DB, discounts)
+	if err != nil {
+		http.Error(w, "Failed to fetch discount scopes", http.StatusInternalServerError)
+		fmt.Printf("Error fetching discount scopes: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"discounts": discounts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// Discount serves /discounts/{id}: GET shows the discount, DELETE
+// deactivates it. Discounts are never removed, since orders refer to them.
+func Discount(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/discounts/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid discount ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		discount, err := scanDiscount(database.DB.QueryRow("SELECT "+discountColumns+" FROM discounts WHERE id = ?", id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Discount not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch discount", http.StatusInternalServerError)
+			fmt.Printf("Error fetching discount: %v\n", err)
+			return
+		}
+
+		discounts := []models.Discount{discount}
+		err = loadDiscountScopes(database.DB, discounts)
+		if err != nil {
+			http.Error(w, "Failed to fetch discount scopes", http.StatusInternalServerError)
+			fmt.Printf("Error fetching discount scopes: %v\n", err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"discount": discounts[0],
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+		}
+
+	case http.MethodDelete:
+		result, err := database.DB.Exec("UPDATE discounts SET active = FALSE, updated_at = ? WHERE id = ?", time.Now(), id)
+		if err != nil {
+			http.Error(w, "Failed to deactivate discount", http.StatusInternalServerError)
+			fmt.Printf("Error deactivating discount: %v\n", err)
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to deactivate discount", http.StatusInternalServerError)
+			fmt.Printf("Error getting rows affected: %v\n", err)
+			return
+		}
+		if rowsAffected == 0 {
+			http.Error(w, "Discount not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Discount deactivated successfully")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
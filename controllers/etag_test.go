@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		ok       bool
+	}{
+		{"", nil, true},
+		{"*", nil, true},
+		{"  *  ", nil, true},
+		{`"3"`, []int{3}, true},
+		{`"3-1a2b3c4d5e6f7a8b"`, []int{3}, true},
+		{`"3-1a2b3c4d5e6f7a8b", "4-0000000000000000"`, []int{3, 4}, true},
+		{` "3" ,"5-ff" `, []int{3, 5}, true},
+		{`W/"3-1a2b3c4d5e6f7a8b"`, nil, false},
+		{`W/"3", "4"`, []int{4}, true},
+		{`3`, nil, false},
+		{`"3`, nil, false},
+		{`"`, nil, false},
+		{`""`, nil, false},
+		{`"abc-3"`, nil, false},
+		{`"-3"`, nil, false},
+		{`"x", "7-ab"`, []int{7}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/products/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			versions, ok := ifMatchVersions(r)
+			if !reflect.DeepEqual(versions, tt.versions) || ok != tt.ok {
+				t.Fatalf("ifMatchVersions(%q) = %v, %v; want %v, %v", tt.header, versions, ok, tt.versions, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIfMatchRoundTrip(t *testing.T) {
+	etag := versionETag(12, []byte(`{"product":{}}`))
+	r := httptest.NewRequest(http.MethodPut, "/products/1", nil)
+	r.Header.Set("If-Match", etag)
+	versions, ok := ifMatchVersions(r)
+	if !ok || !reflect.DeepEqual(versions, []int{12}) {
+		t.Fatalf("ETag %s read back as %v, %v", etag, versions, ok)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/products/1", nil)
+	r.Header.Set("If-Match", `W/"3"`)
+	w := httptest.NewRecorder()
+	if _, ok := checkIfMatch(w, r); ok || w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("ok %v, status %d; want 412", ok, w.Code)
+	}
+
+	r.Header.Set("If-Match", `"3"`)
+	w = httptest.NewRecorder()
+	if versions, ok := checkIfMatch(w, r); !ok || len(versions) != 1 || w.Body.Len() != 0 {
+		t.Fatalf("versions %v, ok %v, body %q", versions, ok, w.Body)
+	}
+}
+
+func TestVersionCondition(t *testing.T) {
+	if clause, args := versionCondition(nil); clause != "" || args != nil {
+		t.Fatalf("versionCondition(nil) = %q, %v", clause, args)
+	}
+	clause, args := versionCondition([]int{3, 4})
+	if clause != " AND version IN (?, ?)" || !reflect.DeepEqual(args, []interface{}{3, 4}) {
+		t.Fatalf("versionCondition = %q, %v", clause, args)
+	}
+}
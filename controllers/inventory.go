@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+// applyStockMovement changes a product's stock by delta inside tx and logs
+// the movement. The product row is locked first, so concurrent movements
+// on the same product are serialized. Stock never goes below zero. The
+// version is left alone, so a sale does not fail an editor's If-Match.
+func applyStockMovement(tx *sql.Tx, productID, userID int, movementType string, delta int, reason string) (int, error) {
+	var stock int
+	err := tx.QueryRow("SELECT stock FROM products WHERE id = ? FOR UPDATE", productID).Scan(&stock)
+	if err != nil {
+		return 0, err
+	}
+
+	newStock := stock + delta
+	if newStock < 0 {
+		return stock, errInsufficientStock
+	}
+
+	_, err = tx.Exec("UPDATE products SET stock = ? WHERE id = ?", newStock, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO stock_movements (product_id, type, quantity, stock_after, reason, user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(query, productID, movementType, delta, newStock, reason, userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newStock, nil
+}
+
+// applyVariantStockMovement is applyStockMovement for a variant of
+// productID, which keeps its own stock.
+func applyVariantStockMovement(tx *sql.Tx, productID, variantID, userID int, movementType string, delta int, reason string) (int, error) {
+	var stock int
+	err := tx.QueryRow("SELECT stock FROM product_variants WHERE id = ? AND product_id = ? FOR UPDATE", variantID, productID).Scan(&stock)
+	if err != nil {
+		return 0, err
+	}
+
+	newStock := stock + delta
+	if newStock < 0 {
+		return stock, errInsufficientStock
+	}
+
+	_, err = tx.Exec("UPDATE product_variants SET stock = ?, updated_at = ? WHERE id = ?", newStock, time.Now(), variantID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO stock_movements (product_id, variant_id, type, quantity, stock_after, reason, user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(query, productID, variantID, movementType, delta, newStock, reason, userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return newStock, nil
+}
+
+// ProductStock serves /stock/products/{id}: GET lists the product's stock
+// movements, POST records a new one.
+func ProductStock(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetStockMovements(w, r)
+	case http.MethodPost:
+		AdjustStock(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func AdjustStock(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/stock/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var movement models.StockMovement
+	err = helpers.ParseJSONRequestBody(r, &movement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	// Restocks and sales are given as positive amounts; adjustments carry
+	// their own sign
+	delta := movement.Quantity
+	switch movement.Type {
+	case "restock":
+		if delta <= 0 {
+			http.Error(w, "Restock quantity must be positive", http.StatusBadRequest)
+			return
+		}
+	case "sale":
+		if delta <= 0 {
+			http.Error(w, "Sale quantity must be positive", http.StatusBadRequest)
+			return
+		}
+		delta = -delta
+	case "adjustment":
+		if delta == 0 {
+			http.Error(w, "Adjustment quantity must not be zero", http.StatusBadRequest)
+			return
+		}
+		if movement.Reason == "" {
+			http.Error(w, "Adjustments require a reason", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Type must be restock, sale or adjustment", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = checkProductRole(tx, productID, userID, models.ShopEditor, false)
+	if err != nil {
+		writeProductError(w, err, "Failed to fetch product")
+		return
+	}
+
+	newStock, err := applyStockMovement(tx, productID, userID, movement.Type, delta, movement.Reason)
+	if err == errInsufficientStock {
+		http.Error(w, fmt.Sprintf("Insufficient stock: only %d available", newStock), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		fmt.Printf("Error adjusting stock: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"product_id": productID,
+		"stock":      newStock,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func GetStockMovements(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/stock/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	query := "SELECT id, product_id, variant_id, type, quantity, stock_after, reason, user_id, created_at FROM stock_movements WHERE product_id = ? ORDER BY id DESC"
+	rows, err := database.DB.Query(query, productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock movements", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+
+	for rows.Next() {
+		var movement models.StockMovement
+		var createdAt []byte
+
+		err := rows.Scan(&movement.ID, &movement.Product_id, &movement.Variant_id, &movement.Type, &movement.Quantity, &movement.Stock_after, &movement.Reason, &movement.User_id, &createdAt)
+		if err != nil {
+			http.Error(w, "Failed to scan stock movement", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+
+		movement.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			http.Error(w, "Failed to parse created_at", http.StatusInternalServerError)
+			fmt.Printf("Error parsing created_at: %v\n", err)
+			return
+		}
+
+		movements = append(movements, movement)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"movements": movements,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode stock movements to JSON", http.StatusInternalServerError)
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return
+	}
+}
+
+// GetLowStockReport lists the caller's products, or with ?shop_id= a
+// shop's, whose stock is at or below their low-stock threshold, emptiest
+// first.
+func GetLowStockReport(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	c, ok := requestCatalog(w, r, userID, models.ShopEditor)
+	if !ok {
+		return
+	}
+
+	condition, args := c.condition("")
+	query := "SELECT id, name, price, user_id, shop_id, category_id, stock, low_stock_threshold FROM products WHERE " + condition + " AND deleted_at IS NULL AND stock <= low_stock_threshold ORDER BY stock ASC, id ASC"
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch low-stock products", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+
+	for rows.Next() {
+		var product models.Product
+		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.User_id, &product.Shop_id, &product.Category_id, &product.Stock, &product.Low_stock_threshold)
+		if err != nil {
+			http.Error(w, "Failed to scan product", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"products": products,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode products to JSON", http.StatusInternalServerError)
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return
+	}
+}
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"encoding/json"
 	"fmt"
 	"loginApi/database"
 	"loginApi/helpers"
 	"loginApi/models"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -55,3 +58,136 @@ func CreateMessage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	fmt.Fprintf(w, "Message created successfully with ID: %d", id)
 }
+
+// GetMessages serves GET /messages for administrators, newest first. Pass
+// ?include_deleted=true to include trashed messages.
+func GetMessages(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT id, name, email, phone_number, subject, message, created_at, updated_at, deleted_at FROM messages WHERE deleted_at IS NULL ORDER BY id DESC"
+	if r.URL.Query().Get("include_deleted") == "true" {
+		query = "SELECT id, name, email, phone_number, subject, message, created_at, updated_at, deleted_at FROM messages ORDER BY id DESC"
+	}
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		var message models.Message
+		var createdAt, updatedAt, deletedAt []byte
+
+		err := rows.Scan(&message.ID, &message.Name, &message.Email, &message.PhoneNumber, &message.Subject, &message.Message, &createdAt, &updatedAt, &deletedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan message", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+
+		message.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err == nil {
+			message.Updated_at, err = helpers.ParseDatetime(updatedAt)
+		}
+		if err == nil {
+			message.Deleted_at, err = helpers.ParseNullableDatetime(deletedAt)
+		}
+		if err != nil {
+			http.Error(w, "Failed to parse message dates", http.StatusInternalServerError)
+			fmt.Printf("Error parsing message dates: %v\n", err)
+			return
+		}
+
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// DeleteMessage serves DELETE /messages/{id} for administrators, moving the
+// message to the trash.
+func DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/messages/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	result, err := database.DB.Exec("UPDATE messages SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now(), id)
+	if err != nil {
+		http.Error(w, "Failed to delete message", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to check affected rows", http.StatusInternalServerError)
+		fmt.Printf("Error checking affected rows: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Message deleted successfully")
+}
+
+// RestoreMessage serves POST /restore/messages/{id} for administrators.
+func RestoreMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/restore/messages/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	result, err := database.DB.Exec("UPDATE messages SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		http.Error(w, "Failed to restore message", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to check affected rows", http.StatusInternalServerError)
+		fmt.Printf("Error checking affected rows: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Message not found in trash", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Message restored successfully")
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"loginApi/config"
+	"loginApi/models"
+	"loginApi/money"
+	"math/big"
+	"net/http"
+)
+
+// requestedDisplay reads the ?currency= and ?locale= parameters. An empty
+// currency means prices are returned as stored. The locale falls back to
+// Accept-Language and then to the configured default.
+func requestedDisplay(r *http.Request) (string, string, error) {
+	currency := r.URL.Query().Get("currency")
+	if currency != "" {
+		var err error
+		currency, err = money.NormalizeCurrency(currency)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		locale = money.MatchLocale(r.Header.Get("Accept-Language"), config.App.Money.DefaultLocale)
+	}
+
+	return currency, locale, nil
+}
+
+// convertProductPrice fills product.Converted_price with its price in
+// currency, formatted for locale.
+func convertProductPrice(product *models.Product, currency, locale string) error {
+	var err error
+	product.Converted_price, err = convertPrice(int64(product.Price), product.Currency, currency, locale, money.Rates)
+	return err
+}
+
+// convertProductDetailPrices converts the product's price and each
+// variant's effective price. The rate is looked up once, so the variants
+// are never priced at a different rate than the product.
+func convertProductDetailPrices(product *models.ProductDetail, currency, locale string) error {
+	var rates money.RateProvider = money.Rates
+	if product.Currency != currency {
+		rate, err := money.Rates.Rate(product.Currency, currency)
+		if err != nil {
+			return err
+		}
+		rates = fixedRate{rate}
+	}
+
+	var err error
+	product.Converted_price, err = convertPrice(int64(product.Price), product.Currency, currency, locale, rates)
+	if err != nil {
+		return err
+	}
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		variant.Converted_price, err = convertPrice(int64(variant.Effective_price), product.Currency, currency, locale, rates)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertPrice(amount int64, from, currency, locale string, rates money.RateProvider) (*models.PriceView, error) {
+	converted, err := money.Convert(money.Money{Amount: amount, Currency: from}, currency, rates)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PriceView{
+		Amount:    converted.Amount,
+		Currency:  converted.Currency,
+		Formatted: money.Format(converted, locale),
+	}, nil
+}
+
+// fixedRate answers every lookup with one rate already fetched.
+type fixedRate struct {
+	rate *big.Rat
+}
+
+func (f fixedRate) Rate(from, to string) (*big.Rat, error) {
+	return f.rate, nil
+}
+
+// writeConversionError reports a failed price conversion. Missing rates are
+// a temporary server-side condition, not a client mistake.
+func writeConversionError(w http.ResponseWriter, currency string, err error) {
+	fmt.Printf("Error converting price: %v\n", err)
+	if errors.Is(err, money.ErrRateUnavailable) {
+		http.Error(w, fmt.Sprintf("No exchange rate available for %s", currency), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, "Failed to convert price", http.StatusInternalServerError)
+}
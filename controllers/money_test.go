@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"loginApi/models"
+	"loginApi/money"
+	"math/big"
+	"testing"
+)
+
+// changingRates doubles its rate on every lookup, as a rates file reloaded
+// mid-request might.
+type changingRates struct {
+	lookups int
+	err     error
+}
+
+func (c *changingRates) Rate(from, to string) (*big.Rat, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.lookups++
+	return big.NewRat(int64(c.lookups), 2), nil
+}
+
+func TestConvertProductDetailPrices(t *testing.T) {
+	rates := &changingRates{}
+	previous := money.Rates
+	money.Rates = rates
+	t.Cleanup(func() { money.Rates = previous })
+
+	price := 3000
+	product := models.ProductDetail{
+		Product: models.Product{Price: 2000, Currency: "USD"},
+		Variants: []models.ProductVariant{
+			{ID: 1, Effective_price: 2000},
+			{ID: 2, Price: &price, Effective_price: price},
+		},
+	}
+
+	err := convertProductDetailPrices(&product, "EUR", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.lookups != 1 {
+		t.Fatalf("%d rate lookups, want 1", rates.lookups)
+	}
+	if got := product.Converted_price; got == nil || got.Amount != 1000 || got.Currency != "EUR" {
+		t.Fatalf("product converted to %+v", got)
+	}
+	for i, want := range []int64{1000, 1500} {
+		if got := product.Variants[i].Converted_price; got == nil || got.Amount != want || got.Currency != "EUR" {
+			t.Errorf("variant %d converted to %+v, want %d EUR", i, got, want)
+		}
+	}
+
+	// The stored currency needs no rate
+	product.Variants[0].Converted_price = nil
+	if err := convertProductDetailPrices(&product, "USD", "en"); err != nil || rates.lookups != 1 || product.Variants[0].Converted_price.Amount != 2000 {
+		t.Fatalf("same currency: err %v, lookups %d, %+v", err, rates.lookups, product.Variants[0].Converted_price)
+	}
+
+	rates.err = money.ErrRateUnavailable
+	if err := convertProductDetailPrices(&product, "JPY", "en"); !errors.Is(err, money.ErrRateUnavailable) {
+		t.Fatalf("missing rate: %v", err)
+	}
+}
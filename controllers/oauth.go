@@ -0,0 +1,623 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oauthCodeTTL        = 10 * time.Minute
+	oauthAccessTokenTTL = time.Hour
+)
+
+var errInvalidClient = errors.New("invalid client credentials")
+
+// authorizeRequest holds the parameters of an authorization request, shared
+// by the consent screen (GET) and the user's decision (POST).
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+func RegisterOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Context().Value("clientID") != nil {
+		http.Error(w, "Third-party tokens cannot register clients", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var client models.OAuthClient
+	err := helpers.ParseJSONRequestBody(r, &client)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if client.Name == "" || len(client.RedirectURIs) == 0 {
+		http.Error(w, "Name and redirect_uris are required", http.StatusBadRequest)
+		return
+	}
+
+	for _, uri := range client.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			http.Error(w, fmt.Sprintf("Invalid redirect URI: %s", uri), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(client.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range client.Scopes {
+		if _, ok := utils.OAuthScopes[scope]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown scope: %s", scope), http.StatusBadRequest)
+			return
+		}
+	}
+
+	client.ClientID, err = utils.GenerateRandomToken(16)
+	if err != nil {
+		http.Error(w, "Failed to generate client ID", http.StatusInternalServerError)
+		return
+	}
+
+	// Only confidential clients get a secret; public clients rely on PKCE.
+	var secretHash sql.NullString
+	if client.Confidential {
+		client.ClientSecret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			http.Error(w, "Failed to generate client secret", http.StatusInternalServerError)
+			return
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(client.ClientSecret), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Failed to hash client secret", http.StatusInternalServerError)
+			fmt.Printf("Error hashing client secret: %v\n", err)
+			return
+		}
+		secretHash = sql.NullString{String: string(hashed), Valid: true}
+	} else {
+		client.ClientSecret = ""
+	}
+
+	client.User_id = userID
+	client.Created_at = time.Now()
+
+	query := "INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, scopes, confidential, user_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := database.DB.Exec(query, client.ClientID, secretHash, client.Name, strings.Join(client.RedirectURIs, "\n"), strings.Join(client.Scopes, " "), client.Confidential, client.User_id, client.Created_at)
+	if err != nil {
+		http.Error(w, "Failed to register client", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+	client.ID = int(id)
+
+	// The secret is only ever returned here; we keep just its hash.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"client": client})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// OAuthAuthorize is the consent screen. GET describes the client and the
+// requested scopes; POST records the logged-in user's decision and returns
+// the redirect URI carrying the authorization code.
+func OAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	// Consent must come from the user's own session, never from another client.
+	if r.Context().Value("clientID") != nil {
+		http.Error(w, "Third-party tokens cannot grant consent", http.StatusForbidden)
+		return
+	}
+
+	var req authorizeRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req = authorizeRequest{
+			ResponseType:        q.Get("response_type"),
+			ClientID:            q.Get("client_id"),
+			RedirectURI:         q.Get("redirect_uri"),
+			Scope:               q.Get("scope"),
+			State:               q.Get("state"),
+			CodeChallenge:       q.Get("code_challenge"),
+			CodeChallengeMethod: q.Get("code_challenge_method"),
+		}
+	case http.MethodPost:
+		err := helpers.ParseJSONRequestBody(r, &req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			fmt.Printf("Error parsing JSON: %v\n", err)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client, _, err := loadOAuthClient(req.ClientID)
+	if err == sql.ErrNoRows {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Unknown client_id")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
+		fmt.Printf("Error fetching client: %v\n", err)
+		return
+	}
+
+	// An omitted redirect_uri is only acceptable when there is no ambiguity.
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !containsString(client.RedirectURIs, req.RedirectURI) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+		return
+	}
+
+	if req.ResponseType != "code" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_response_type", "Only response_type=code is supported")
+		return
+	}
+
+	scopes := utils.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !utils.ScopeSubset(scopes, client.Scopes) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the client's registered scopes")
+		return
+	}
+
+	if req.CodeChallenge == "" && !client.Confidential {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "code_challenge is required for public clients")
+		return
+	}
+	if req.CodeChallenge != "" {
+		if req.CodeChallengeMethod == "" {
+			req.CodeChallengeMethod = "plain"
+		}
+		if req.CodeChallengeMethod != "S256" && req.CodeChallengeMethod != "plain" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Unsupported code_challenge_method")
+			return
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		requested := make([]map[string]string, 0, len(scopes))
+		for _, scope := range scopes {
+			requested = append(requested, map[string]string{"scope": scope, "description": utils.OAuthScopes[scope]})
+		}
+
+		response := map[string]interface{}{
+			"client": map[string]interface{}{
+				"client_id": client.ClientID,
+				"name":      client.Name,
+			},
+			"scopes":       requested,
+			"redirect_uri": req.RedirectURI,
+			"state":        req.State,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		writeAuthorizeRedirect(w, req.RedirectURI, params)
+		return
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate authorization code", http.StatusInternalServerError)
+		return
+	}
+
+	authCode := models.OAuthAuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            client.ClientID,
+		User_id:             userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               strings.Join(scopes, " "),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Expires_at:          time.Now().Add(oauthCodeTTL),
+	}
+
+	query := "INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = database.DB.Exec(query, authCode.CodeHash, authCode.ClientID, authCode.User_id, authCode.RedirectURI, authCode.Scope, authCode.CodeChallenge, authCode.CodeChallengeMethod, authCode.Expires_at)
+	if err != nil {
+		http.Error(w, "Failed to store authorization code", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	params.Set("code", code)
+	writeAuthorizeRedirect(w, req.RedirectURI, params)
+}
+
+func OAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	client, err := authenticateOAuthClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	var userID int
+	var scope string
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		if code == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "code is required")
+			return
+		}
+
+		var authCode models.OAuthAuthorizationCode
+		var expiresAt []byte
+		var used bool
+		query := "SELECT code_hash, client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, expires_at, used FROM oauth_authorization_codes WHERE code_hash = ?"
+		err = database.DB.QueryRow(query, utils.HashToken(code)).Scan(&authCode.CodeHash, &authCode.ClientID, &authCode.User_id, &authCode.RedirectURI, &authCode.Scope, &authCode.CodeChallenge, &authCode.CodeChallengeMethod, &expiresAt, &used)
+		if err == sql.ErrNoRows {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Unknown authorization code")
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch authorization code", http.StatusInternalServerError)
+			fmt.Printf("Error fetching authorization code: %v\n", err)
+			return
+		}
+
+		authCode.Expires_at, err = helpers.ParseDatetime(expiresAt)
+		if err != nil {
+			http.Error(w, "Failed to parse expires_at", http.StatusInternalServerError)
+			fmt.Printf("Error parsing expires_at: %v\n", err)
+			return
+		}
+
+		if used || time.Now().After(authCode.Expires_at) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is expired or already used")
+			return
+		}
+		if authCode.ClientID != client.ClientID {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client")
+			return
+		}
+		if r.PostForm.Get("redirect_uri") != authCode.RedirectURI {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+			return
+		}
+		if authCode.CodeChallenge != "" && !utils.VerifyPKCE(r.PostForm.Get("code_verifier"), authCode.CodeChallenge, authCode.CodeChallengeMethod) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+			return
+		}
+
+		// Mark the code used atomically so a replayed code cannot win a race.
+		result, err := database.DB.Exec("UPDATE oauth_authorization_codes SET used = 1 WHERE code_hash = ? AND used = 0", authCode.CodeHash)
+		if err != nil {
+			http.Error(w, "Failed to redeem authorization code", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, "Failed to check affected rows", http.StatusInternalServerError)
+			fmt.Printf("Error checking affected rows: %v\n", err)
+			return
+		}
+		if rowsAffected == 0 {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is expired or already used")
+			return
+		}
+
+		userID = authCode.User_id
+		scope = authCode.Scope
+
+	case "client_credentials":
+		if !client.Confidential {
+			writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use client_credentials")
+			return
+		}
+
+		scopes := utils.ParseScope(r.PostForm.Get("scope"))
+		if len(scopes) == 0 {
+			scopes = client.Scopes
+		}
+		if !utils.ScopeSubset(scopes, client.Scopes) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the client's registered scopes")
+			return
+		}
+		scope = strings.Join(scopes, " ")
+
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Supported grant types are authorization_code and client_credentials")
+		return
+	}
+
+	accessToken, _, err := utils.GenerateAccessToken(userID, client.ClientID, scope, oauthAccessTokenTTL)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		fmt.Printf("Error generating access token: %v\n", err)
+		return
+	}
+
+	response := models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(oauthAccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// OAuthIntrospect implements RFC 7662 token introspection for registered clients.
+func OAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	_, err = authenticateOAuthClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	response := models.OAuthIntrospectionResponse{Active: false}
+
+	_, claims, err := utils.ParseJWT(r.PostForm.Get("token"))
+	if err == nil && claims.ClientID != "" {
+		revoked, err := utils.IsTokenRevoked(claims.Id)
+		if err != nil {
+			http.Error(w, "Failed to check token revocation", http.StatusInternalServerError)
+			fmt.Printf("Error checking token revocation: %v\n", err)
+			return
+		}
+		if !revoked {
+			response = models.OAuthIntrospectionResponse{
+				Active:    true,
+				Scope:     claims.Scope,
+				ClientID:  claims.ClientID,
+				Sub:       claims.Subject,
+				Exp:       claims.ExpiresAt,
+				Iat:       claims.IssuedAt,
+				Jti:       claims.Id,
+				TokenType: "Bearer",
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// OAuthRevoke implements RFC 7009 token revocation. Unknown or already
+// invalid tokens are reported as success, as the RFC requires.
+func OAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	client, err := authenticateOAuthClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+
+	_, claims, err := utils.ParseJWT(r.PostForm.Get("token"))
+	if err != nil || claims.ClientID == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if claims.ClientID != client.ClientID {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Token was issued to another client")
+		return
+	}
+
+	err = utils.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		fmt.Printf("Error revoking token: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// loadOAuthClient fetches a registered client and its secret hash.
+func loadOAuthClient(clientID string) (*models.OAuthClient, string, error) {
+	var client models.OAuthClient
+	var secretHash sql.NullString
+	var redirectURIs, scopes string
+	var createdAt []byte
+
+	query := "SELECT id, client_id, client_secret_hash, name, redirect_uris, scopes, confidential, user_id, created_at FROM oauth_clients WHERE client_id = ?"
+	err := database.DB.QueryRow(query, clientID).Scan(&client.ID, &client.ClientID, &secretHash, &client.Name, &redirectURIs, &scopes, &client.Confidential, &client.User_id, &createdAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client.RedirectURIs = strings.Split(redirectURIs, "\n")
+	client.Scopes = utils.ParseScope(scopes)
+	client.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &client, secretHash.String, nil
+}
+
+// authenticateOAuthClient identifies the calling client from HTTP Basic
+// credentials or client_id/client_secret form fields. Public clients only
+// present their client_id.
+func authenticateOAuthClient(r *http.Request) (*models.OAuthClient, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// Basic credentials are form-urlencoded before base64 (RFC 6749 2.3.1).
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+
+	client, secretHash, err := loadOAuthClient(clientID)
+	if err == sql.ErrNoRows {
+		return nil, errInvalidClient
+	} else if err != nil {
+		fmt.Printf("Error fetching client: %v\n", err)
+		return nil, errors.New("failed to fetch client")
+	}
+
+	if client.Confidential {
+		if clientSecret == "" || bcrypt.CompareHashAndPassword([]byte(secretHash), []byte(clientSecret)) != nil {
+			return nil, errInvalidClient
+		}
+	}
+
+	return client, nil
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// writeAuthorizeRedirect returns the URI the user agent should be sent to.
+// The API is called with a bearer token from the frontend, so it hands the
+// URI back as JSON instead of issuing a 302.
+func writeAuthorizeRedirect(w http.ResponseWriter, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI", http.StatusInternalServerError)
+		return
+	}
+	q := target.Query()
+	for key := range params {
+		q.Set(key, params.Get(key))
+	}
+	target.RawQuery = q.Encode()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]string{"redirect_uri": target.String()})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"loginApi/database/dbtest"
+	"loginApi/models"
+	"loginApi/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeOAuthClient is a third-party application registered with the API. It
+// drives the endpoints the way a real client would, against an in-memory
+// copy of the OAuth tables.
+type fakeOAuthClient struct {
+	t            *testing.T
+	id           string
+	secret       string
+	redirectURI  string
+	confidential bool
+}
+
+type oauthTables struct {
+	mu      sync.Mutex
+	clients map[string]fakeOAuthClient
+	codes   map[string][]driver.Value
+	used    map[string]bool
+	revoked map[string]bool
+}
+
+const oauthTestScopes = "profile orders"
+
+func useOAuthTables(t *testing.T) *oauthTables {
+	stub := dbtest.Use(t)
+	tables := &oauthTables{
+		clients: map[string]fakeOAuthClient{},
+		codes:   map[string][]driver.Value{},
+		used:    map[string]bool{},
+		revoked: map[string]bool{},
+	}
+
+	clientColumns := []string{"id", "client_id", "client_secret_hash", "name", "redirect_uris", "scopes", "confidential", "user_id", "created_at"}
+	stub.On(`FROM oauth_clients WHERE client_id = \?`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		client, ok := tables.clients[args[0].(string)]
+		if !ok {
+			return dbtest.Rows(clientColumns), nil
+		}
+		var secretHash driver.Value
+		if client.confidential {
+			hash, err := bcrypt.GenerateFromPassword([]byte(client.secret), bcrypt.MinCost)
+			if err != nil {
+				return dbtest.Result{}, err
+			}
+			secretHash = hash
+		}
+		return dbtest.Rows(clientColumns, []driver.Value{1, client.id, secretHash, "Fake client", client.redirectURI, oauthTestScopes, client.confidential, 1, "2024-01-01 00:00:00"}), nil
+	})
+
+	stub.On(`^INSERT INTO oauth_authorization_codes`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		tables.codes[args[0].(string)] = args
+		return dbtest.Result{Affected: 1}, nil
+	})
+
+	codeColumns := []string{"code_hash", "client_id", "user_id", "redirect_uri", "scope", "code_challenge", "code_challenge_method", "expires_at", "used"}
+	stub.On(`FROM oauth_authorization_codes WHERE code_hash = \?`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		code, ok := tables.codes[args[0].(string)]
+		if !ok {
+			return dbtest.Rows(codeColumns), nil
+		}
+		expiresAt := code[7].(time.Time).UTC().Format("2006-01-02 15:04:05")
+		return dbtest.Rows(codeColumns, []driver.Value{code[0], code[1], code[2], code[3], code[4], code[5], code[6], expiresAt, tables.used[code[0].(string)]}), nil
+	})
+
+	stub.On(`^UPDATE oauth_authorization_codes SET used = 1`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		hash := args[0].(string)
+		if tables.used[hash] {
+			return dbtest.Result{}, nil
+		}
+		tables.used[hash] = true
+		return dbtest.Result{Affected: 1}, nil
+	})
+
+	stub.On(`FROM oauth_revoked_tokens WHERE jti = \?`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		return dbtest.Rows([]string{"revoked"}, []driver.Value{tables.revoked[args[0].(string)]}), nil
+	})
+
+	stub.On(`^INSERT IGNORE INTO oauth_revoked_tokens`, func(args []driver.Value) (dbtest.Result, error) {
+		tables.mu.Lock()
+		defer tables.mu.Unlock()
+		tables.revoked[args[0].(string)] = true
+		return dbtest.Result{Affected: 1}, nil
+	})
+
+	return tables
+}
+
+func (tables *oauthTables) register(t *testing.T, id string, confidential bool) fakeOAuthClient {
+	client := fakeOAuthClient{t: t, id: id, redirectURI: "https://client.example/callback", confidential: confidential}
+	if confidential {
+		client.secret = id + "-secret"
+	}
+	tables.mu.Lock()
+	tables.clients[id] = client
+	tables.mu.Unlock()
+	return client
+}
+
+// authorize has userID approve the client and returns the code from the
+// redirect.
+func (c fakeOAuthClient) authorize(userID int, challenge string) string {
+	c.t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{
+		"response_type":         "code",
+		"client_id":             c.id,
+		"redirect_uri":          c.redirectURI,
+		"scope":                 "profile",
+		"state":                 "xyz",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+		"approve":               true,
+	})
+	r := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(string(body)))
+	r.Header.Set("Content-Type", "application/json")
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	OAuthAuthorize(w, r)
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("authorize: status %d: %s", w.Code, w.Body)
+	}
+
+	var response map[string]string
+	json.NewDecoder(w.Body).Decode(&response)
+	target, err := url.Parse(response["redirect_uri"])
+	if err != nil {
+		c.t.Fatalf("authorize: bad redirect_uri %q", response["redirect_uri"])
+	}
+	if got := target.Query().Get("state"); got != "xyz" {
+		c.t.Fatalf("authorize: state = %q, want xyz", got)
+	}
+	return target.Query().Get("code")
+}
+
+func (c fakeOAuthClient) post(handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	if !c.confidential {
+		form.Set("client_id", c.id)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/oauth", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.confidential {
+		r.SetBasicAuth(c.id, c.secret)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func (c fakeOAuthClient) token(form url.Values) (models.OAuthTokenResponse, *httptest.ResponseRecorder) {
+	w := c.post(OAuthToken, form)
+	var response models.OAuthTokenResponse
+	if w.Code == http.StatusOK {
+		json.Unmarshal(w.Body.Bytes(), &response)
+	}
+	return response, w
+}
+
+func (c fakeOAuthClient) introspect(token string) models.OAuthIntrospectionResponse {
+	c.t.Helper()
+	w := c.post(OAuthIntrospect, url.Values{"token": {token}})
+	if w.Code != http.StatusOK {
+		c.t.Fatalf("introspect: status %d: %s", w.Code, w.Body)
+	}
+	var response models.OAuthIntrospectionResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response
+}
+
+func oauthErrorCode(w *httptest.ResponseRecorder) string {
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response["error"]
+}
+
+func TestOAuthAuthorizationCodeWithPKCE(t *testing.T) {
+	tables := useOAuthTables(t)
+	client := tables.register(t, "spa", false)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	code := client.authorize(42, utils.PKCEChallenge(verifier))
+	if code == "" {
+		t.Fatal("authorize returned no code")
+	}
+
+	exchange := func(code, verifier string) (models.OAuthTokenResponse, *httptest.ResponseRecorder) {
+		return client.token(url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {client.redirectURI},
+			"code_verifier": {verifier},
+		})
+	}
+
+	if _, w := exchange(code, "wrong-verifier"); w.Code != http.StatusBadRequest || oauthErrorCode(w) != "invalid_grant" {
+		t.Fatalf("wrong verifier: status %d, error %q", w.Code, oauthErrorCode(w))
+	}
+
+	token, w := exchange(code, verifier)
+	if w.Code != http.StatusOK {
+		t.Fatalf("exchange: status %d: %s", w.Code, w.Body)
+	}
+	if token.Scope != "profile" || token.TokenType != "Bearer" {
+		t.Fatalf("exchange: got %+v", token)
+	}
+
+	_, claims, err := utils.ParseJWT(token.AccessToken)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	if claims.Subject != "42" || claims.ClientID != "spa" {
+		t.Fatalf("access token: sub %q client_id %q", claims.Subject, claims.ClientID)
+	}
+
+	if _, w := exchange(code, verifier); w.Code != http.StatusBadRequest || oauthErrorCode(w) != "invalid_grant" {
+		t.Fatalf("replayed code: status %d, error %q", w.Code, oauthErrorCode(w))
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	tables := useOAuthTables(t)
+	service := tables.register(t, "service", true)
+	spa := tables.register(t, "spa", false)
+
+	token, w := service.token(url.Values{"grant_type": {"client_credentials"}, "scope": {"orders"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("client_credentials: status %d: %s", w.Code, w.Body)
+	}
+
+	introspection := service.introspect(token.AccessToken)
+	if !introspection.Active || introspection.ClientID != "service" || introspection.Sub != "" || introspection.Scope != "orders" {
+		t.Fatalf("introspect: got %+v", introspection)
+	}
+
+	tests := []struct {
+		name   string
+		client fakeOAuthClient
+		form   url.Values
+		status int
+		error  string
+	}{
+		{"public client", spa, url.Values{"grant_type": {"client_credentials"}}, http.StatusBadRequest, "unauthorized_client"},
+		{"scope not registered", service, url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}}, http.StatusBadRequest, "invalid_scope"},
+		{"wrong secret", fakeOAuthClient{t: t, id: "service", secret: "guess", confidential: true}, url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", fakeOAuthClient{t: t, id: "nobody", secret: "x", confidential: true}, url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		{"unsupported grant", service, url.Values{"grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, w := tt.client.token(tt.form)
+			if w.Code != tt.status || oauthErrorCode(w) != tt.error {
+				t.Fatalf("status %d, error %q; want %d, %q", w.Code, oauthErrorCode(w), tt.status, tt.error)
+			}
+		})
+	}
+}
+
+func TestOAuthRevoke(t *testing.T) {
+	tables := useOAuthTables(t)
+	service := tables.register(t, "service", true)
+	other := tables.register(t, "other", true)
+
+	token, w := service.token(url.Values{"grant_type": {"client_credentials"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("client_credentials: status %d: %s", w.Code, w.Body)
+	}
+
+	if w := other.post(OAuthRevoke, url.Values{"token": {token.AccessToken}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("revoke by another client: status %d", w.Code)
+	}
+	if !service.introspect(token.AccessToken).Active {
+		t.Fatal("token inactive after a rejected revocation")
+	}
+
+	if w := service.post(OAuthRevoke, url.Values{"token": {token.AccessToken}}); w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d", w.Code)
+	}
+	if service.introspect(token.AccessToken).Active {
+		t.Fatal("token still active after revocation")
+	}
+
+	if w := service.post(OAuthRevoke, url.Values{"token": {"not-a-token"}}); w.Code != http.StatusOK {
+		t.Fatalf("revoke of garbage: status %d, want 200", w.Code)
+	}
+}
+
+func TestCallerIsAdminIgnoresAccessTokens(t *testing.T) {
+	stub := dbtest.Use(t)
+	stub.On(`SELECT COALESCE\(MAX\(is_admin\), 0\) FROM users`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Rows([]string{"admin"}, []driver.Value{true}), nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/orders/5", nil)
+	admin, err := callerIsAdmin(r, 7)
+	if err != nil || !admin {
+		t.Fatalf("first-party login: admin = %v, %v; want true", admin, err)
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), "clientID", "client-1"))
+	admin, err = callerIsAdmin(r, 7)
+	if err != nil || admin {
+		t.Fatalf("OAuth2 access token: admin = %v, %v; want false", admin, err)
+	}
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/oidc"
+	"loginApi/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie holds the hash of the login state in the browser that
+// started the flow, so a callback is only completed where it began.
+const oidcStateCookie = "oidc_state"
+
+// OIDCLogin starts an authorization code flow with the identity provider
+// named in the URL and redirects the browser to it. Expired login states
+// are cleaned up on the way.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	providerName := strings.TrimPrefix(r.URL.Path, "/oidc/login/")
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		http.Error(w, "Failed to generate nonce", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := utils.GenerateRandomToken(48)
+	if err != nil {
+		http.Error(w, "Failed to generate code verifier", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, utils.PKCEChallenge(codeVerifier))
+	if err != nil {
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		fmt.Printf("Error building authorization URL for %s: %v\n", providerName, err)
+		return
+	}
+
+	_, err = database.DB.Exec("DELETE FROM oidc_login_states WHERE expires_at < ?", time.Now())
+	if err != nil {
+		fmt.Printf("Error deleting expired login states: %v\n", err)
+	}
+
+	stateHash := utils.HashToken(state)
+	query := "INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at) VALUES (?, ?, ?, ?, ?)"
+	_, err = database.DB.Exec(query, stateHash, providerName, nonce, codeVerifier, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		http.Error(w, "Failed to store login state", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash,
+		Path:     "/oidc/callback/",
+		MaxAge:   int(oidcStateTTL / time.Second),
+		Secure:   strings.HasPrefix(provider.Config.RedirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback completes the flow: it checks state against the stored
+// one and the browser's state cookie, redeems the code, verifies the ID
+// token and signs the linked local user in.
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	providerName := strings.TrimPrefix(r.URL.Path, "/oidc/callback/")
+	provider, err := oidc.GetProvider(providerName)
+	if err != nil {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		http.Error(w, fmt.Sprintf("Login was not completed: %s", errCode), http.StatusUnauthorized)
+		return
+	}
+
+	state := q.Get("state")
+	code := q.Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "Missing state or code", http.StatusBadRequest)
+		return
+	}
+
+	// A state started in another browser would sign this one in as
+	// whoever started it
+	stateHash := utils.HashToken(state)
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		http.Error(w, "Login was started in another browser", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oidc/callback/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+
+	var storedProvider, nonce, codeVerifier string
+	var expiresAt []byte
+	query := "SELECT provider, nonce, code_verifier, expires_at FROM oidc_login_states WHERE state_hash = ?"
+	err = database.DB.QueryRow(query, stateHash).Scan(&storedProvider, &nonce, &codeVerifier, &expiresAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch login state", http.StatusInternalServerError)
+		fmt.Printf("Error fetching login state: %v\n", err)
+		return
+	}
+
+	// States are single use; deleting first stops a replayed callback
+	result, err := database.DB.Exec("DELETE FROM oidc_login_states WHERE state_hash = ?", stateHash)
+	if err != nil {
+		http.Error(w, "Failed to consume login state", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	expires, err := helpers.ParseDatetime(expiresAt)
+	if err != nil {
+		http.Error(w, "Failed to parse expires_at", http.StatusInternalServerError)
+		fmt.Printf("Error parsing expires_at: %v\n", err)
+		return
+	}
+	if storedProvider != providerName || time.Now().After(expires) {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	token, err := provider.Exchange(code, codeVerifier)
+	if err != nil {
+		http.Error(w, "Failed to redeem authorization code", http.StatusBadGateway)
+		fmt.Printf("Error exchanging code with %s: %v\n", providerName, err)
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(token.IDToken, nonce)
+	if err != nil {
+		http.Error(w, "Invalid ID token", http.StatusUnauthorized)
+		fmt.Printf("Error verifying ID token from %s: %v\n", providerName, err)
+		return
+	}
+
+	user, err := linkOIDCUser(providerName, claims)
+	if err != nil {
+		http.Error(w, "Failed to sign in user", http.StatusInternalServerError)
+		fmt.Printf("Error linking identity: %v\n", err)
+		return
+	}
+
+	tokenString, err := startSession(r, user.ID, user.Name)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"user": models.LoginResponse{
+		ID:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		PhoneNumber: user.PhoneNumber,
+		Token:       tokenString,
+	}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		fmt.Printf("Error encoding response: %v\n", err)
+		return
+	}
+}
+
+// linkOIDCUser finds the local user for an external identity. A first-time
+// identity is linked to the user with the same verified email, or a new
+// user is created for it.
+func linkOIDCUser(providerName string, claims *oidc.IDTokenClaims) (*models.User, error) {
+	var user models.User
+	query := `SELECT u.id, u.name, u.email, COALESCE(u.phone_number, '')
+		FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.provider = ? AND i.subject = ?`
+	err := database.DB.QueryRow(query, providerName, claims.Subject).Scan(&user.ID, &user.Name, &user.Email, &user.PhoneNumber)
+	if err == nil {
+		return &user, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	email := helpers.NormalizeEmail(claims.Email)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only a verified email is trusted to claim an existing account
+	found := false
+	if email != "" && bool(claims.EmailVerified) {
+		query = "SELECT id, name, email, COALESCE(phone_number, '') FROM users WHERE email = ?"
+		err = tx.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PhoneNumber)
+		if err == nil {
+			found = true
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	if !found {
+		if email == "" || !bool(claims.EmailVerified) {
+			return nil, fmt.Errorf("identity %s/%s has no verified email", providerName, claims.Subject)
+		}
+
+		user = models.User{Name: claims.Name, Email: email}
+		if user.Name == "" {
+			user.Name = strings.SplitN(email, "@", 2)[0]
+		}
+
+		result, err := tx.Exec("INSERT INTO users (name, email) VALUES (?, ?)", user.Name, user.Email)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		user.ID = int(id)
+	}
+
+	query = "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)"
+	_, err = tx.Exec(query, user.ID, providerName, claims.Subject, email, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
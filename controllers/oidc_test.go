@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"loginApi/config"
+	"loginApi/database/dbtest"
+	"loginApi/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestOIDCStateBoundToBrowser(t *testing.T) {
+	issuer := httptest.NewServer(nil)
+	t.Cleanup(issuer.Close)
+	issuer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+
+	previous := config.App.OIDCProviders
+	config.App.OIDCProviders = map[string]config.OIDCProvider{
+		"csrf-test": {Issuer: issuer.URL, ClientID: "app", RedirectURL: "https://shop.example/oidc/callback/csrf-test"},
+	}
+	t.Cleanup(func() { config.App.OIDCProviders = previous })
+
+	stub := dbtest.Use(t)
+	stub.On(`^DELETE FROM oidc_login_states WHERE expires_at < \?`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Result{Affected: 3}, nil
+	})
+	var storedHash string
+	stub.On(`^INSERT INTO oidc_login_states`, func(args []driver.Value) (dbtest.Result, error) {
+		storedHash = args[0].(string)
+		return dbtest.Result{Affected: 1}, nil
+	})
+	stub.On(`^SELECT provider, nonce, code_verifier, expires_at FROM oidc_login_states`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Rows([]string{"provider", "nonce", "code_verifier", "expires_at"}), nil
+	})
+
+	w := httptest.NewRecorder()
+	OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/oidc/login/csrf-test", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	if !stub.Ran(`^DELETE FROM oidc_login_states WHERE expires_at`) {
+		t.Error("expired login states were not cleaned up")
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	if utils.HashToken(state) != storedHash {
+		t.Fatalf("stored state hash %q does not match state %q", storedHash, state)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != oidcStateCookie || cookie.Value != storedHash || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie %+v", cookie)
+	}
+
+	callback := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/oidc/callback/csrf-test?code=abc&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		OIDCCallback(w, r)
+		return w
+	}
+
+	for name, c := range map[string]*http.Cookie{
+		"no cookie":            nil,
+		"another login's hash": {Name: oidcStateCookie, Value: utils.HashToken("other")},
+	} {
+		if w := callback(c); w.Code != http.StatusBadRequest || stub.Ran(`FROM oidc_login_states WHERE state_hash`) {
+			t.Fatalf("%s: status %d, state looked up %v", name, w.Code, stub.Ran(`FROM oidc_login_states WHERE state_hash`))
+		}
+	}
+
+	// With the cookie the callback gets as far as looking the state up
+	callback(cookie)
+	if !stub.Ran(`FROM oidc_login_states WHERE state_hash`) {
+		t.Fatalf("state not looked up: %q", stub.Statements())
+	}
+}
@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderColumns selects an order without its items.
+const orderColumns = "id, user_id, status, currency, subtotal, discount_total, shipping, total, item_count, created_at, updated_at"
+
+func scanOrder(row rowScanner) (models.Order, error) {
+	var order models.Order
+	var createdAt, updatedAt []byte
+
+	err := row.Scan(&order.ID, &order.User_id, &order.Status, &order.Currency, &order.Subtotal, &order.Discount_total, &order.Shipping, &order.Total, &order.Item_count, &createdAt, &updatedAt)
+	if err != nil {
+		return order, err
+	}
+
+	order.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return order, err
+	}
+	order.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	return order, err
+}
+
+// Checkout turns the caller's cart into an order. Everything happens in one
+// transaction: the cart items and the products they refer to are locked,
+// each item is checked to still be on sale and in stock, discounts are
+// applied, stock is taken, and the order is stored with each item's name
+// and price as they are now. The cart is emptied once the order is placed.
+// The body is optional: {"coupon": "CODE"}.
+func Checkout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(int)
+
+	var input struct {
+		Coupon string `json:"coupon"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		err = json.Unmarshal(body, &input)
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			fmt.Printf("Error parsing JSON: %v\n", err)
+			return
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var cartID int
+	err = tx.QueryRow("SELECT id FROM carts WHERE user_id = ? FOR UPDATE", userID).Scan(&cartID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Cart is empty", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error fetching cart: %v\n", err)
+		return
+	}
+
+	query := "SELECT " + cartItemColumns + " " + cartItemJoins + " WHERE ci.cart_id = ? ORDER BY ci.id FOR UPDATE"
+	rows, err := tx.Query(query, cartID)
+	if err != nil {
+		http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+		fmt.Printf("Error fetching cart items: %v\n", err)
+		return
+	}
+
+	items := []models.CartItem{}
+	for rows.Next() {
+		item, _, onSale, err := scanCartItem(rows)
+		if err != nil {
+			rows.Close()
+			http.Error(w, "Failed to fetch cart", http.StatusInternalServerError)
+			fmt.Printf("Error scanning cart item: %v\n", err)
+			return
+		}
+		if !onSale {
+			rows.Close()
+			http.Error(w, fmt.Sprintf("%s is no longer available; remove it from your cart", item.Name), http.StatusConflict)
+			return
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	if len(items) == 0 {
+		http.Error(w, "Cart is empty", http.StatusConflict)
+		return
+	}
+
+	order := models.Order{
+		User_id:    userID,
+		Status:     models.OrderPending,
+		Currency:   items[0].Currency,
+		Created_at: time.Now(),
+	}
+	for _, item := range items {
+		if item.Currency != order.Currency {
+			writeConflict(w, "currency", "Cart mixes prices in more than one currency")
+			return
+		}
+		order.Item_count += item.Quantity
+	}
+
+	totals, rejected, err := priceItems(tx, items, order.Currency, &userID, input.Coupon, requestLocale(r), true)
+	if err != nil {
+		http.Error(w, "Failed to apply discounts", http.StatusInternalServerError)
+		fmt.Printf("Error pricing order: %v\n", err)
+		return
+	}
+	if rejected != nil {
+		writeConflict(w, "coupon", rejected.Reason)
+		return
+	}
+	order.Subtotal = totals.Subtotal
+	order.Discount_total = totals.Discount
+	order.Shipping = totals.Shipping
+	order.Total = totals.Total
+	order.Discounts = appliedDiscounts(totals)
+
+	query = "INSERT INTO orders (user_id, status, currency, subtotal, discount_total, shipping, total, item_count, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, order.User_id, order.Status, order.Currency, order.Subtotal, order.Discount_total, order.Shipping, order.Total, order.Item_count, order.Created_at)
+	if err != nil {
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		fmt.Printf("Error inserting order: %v\n", err)
+		return
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		fmt.Printf("Error getting last insert ID: %v\n", err)
+		return
+	}
+	order.ID = int(orderID)
+
+	err = recordOrderEvent(tx, order.ID, nil, order.Status, "checkout", &userID, "")
+	if err != nil {
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		fmt.Printf("Error recording order event: %v\n", err)
+		return
+	}
+
+	reason := fmt.Sprintf("Order #%d", order.ID)
+	for _, item := range items {
+		err = takeStock(tx, item, userID, reason)
+		if err == errInsufficientStock {
+			http.Error(w, fmt.Sprintf("Insufficient stock for %s", item.Name), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+			fmt.Printf("Error taking stock: %v\n", err)
+			return
+		}
+
+		orderItem := models.OrderItem{
+			Order_id:     order.ID,
+			Product_id:   item.Product_id,
+			Variant_id:   item.Variant_id,
+			Product_name: item.Name,
+			SKU:          item.SKU,
+			Unit_price:   item.Unit_price,
+			Quantity:     item.Quantity,
+			Line_total:   item.Line_total,
+		}
+
+		var sku interface{}
+		if orderItem.SKU != "" {
+			sku = orderItem.SKU
+		}
+
+		query = "INSERT INTO order_items (order_id, product_id, variant_id, product_name, sku, unit_price, quantity, line_total) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+		result, err := tx.Exec(query, order.ID, orderItem.Product_id, orderItem.Variant_id, orderItem.Product_name, sku, orderItem.Unit_price, orderItem.Quantity, orderItem.Line_total)
+		if err != nil {
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+			fmt.Printf("Error inserting order item: %v\n", err)
+			return
+		}
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+			fmt.Printf("Error getting last insert ID: %v\n", err)
+			return
+		}
+		orderItem.ID = int(itemID)
+
+		order.Items = append(order.Items, orderItem)
+	}
+
+	for _, discount := range order.Discounts {
+		query = "INSERT INTO discount_redemptions (discount_id, order_id, user_id, code, name, kind, amount, explanation, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err = tx.Exec(query, discount.Discount_id, order.ID, userID, discount.Code, discount.Name, discount.Kind, discount.Amount, discount.Explanation, order.Created_at)
+		if err != nil {
+			http.Error(w, "Failed to place order", http.StatusInternalServerError)
+			fmt.Printf("Error recording discount: %v\n", err)
+			return
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID)
+	if err != nil {
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		fmt.Printf("Error emptying cart: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to place order", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"order": order,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// takeStock removes a cart item's quantity from stock through the stock
+// ledger. Variants keep their own stock.
+func takeStock(tx *sql.Tx, item models.CartItem, userID int, reason string) error {
+	if item.Variant_id == nil {
+		_, err := applyStockMovement(tx, item.Product_id, userID, "sale", -item.Quantity, reason)
+		return err
+	}
+	_, err := applyVariantStockMovement(tx, item.Product_id, *item.Variant_id, userID, "sale", -item.Quantity, reason)
+	if err == sql.ErrNoRows {
+		// The variant was deleted while in the cart
+		return errInsufficientStock
+	}
+	return err
+}
+
+// Orders serves /orders (the caller's order history, newest first) and
+// /orders/{id} (one order with its items).
+func Orders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/orders"), "/")
+	if idStr == "" {
+		GetOrders(w, r)
+		return
+	}
+
+	orderID, err := strconv.Atoi(idStr)
+	if err != nil || orderID <= 0 {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+	GetOrderDetail(w, r, orderID)
+}
+
+func GetOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	rows, err := database.DB.Query("SELECT "+orderColumns+" FROM orders WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan order", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"orders": orders,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func GetOrderDetail(w http.ResponseWriter, r *http.Request, orderID int) {
+	userID := r.Context().Value("userID").(int)
+
+	var ownerID int
+	err := database.DB.QueryRow("SELECT user_id FROM orders WHERE id = ?", orderID).Scan(&ownerID)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order: %v\n", err)
+		return
+	}
+
+	// Other users' orders are reported as missing rather than forbidden
+	if err == nil && ownerID != userID {
+		admin, err := callerIsAdmin(r, userID)
+		if err != nil {
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			fmt.Printf("Error checking admin flag: %v\n", err)
+			return
+		}
+		if !admin {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	writeOrderDetail(w, orderID)
+}
+
+// writeOrderDetail responds with an order, its items, discounts, payments
+// and status history.
+func writeOrderDetail(w http.ResponseWriter, orderID int) {
+	order, err := scanOrder(database.DB.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", orderID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order: %v\n", err)
+		return
+	}
+
+	order.Items, err = loadOrderItems(order.ID)
+	if err == nil {
+		order.Discounts, err = loadOrderDiscounts(order.ID)
+	}
+	if err == nil {
+		order.Payments, err = loadOrderPayments(order.ID)
+	}
+	if err == nil {
+		order.History, err = loadOrderHistory(order.ID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch order details", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order details: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"order": order,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func loadOrderItems(orderID int) ([]models.OrderItem, error) {
+	query := "SELECT id, order_id, product_id, variant_id, product_name, COALESCE(sku, ''), unit_price, quantity, line_total FROM order_items WHERE order_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(&item.ID, &item.Order_id, &item.Product_id, &item.Variant_id, &item.Product_name, &item.SKU, &item.Unit_price, &item.Quantity, &item.Line_total)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
@@ -0,0 +1,599 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/payments"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderTransitions lists the statuses each order status may move to.
+// Cancelled and refunded orders are final.
+var orderTransitions = map[string][]string{
+	models.OrderPending:   {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderShipped, models.OrderCancelled, models.OrderRefunded},
+	models.OrderShipped:   {models.OrderDelivered, models.OrderRefunded},
+	models.OrderDelivered: {models.OrderRefunded},
+	models.OrderCancelled: {},
+	models.OrderRefunded:  {},
+}
+
+var errOrderTransition = errors.New("order status transition not allowed")
+
+// errPaymentEventAmount is returned by applyPaymentEvent for an amount the
+// payment cannot account for.
+var errPaymentEventAmount = errors.New("invalid payment event amount")
+
+func canTransitionOrder(from, to string) bool {
+	return containsString(orderTransitions[from], to)
+}
+
+// lockOrder fetches an order and locks it for the rest of tx.
+func lockOrder(tx *sql.Tx, orderID int) (models.Order, error) {
+	return scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ? FOR UPDATE", orderID))
+}
+
+// transitionOrder moves a locked order to a new status and records the
+// change. source and actorID say who or what made the change. Orders that
+// end before they were shipped put their items back in stock.
+func transitionOrder(tx *sql.Tx, order *models.Order, to, source string, actorID *int, reason string) error {
+	if !canTransitionOrder(order.Status, to) {
+		return errOrderTransition
+	}
+
+	now := time.Now()
+	_, err := tx.Exec("UPDATE orders SET status = ?, updated_at = ? WHERE id = ?", to, now, order.ID)
+	if err != nil {
+		return err
+	}
+
+	from := order.Status
+	if to == models.OrderCancelled || (to == models.OrderRefunded && from == models.OrderPaid) {
+		stockUserID := order.User_id
+		if actorID != nil {
+			stockUserID = *actorID
+		}
+		err = restockOrder(tx, order.ID, stockUserID, fmt.Sprintf("Order #%d %s", order.ID, to))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = recordOrderEvent(tx, order.ID, &from, to, source, actorID, reason)
+	if err != nil {
+		return err
+	}
+
+	order.Status = to
+	order.Updated_at = sql.NullTime{Time: now, Valid: true}
+	return nil
+}
+
+func recordOrderEvent(tx *sql.Tx, orderID int, from *string, to, source string, userID *int, reason string) error {
+	query := "INSERT INTO order_events (order_id, from_status, to_status, source, user_id, reason, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := tx.Exec(query, orderID, from, to, source, userID, reason, time.Now())
+	return err
+}
+
+// restockOrder returns an order's items to stock. Items whose variant has
+// since been deleted are skipped.
+func restockOrder(tx *sql.Tx, orderID, userID int, reason string) error {
+	rows, err := tx.Query("SELECT product_id, variant_id, quantity FROM order_items WHERE order_id = ?", orderID)
+	if err != nil {
+		return err
+	}
+
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		err := rows.Scan(&item.Product_id, &item.Variant_id, &item.Quantity)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.Variant_id != nil {
+			_, err = applyVariantStockMovement(tx, item.Product_id, *item.Variant_id, userID, "restock", item.Quantity, reason)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+		} else {
+			_, err = applyStockMovement(tx, item.Product_id, userID, "restock", item.Quantity, reason)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundOrderPayments refunds whatever is left of each captured payment of
+// a locked order.
+func refundOrderPayments(r *http.Request, tx *sql.Tx, orderID int) error {
+	query := "SELECT id, provider, provider_ref, captured_amount, refunded_amount FROM payments WHERE order_id = ? AND status = ? FOR UPDATE"
+	rows, err := tx.Query(query, orderID, models.PaymentCaptured)
+	if err != nil {
+		return err
+	}
+
+	var captured []models.Payment
+	for rows.Next() {
+		var payment models.Payment
+		err := rows.Scan(&payment.ID, &payment.Provider, &payment.Provider_ref, &payment.Captured_amount, &payment.Refunded_amount)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		captured = append(captured, payment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, payment := range captured {
+		if payment.Provider != payments.Default.Name() {
+			return fmt.Errorf("payment %d was made with provider %s, which is not configured", payment.ID, payment.Provider)
+		}
+
+		remaining := payment.Captured_amount - payment.Refunded_amount
+		if remaining > 0 {
+			err = payments.Default.Refund(r.Context(), payment.Provider_ref, remaining)
+			if err != nil {
+				return err
+			}
+		}
+
+		query = "UPDATE payments SET status = ?, refunded_amount = captured_amount, updated_at = ? WHERE id = ?"
+		_, err = tx.Exec(query, models.PaymentRefunded, time.Now(), payment.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PayOrder serves POST /pay/orders/{id} with {"source": "..."}: it has the
+// payment provider authorize and capture the order total and marks the
+// order paid. The order stays locked while the provider is called, so an
+// order cannot be paid twice.
+func PayOrder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/pay/orders/")
+	orderID, err := strconv.Atoi(idStr)
+	if err != nil || orderID <= 0 {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Source string `json:"source"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if input.Source == "" {
+		http.Error(w, "Payment source is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	order, err := lockOrder(tx, orderID)
+	if err == sql.ErrNoRows || (err == nil && order.User_id != userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order: %v\n", err)
+		return
+	}
+
+	if order.Status != models.OrderPending {
+		http.Error(w, fmt.Sprintf("Order is %s; only pending orders can be paid", order.Status), http.StatusConflict)
+		return
+	}
+
+	auth, err := payments.Default.Authorize(r.Context(), payments.Request{
+		OrderID:  order.ID,
+		Amount:   order.Total,
+		Currency: order.Currency,
+		Source:   input.Source,
+	})
+	if err == payments.ErrDeclined {
+		http.Error(w, "Payment declined", http.StatusPaymentRequired)
+		return
+	} else if err != nil {
+		http.Error(w, "Payment provider error", http.StatusBadGateway)
+		fmt.Printf("Error authorizing payment for order %d: %v\n", order.ID, err)
+		return
+	}
+
+	now := time.Now()
+	query := "INSERT INTO payments (order_id, provider, provider_ref, status, amount, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, order.ID, payments.Default.Name(), auth.Ref, models.PaymentAuthorized, auth.Amount, now)
+	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		fmt.Printf("Error inserting payment: %v\n", err)
+		return
+	}
+	paymentID, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		fmt.Printf("Error getting last insert ID: %v\n", err)
+		return
+	}
+
+	err = payments.Default.Capture(r.Context(), auth.Ref, order.Total)
+	if err != nil {
+		// Keep the authorization on record; the provider may still capture
+		// it and report back through the webhook
+		fmt.Printf("Error capturing payment for order %d: %v\n", order.ID, err)
+		if err := tx.Commit(); err != nil {
+			fmt.Printf("Error committing transaction: %v\n", err)
+		}
+		http.Error(w, "Payment provider error", http.StatusBadGateway)
+		return
+	}
+
+	query = "UPDATE payments SET status = ?, captured_amount = ?, updated_at = ? WHERE id = ?"
+	_, err = tx.Exec(query, models.PaymentCaptured, order.Total, now, paymentID)
+	if err == nil {
+		err = transitionOrder(tx, &order, models.OrderPaid, "payment", &userID, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to record payment", http.StatusInternalServerError)
+		fmt.Printf("Error recording payment for order %d: %v\n", order.ID, err)
+		return
+	}
+
+	writeOrderDetail(w, order.ID)
+}
+
+// ChangeOrderStatus serves POST /status/orders/{id} with {"status": "...",
+// "reason": "..."}. Administrators may make any allowed transition; the
+// customer may only cancel an order that is still pending. Cancelling or
+// refunding a paid order refunds its payments.
+func ChangeOrderStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/status/orders/")
+	orderID, err := strconv.Atoi(idStr)
+	if err != nil || orderID <= 0 {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if _, ok := orderTransitions[input.Status]; !ok {
+		http.Error(w, "Status must be pending, paid, shipped, delivered, cancelled or refunded", http.StatusBadRequest)
+		return
+	}
+	if len(input.Reason) > 255 {
+		http.Error(w, "Reason must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := callerIsAdmin(r, userID)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		fmt.Printf("Error checking admin flag: %v\n", err)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	order, err := lockOrder(tx, orderID)
+	if err == sql.ErrNoRows || (err == nil && !admin && order.User_id != userID) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order: %v\n", err)
+		return
+	}
+
+	source := "admin"
+	if !admin {
+		source = "user"
+		if input.Status != models.OrderCancelled || order.Status != models.OrderPending {
+			http.Error(w, "Only pending orders can be cancelled; contact support for anything else", http.StatusForbidden)
+			return
+		}
+	}
+
+	if !canTransitionOrder(order.Status, input.Status) {
+		writeConflict(w, "status", fmt.Sprintf("Cannot move an order from %s to %s", order.Status, input.Status))
+		return
+	}
+
+	if input.Status == models.OrderCancelled || input.Status == models.OrderRefunded {
+		err = refundOrderPayments(r, tx, order.ID)
+		if err != nil {
+			http.Error(w, "Failed to refund payment", http.StatusBadGateway)
+			fmt.Printf("Error refunding order %d: %v\n", order.ID, err)
+			return
+		}
+	}
+
+	err = transitionOrder(tx, &order, input.Status, source, &userID, input.Reason)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to update order status", http.StatusInternalServerError)
+		fmt.Printf("Error updating order %d: %v\n", order.ID, err)
+		return
+	}
+
+	writeOrderDetail(w, order.ID)
+}
+
+// PaymentWebhook serves POST /webhooks/payments. The body must be signed
+// with the configured webhook secret in X-Payment-Signature. Each event is
+// applied once: its ID is stored in the same transaction as its effects,
+// so a redelivered event is acknowledged without being applied again.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if !payments.VerifySignature(body, r.Header.Get("X-Payment-Signature")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event payments.Event
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		http.Error(w, "Invalid event payload", http.StatusBadRequest)
+		fmt.Printf("Error parsing webhook: %v\n", err)
+		return
+	}
+	if event.ID == "" || event.Type == "" || event.PaymentRef == "" {
+		http.Error(w, "Event id, type and payment_ref are required", http.StatusBadRequest)
+		return
+	}
+
+	provider := payments.Default.Name()
+
+	var orderID int
+	err = database.DB.QueryRow("SELECT order_id FROM payments WHERE provider = ? AND provider_ref = ?", provider, event.PaymentRef).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		fmt.Printf("Error fetching payment: %v\n", err)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO payment_webhook_events (event_id, provider, type, payment_ref, received_at) VALUES (?, ?, ?, ?, ?)"
+	_, err = tx.Exec(query, event.ID, provider, event.Type, event.PaymentRef, time.Now())
+	if _, dup := database.DuplicateKey(err); dup {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Event already processed")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to record event", http.StatusInternalServerError)
+		fmt.Printf("Error recording webhook event: %v\n", err)
+		return
+	}
+
+	// Lock the order before the payment, the same order PayOrder uses
+	order, err := lockOrder(tx, orderID)
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		fmt.Printf("Error fetching order: %v\n", err)
+		return
+	}
+
+	var payment models.Payment
+	query = "SELECT id, status, amount, captured_amount, refunded_amount FROM payments WHERE provider = ? AND provider_ref = ? FOR UPDATE"
+	err = tx.QueryRow(query, provider, event.PaymentRef).Scan(&payment.ID, &payment.Status, &payment.Amount, &payment.Captured_amount, &payment.Refunded_amount)
+	if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		fmt.Printf("Error fetching payment: %v\n", err)
+		return
+	}
+
+	err = applyPaymentEvent(tx, &order, payment, event)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if errors.Is(err, errPaymentEventAmount) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Rejected webhook event %s: %v\n", event.ID, err)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		fmt.Printf("Error processing webhook event %s: %v\n", event.ID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Event processed")
+}
+
+// applyPaymentEvent updates a locked payment and its order for a webhook
+// event. Event types it does not know are recorded and otherwise ignored.
+// A capture may not exceed what was authorized and refunds may not add up
+// to more than was captured; such events fail with errPaymentEventAmount.
+func applyPaymentEvent(tx *sql.Tx, order *models.Order, payment models.Payment, event payments.Event) error {
+	now := time.Now()
+
+	switch event.Type {
+	case payments.EventCaptured:
+		if payment.Status != models.PaymentAuthorized {
+			return nil
+		}
+		if event.Amount <= 0 || event.Amount > payment.Amount {
+			return fmt.Errorf("%w: capture of %d on a payment authorized for %d", errPaymentEventAmount, event.Amount, payment.Amount)
+		}
+		_, err := tx.Exec("UPDATE payments SET status = ?, captured_amount = ?, updated_at = ? WHERE id = ?", models.PaymentCaptured, event.Amount, now, payment.ID)
+		if err != nil {
+			return err
+		}
+		if order.Status == models.OrderPending {
+			return transitionOrder(tx, order, models.OrderPaid, "webhook", nil, "")
+		}
+
+	case payments.EventRefunded:
+		if payment.Status != models.PaymentCaptured {
+			return fmt.Errorf("%w: refund on a %s payment", errPaymentEventAmount, payment.Status)
+		}
+		refunded := payment.Refunded_amount + event.Amount
+		if event.Amount <= 0 || refunded > payment.Captured_amount {
+			return fmt.Errorf("%w: refund of %d with %d of %d captured already refunded", errPaymentEventAmount, event.Amount, payment.Refunded_amount, payment.Captured_amount)
+		}
+		status := payment.Status
+		if refunded == payment.Captured_amount {
+			status = models.PaymentRefunded
+		}
+		_, err := tx.Exec("UPDATE payments SET status = ?, refunded_amount = ?, updated_at = ? WHERE id = ?", status, refunded, now, payment.ID)
+		if err != nil {
+			return err
+		}
+		if status == models.PaymentRefunded && canTransitionOrder(order.Status, models.OrderRefunded) {
+			return transitionOrder(tx, order, models.OrderRefunded, "webhook", nil, "Refunded by payment provider")
+		}
+
+	case payments.EventFailed:
+		if payment.Status != models.PaymentAuthorized {
+			return nil
+		}
+		_, err := tx.Exec("UPDATE payments SET status = ?, updated_at = ? WHERE id = ?", models.PaymentFailed, now, payment.ID)
+		return err
+	}
+
+	return nil
+}
+
+func loadOrderPayments(orderID int) ([]models.Payment, error) {
+	query := "SELECT id, order_id, provider, provider_ref, status, amount, captured_amount, refunded_amount, created_at, updated_at FROM payments WHERE order_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Payment{}
+	for rows.Next() {
+		var payment models.Payment
+		var createdAt, updatedAt []byte
+		err := rows.Scan(&payment.ID, &payment.Order_id, &payment.Provider, &payment.Provider_ref, &payment.Status, &payment.Amount, &payment.Captured_amount, &payment.Refunded_amount, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		payment.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		payment.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, payment)
+	}
+
+	return list, rows.Err()
+}
+
+func loadOrderHistory(orderID int) ([]models.OrderEvent, error) {
+	query := "SELECT id, order_id, from_status, to_status, source, user_id, reason, created_at FROM order_events WHERE order_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.OrderEvent{}
+	for rows.Next() {
+		var event models.OrderEvent
+		var createdAt []byte
+		err := rows.Scan(&event.ID, &event.Order_id, &event.From_status, &event.To_status, &event.Source, &event.User_id, &event.Reason, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, event)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"loginApi/config"
+	"loginApi/database/dbtest"
+	"loginApi/models"
+	"loginApi/payments"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	statuses := []string{models.OrderPending, models.OrderPaid, models.OrderShipped, models.OrderDelivered, models.OrderCancelled, models.OrderRefunded}
+	allowed := map[[2]string]bool{
+		{models.OrderPending, models.OrderPaid}:       true,
+		{models.OrderPending, models.OrderCancelled}:  true,
+		{models.OrderPaid, models.OrderShipped}:       true,
+		{models.OrderPaid, models.OrderCancelled}:     true,
+		{models.OrderPaid, models.OrderRefunded}:      true,
+		{models.OrderShipped, models.OrderDelivered}:  true,
+		{models.OrderShipped, models.OrderRefunded}:   true,
+		{models.OrderDelivered, models.OrderRefunded}: true,
+	}
+
+	for _, from := range statuses {
+		if _, ok := orderTransitions[from]; !ok {
+			t.Errorf("status %q missing from orderTransitions", from)
+		}
+		for _, to := range statuses {
+			got := canTransitionOrder(from, to)
+			if got != allowed[[2]string{from, to}] {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, !got)
+			}
+		}
+	}
+	if canTransitionOrder("", models.OrderPaid) || canTransitionOrder("unknown", models.OrderPaid) {
+		t.Error("transition allowed from an unknown status")
+	}
+}
+
+// orderTables answers the order queries the payment handlers run for
+// order 5 of user 7, totalling 1000.
+func orderTables(stub *dbtest.Stub, status string) {
+	stub.On(`FROM orders WHERE id = \?`, func([]driver.Value) (dbtest.Result, error) {
+		columns := strings.Split(orderColumns, ", ")
+		return dbtest.Rows(columns, []driver.Value{5, 7, status, "EUR", 1000, 0, 0, 1000, 1, "2026-01-02 03:04:05", nil}), nil
+	})
+	stub.On(`WHERE order_id = \?`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Rows(nil), nil
+	})
+	stub.On(`^UPDATE orders SET status = \?`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Result{Affected: 1}, nil
+	})
+	stub.On(`^INSERT INTO order_events`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Result{InsertID: 1, Affected: 1}, nil
+	})
+}
+
+func useFakePayments(t *testing.T) *payments.Fake {
+	previous := payments.Default
+	fake := payments.NewFake()
+	payments.Default = fake
+	t.Cleanup(func() { payments.Default = previous })
+	return fake
+}
+
+func TestPayOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID int
+		status string
+		body   string
+		want   int
+		paid   bool
+	}{
+		{"paid", 7, models.OrderPending, `{"source": "tok_visa"}`, http.StatusOK, true},
+		{"declined", 7, models.OrderPending, `{"source": "` + payments.DeclinedSource + `"}`, http.StatusPaymentRequired, false},
+		{"no source", 7, models.OrderPending, `{}`, http.StatusBadRequest, false},
+		{"someone else's order", 8, models.OrderPending, `{"source": "tok_visa"}`, http.StatusNotFound, false},
+		{"already paid", 7, models.OrderPaid, `{"source": "tok_visa"}`, http.StatusConflict, false},
+		{"cancelled", 7, models.OrderCancelled, `{"source": "tok_visa"}`, http.StatusConflict, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakePayments(t)
+			stub := dbtest.Use(t)
+			orderTables(stub, tt.status)
+			stub.On(`^INSERT INTO payments`, func(args []driver.Value) (dbtest.Result, error) {
+				if args[1] != "fake" || args[3] != models.PaymentAuthorized || args[4] != int64(1000) {
+					t.Errorf("payment inserted with %v", args)
+				}
+				return dbtest.Result{InsertID: 11, Affected: 1}, nil
+			})
+			stub.On(`^UPDATE payments SET status = \?, captured_amount = \?`, func(args []driver.Value) (dbtest.Result, error) {
+				if args[0] != models.PaymentCaptured || args[1] != int64(1000) || args[3] != int64(11) {
+					t.Errorf("payment captured with %v", args)
+				}
+				return dbtest.Result{Affected: 1}, nil
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/pay/orders/5", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r = r.WithContext(context.WithValue(r.Context(), "userID", tt.userID))
+			w := httptest.NewRecorder()
+			PayOrder(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if stub.Ran(`^INSERT INTO payments`) != tt.paid || stub.Ran(`^UPDATE orders SET status`) != tt.paid || stub.Ran(`^COMMIT$`) != tt.paid {
+				t.Fatalf("statements %q", stub.Statements())
+			}
+		})
+	}
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	previous := config.App.Payments.WebhookSecret
+	config.App.Payments.WebhookSecret = "whsec"
+	t.Cleanup(func() { config.App.Payments.WebhookSecret = previous })
+
+	tests := []struct {
+		name      string
+		order     string
+		payment   models.Payment
+		event     string
+		signature string
+		duplicate bool
+		want      int
+		applied   bool
+		toStatus  string
+	}{
+		{
+			name:    "capture",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`,
+			want:    http.StatusOK, applied: true, toStatus: models.OrderPaid,
+		},
+		{
+			name:    "partial capture",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":600}`,
+			want:    http.StatusOK, applied: true, toStatus: models.OrderPaid,
+		},
+		{
+			name:    "capture above the authorization",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1500}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "capture without amount",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1"}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "capture of a captured payment",
+			order:   models.OrderPaid,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`,
+			want:    http.StatusOK,
+		},
+		{
+			name:    "full refund",
+			order:   models.OrderPaid,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":1000}`,
+			want:    http.StatusOK, applied: true, toStatus: models.OrderRefunded,
+		},
+		{
+			name:    "last part of a refund",
+			order:   models.OrderShipped,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000, Refunded_amount: 700},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":300}`,
+			want:    http.StatusOK, applied: true, toStatus: models.OrderRefunded,
+		},
+		{
+			name:    "partial refund",
+			order:   models.OrderPaid,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":400}`,
+			want:    http.StatusOK, applied: true,
+		},
+		{
+			name:    "refund above the capture",
+			order:   models.OrderPaid,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000, Refunded_amount: 800},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":300}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "refund of an uncaptured payment",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":0}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "refund of a refunded payment",
+			order:   models.OrderRefunded,
+			payment: models.Payment{Status: models.PaymentRefunded, Amount: 1000, Captured_amount: 1000, Refunded_amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":100}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "negative refund",
+			order:   models.OrderPaid,
+			payment: models.Payment{Status: models.PaymentCaptured, Amount: 1000, Captured_amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.refunded","payment_ref":"fake_1","amount":-100}`,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "failure",
+			order:   models.OrderPending,
+			payment: models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:   `{"id":"evt_1","type":"payment.failed","payment_ref":"fake_1"}`,
+			want:    http.StatusOK, applied: true,
+		},
+		{
+			name:      "redelivered event",
+			order:     models.OrderPending,
+			payment:   models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:     `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`,
+			duplicate: true,
+			want:      http.StatusOK,
+		},
+		{
+			name:      "bad signature",
+			order:     models.OrderPending,
+			payment:   models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:     `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`,
+			signature: payments.Sign([]byte("{}"), "whsec"),
+			want:      http.StatusUnauthorized,
+		},
+		{
+			name:      "signed with another secret",
+			order:     models.OrderPending,
+			payment:   models.Payment{Status: models.PaymentAuthorized, Amount: 1000},
+			event:     `{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`,
+			signature: payments.Sign([]byte(`{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`), "other"),
+			want:      http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakePayments(t)
+			stub := dbtest.Use(t)
+			orderTables(stub, tt.order)
+			stub.On(`^SELECT order_id FROM payments`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"order_id"}, []driver.Value{5}), nil
+			})
+			stub.On(`^INSERT INTO payment_webhook_events`, func(args []driver.Value) (dbtest.Result, error) {
+				if tt.duplicate {
+					return dbtest.Result{}, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'evt_1-fake' for key 'PRIMARY'"}
+				}
+				return dbtest.Result{Affected: 1}, nil
+			})
+			stub.On(`^SELECT id, status, amount, captured_amount, refunded_amount FROM payments .* FOR UPDATE$`, func([]driver.Value) (dbtest.Result, error) {
+				p := tt.payment
+				return dbtest.Rows([]string{"id", "status", "amount", "captured_amount", "refunded_amount"}, []driver.Value{11, p.Status, p.Amount, p.Captured_amount, p.Refunded_amount}), nil
+			})
+			stub.On(`^UPDATE payments SET`, func(args []driver.Value) (dbtest.Result, error) {
+				return dbtest.Result{Affected: 1}, nil
+			})
+			stub.On(`^UPDATE orders SET status = \?`, func(args []driver.Value) (dbtest.Result, error) {
+				if args[0] != tt.toStatus {
+					t.Errorf("order moved to %v, want %q", args[0], tt.toStatus)
+				}
+				return dbtest.Result{Affected: 1}, nil
+			})
+
+			signature := tt.signature
+			if signature == "" {
+				signature = payments.Sign([]byte(tt.event), "whsec")
+			}
+			r := httptest.NewRequest(http.MethodPost, "/webhooks/payments", strings.NewReader(tt.event))
+			r.Header.Set("X-Payment-Signature", signature)
+			w := httptest.NewRecorder()
+			PaymentWebhook(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if applied := stub.Ran(`^UPDATE payments SET`); applied != tt.applied {
+				t.Fatalf("payment updated = %v, want %v: %q", applied, tt.applied, stub.Statements())
+			}
+			if tt.want == http.StatusOK && !tt.duplicate && !stub.Ran(`^COMMIT$`) {
+				t.Fatalf("event not committed: %q", stub.Statements())
+			}
+			if tt.want != http.StatusOK && stub.Ran(`^COMMIT$`) {
+				t.Fatalf("rejected event committed: %q", stub.Statements())
+			}
+			if moved := stub.Ran(`^UPDATE orders SET status`); moved != (tt.toStatus != "") {
+				t.Fatalf("order moved = %v, want to %q", moved, tt.toStatus)
+			}
+		})
+	}
+}
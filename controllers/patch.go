@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"loginApi/jsonpatch"
+	"net/http"
+	"strings"
+)
+
+// maxPatchBytes bounds a patch document.
+const maxPatchBytes = 1 << 20
+
+var acceptPatch = jsonpatch.MergePatchType + ", " + jsonpatch.JSONPatchType
+
+// patchType returns the patch media type of the request body, or "" if it
+// is not a patch document.
+func patchType(r *http.Request) string {
+	mediaType, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == jsonpatch.MergePatchType || mediaType == jsonpatch.JSONPatchType {
+		return mediaType
+	}
+	return ""
+}
+
+// readPatch reads the request's merge patch or JSON Patch document and
+// its media type. It writes the error response and returns ok == false
+// for other content types or oversized bodies.
+func readPatch(w http.ResponseWriter, r *http.Request) (patch []byte, mediaType string, ok bool) {
+	mediaType = patchType(r)
+	if mediaType == "" {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		http.Error(w, "Content-Type must be "+acceptPatch, http.StatusUnsupportedMediaType)
+		return nil, "", false
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxPatchBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		fmt.Printf("Error reading patch: %v\n", err)
+		return nil, "", false
+	}
+	if len(patch) > maxPatchBytes {
+		http.Error(w, "Patch document is too large", http.StatusRequestEntityTooLarge)
+		return nil, "", false
+	}
+	return patch, mediaType, true
+}
+
+// applyPatch applies patch to current, the patchable fields of a resource,
+// and decodes the outcome into patched. Fields the outcome has that
+// patched lacks are refused, so a patch cannot reach fields that change
+// through other endpoints. It writes the error response and returns false
+// on failure: 400 for a malformed patch, 409 for one that does not apply
+// to the current resource, 422 for an outcome of the wrong shape.
+func applyPatch(w http.ResponseWriter, mediaType string, patch []byte, current, patched interface{}) bool {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		http.Error(w, "Failed to encode resource", http.StatusInternalServerError)
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return false
+	}
+
+	result, err := jsonpatch.Apply(mediaType, doc, patch)
+	if errors.Is(err, jsonpatch.ErrFailed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(patched)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Patched resource is invalid: %v", strings.TrimPrefix(err.Error(), "json: ")), http.StatusUnprocessableEntity)
+		return false
+	}
+	return true
+}
+
+// patchTouches reports whether patch names field, a top-level member of
+// the resource, so handlers can tell a value the client set from one it
+// left alone.
+func patchTouches(mediaType string, patch []byte, field string) bool {
+	if mediaType == jsonpatch.MergePatchType {
+		var members map[string]json.RawMessage
+		return json.Unmarshal(patch, &members) == nil && members[field] != nil
+	}
+
+	var operations []struct {
+		Path string `json:"path"`
+	}
+	if json.Unmarshal(patch, &operations) != nil {
+		return false
+	}
+	for _, op := range operations {
+		if op.Path == "/"+field {
+			return true
+		}
+	}
+	return false
+}
+
+// writePatched answers a successful patch with the resource's patchable
+// fields under name and its new version, which also goes out as the ETag.
+func writePatched(w http.ResponseWriter, name string, id, version int, resource interface{}) {
+	response := map[string]interface{}{
+		name + "_id": id,
+		"version":    version,
+		name:         resource,
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
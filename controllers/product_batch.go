@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/search"
+	"net/http"
+	"strings"
+)
+
+const maxBatchOperations = 1000
+
+// Batch modes. An atomic batch runs in one transaction and stops at the
+// first failure; a partial batch applies each operation on its own.
+const (
+	batchAtomic  = "atomic"
+	batchPartial = "partial"
+)
+
+// batchOperation is one entry of a batch. Update and delete name the
+// product by id or by its sku in the batch's catalog; version, like
+// If-Match on the single endpoints, makes them fail unless the product is
+// still at it.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int             `json:"id"`
+	SKU     string          `json:"sku"`
+	Version int             `json:"version"`
+	Product *models.Product `json:"product"`
+}
+
+type batchResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	ID     int    `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Field  string `json:"field,omitempty"`
+}
+
+// BatchProducts serves POST /batch/products with
+// {"mode": "atomic"|"partial", "operations": [{"op": "create", "product":
+// {...}}, {"op": "update", "id": 1, "product": {...}}, {"op": "delete",
+// "sku": "..."}]}. Operations run in order with the same checks as
+// /create/product, /update/products/{id} and DELETE /products/{id}, and
+// each gets a result with the status the single endpoint would have
+// answered. Atomic batches (the default) commit only if every operation
+// succeeds and answer with the failing operation's status otherwise. With
+// ?shop_id= SKUs are looked up in that shop's catalog and products are
+// created in it unless they name a shop of their own.
+func BatchProducts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, ok := requestCatalog(w, r, userID, models.ShopEditor)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = batchAtomic
+	}
+	if input.Mode != batchAtomic && input.Mode != batchPartial {
+		http.Error(w, "Mode must be atomic or partial", http.StatusBadRequest)
+		return
+	}
+	if len(input.Operations) == 0 || len(input.Operations) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("A batch must have between 1 and %d operations", maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+
+	var results []batchResult
+	var committed bool
+	if input.Mode == batchAtomic {
+		results, committed, err = runAtomicBatch(c, input.Operations)
+	} else {
+		results, err = runPartialBatch(c, input.Operations)
+		committed = true
+	}
+	if err != nil {
+		http.Error(w, "Failed to run batch", http.StatusInternalServerError)
+		fmt.Printf("Error running batch: %v\n", err)
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Error == "" {
+			succeeded++
+		}
+	}
+
+	// An atomic batch that was rolled back answers with the status of the
+	// operation that failed, so single-item errors read the same
+	status := http.StatusOK
+	if !committed {
+		status = results[len(results)-1].Status
+	}
+
+	response := map[string]interface{}{
+		"mode":      input.Mode,
+		"committed": committed,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// runAtomicBatch applies operations in one transaction. It stops at the
+// first failing operation, whose result is the last one returned, and
+// rolls everything back. The error is for failures outside any operation.
+func runAtomicBatch(c catalog, operations []batchOperation) ([]batchResult, bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	results := make([]batchResult, 0, len(operations))
+	for i, op := range operations {
+		result := runBatchOperation(tx, c, i, op)
+		results = append(results, result)
+		if result.Error != "" {
+			return results, false, nil
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, result := range results {
+		syncBatchSearch(result)
+	}
+	return results, true, nil
+}
+
+// runPartialBatch applies each operation in its own transaction, so the
+// ones that succeed stay applied whatever happens to the rest.
+func runPartialBatch(c catalog, operations []batchOperation) ([]batchResult, error) {
+	results := make([]batchResult, 0, len(operations))
+	for i, op := range operations {
+		tx, err := database.DB.Begin()
+		if err != nil {
+			return nil, err
+		}
+
+		result := runBatchOperation(tx, c, i, op)
+		if result.Error != "" {
+			tx.Rollback()
+			results = append(results, result)
+			continue
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			tx.Rollback()
+			fmt.Printf("Error committing batch operation %d: %v\n", i, err)
+			result.Status = http.StatusInternalServerError
+			result.Error = "Failed to commit operation"
+			results = append(results, result)
+			continue
+		}
+		syncBatchSearch(result)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runBatchOperation applies one operation inside tx and describes the
+// outcome. Unexpected errors are logged and reported as a 500.
+func runBatchOperation(tx *sql.Tx, c catalog, index int, op batchOperation) batchResult {
+	result := batchResult{Index: index, Op: op.Op}
+
+	id, status, err := applyBatchOperation(tx, c, op)
+	result.ID = id
+	result.Status = status
+
+	var perr *productError
+	if errors.As(err, &perr) {
+		result.Status = perr.Status
+		result.Error = perr.Message
+		result.Field = perr.Field
+	} else if err != nil {
+		fmt.Printf("Error in batch operation %d: %v\n", index, err)
+		result.Status = http.StatusInternalServerError
+		result.Error = "Failed to apply operation"
+	}
+	return result
+}
+
+func applyBatchOperation(tx *sql.Tx, c catalog, op batchOperation) (int, int, error) {
+	switch op.Op {
+	case "create":
+		if op.Product == nil {
+			return 0, 0, &productError{Status: http.StatusBadRequest, Message: "product is required"}
+		}
+		if op.Product.Shop_id == nil {
+			op.Product.Shop_id = c.shopID
+		}
+		err := validateNewProduct(tx, op.Product)
+		if err != nil {
+			return 0, 0, err
+		}
+		id, err := insertProduct(tx, c.userID, op.Product)
+		return id, http.StatusCreated, err
+
+	case "update":
+		if op.Product == nil {
+			return 0, 0, &productError{Status: http.StatusBadRequest, Message: "product is required"}
+		}
+		id, err := batchProductID(tx, c, op, models.ShopEditor)
+		if err != nil {
+			return 0, 0, err
+		}
+		return id, http.StatusOK, updateProduct(tx, id, op.versions(), op.Product)
+
+	case "delete":
+		id, err := batchProductID(tx, c, op, models.ShopManager)
+		if err != nil {
+			return 0, 0, err
+		}
+		return id, http.StatusOK, trashProduct(tx, id, op.versions())
+	}
+	return 0, 0, &productError{Status: http.StatusBadRequest, Message: "op must be create, update or delete"}
+}
+
+func (op batchOperation) versions() []int {
+	if op.Version <= 0 {
+		return nil
+	}
+	return []int{op.Version}
+}
+
+// batchProductID resolves the product an update or delete names and checks
+// that the caller holds at least role over it, locking its row for the
+// rest of the transaction.
+func batchProductID(tx *sql.Tx, c catalog, op batchOperation, role string) (int, error) {
+	id := op.ID
+	sku := strings.TrimSpace(op.SKU)
+	if id <= 0 && sku == "" {
+		return 0, &productError{Status: http.StatusBadRequest, Message: "id or sku is required"}
+	}
+
+	if id <= 0 {
+		condition, args := c.condition("")
+		query := "SELECT id FROM products WHERE " + condition + " AND sku = ? AND deleted_at IS NULL"
+		err := tx.QueryRow(query, append(args, sku)...).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, &productError{Status: http.StatusNotFound, Message: "Product not found"}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, checkProductRole(tx, id, c.userID, role, true)
+}
+
+// syncBatchSearch brings the search index in line with a committed
+// operation.
+func syncBatchSearch(result batchResult) {
+	if result.Op != "delete" {
+		reindexProduct(result.ID)
+		return
+	}
+	if err := search.Default.Remove(result.ID); err != nil {
+		fmt.Printf("Error removing product %d from search: %v\n", result.ID, err)
+	}
+}
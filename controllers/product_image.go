@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"loginApi/config"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/storage"
+	"loginApi/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImagePixels guards against decompression bombs: small files that
+// decode into enormous bitmaps.
+const maxImagePixels = 40_000_000
+
+// allowedImageTypes maps sniffed content types to the extension we store.
+var allowedImageTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+func UploadProductImage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/upload/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	// Check if the user may edit the product
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	maxBytes := config.App.Storage.MaxUploadBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20) // room for multipart headers
+	err = r.ParseMultipartForm(maxBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Upload must be a multipart form of at most %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		fmt.Printf("Error parsing multipart form: %v\n", err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "The image field is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxBytes {
+		http.Error(w, fmt.Sprintf("Image must be at most %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read image", http.StatusBadRequest)
+		fmt.Printf("Error reading upload: %v\n", err)
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type or file name
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		http.Error(w, "Only JPEG, PNG and GIF images are allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	imgConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Image could not be decoded", http.StatusBadRequest)
+		return
+	}
+	if imgConfig.Width*imgConfig.Height > maxImagePixels {
+		http.Error(w, "Image dimensions are too large", http.StatusBadRequest)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		http.Error(w, "Image could not be decoded", http.StatusBadRequest)
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(12)
+	if err != nil {
+		http.Error(w, "Failed to generate storage key", http.StatusInternalServerError)
+		return
+	}
+	prefix := fmt.Sprintf("products/%d/%s", productID, token)
+
+	// JPEG thumbnails for photos; PNG keeps transparency for everything else
+	thumbExt, thumbType := "png", "image/png"
+	if contentType == "image/jpeg" {
+		thumbExt, thumbType = "jpg", "image/jpeg"
+	}
+
+	ctx := r.Context()
+	var stored []string
+	cleanup := func() {
+		for _, key := range stored {
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				fmt.Printf("Error removing %s after failed upload: %v\n", key, err)
+			}
+		}
+	}
+
+	originalKey := fmt.Sprintf("%s/original.%s", prefix, ext)
+	err = storage.Default.Put(ctx, originalKey, bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		http.Error(w, "Failed to store image", http.StatusInternalServerError)
+		fmt.Printf("Error storing %s: %v\n", originalKey, err)
+		return
+	}
+	stored = append(stored, originalKey)
+
+	var sizeNames []string
+	for _, size := range config.App.Storage.ThumbnailSizes {
+		thumb := helpers.ResizeToWidth(img, size.Width)
+
+		var buf bytes.Buffer
+		if thumbExt == "jpg" {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, thumb)
+		}
+		if err != nil {
+			cleanup()
+			http.Error(w, "Failed to generate thumbnail", http.StatusInternalServerError)
+			fmt.Printf("Error encoding %s thumbnail: %v\n", size.Name, err)
+			return
+		}
+
+		key := fmt.Sprintf("%s/%s.%s", prefix, size.Name, thumbExt)
+		err = storage.Default.Put(ctx, key, &buf, int64(buf.Len()), thumbType)
+		if err != nil {
+			cleanup()
+			http.Error(w, "Failed to store thumbnail", http.StatusInternalServerError)
+			fmt.Printf("Error storing %s: %v\n", key, err)
+			return
+		}
+		stored = append(stored, key)
+		sizeNames = append(sizeNames, size.Name)
+	}
+
+	now := time.Now()
+	query := "INSERT INTO product_images (product_id, storage_prefix, original_ext, thumb_ext, thumb_sizes, content_type, width, height, size_bytes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := database.DB.Exec(query, productID, prefix, ext, thumbExt, strings.Join(sizeNames, ","), contentType, imgConfig.Width, imgConfig.Height, len(data), now)
+	if err != nil {
+		cleanup()
+		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+
+	productImage := buildProductImage(int(id), productID, prefix, ext, thumbExt, strings.Join(sizeNames, ","), contentType, imgConfig.Width, imgConfig.Height, now)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"image": productImage})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// loadProductImages fetches the images of several products in one query,
+// grouped by product ID.
+func loadProductImages(productIDs []int) (map[int][]models.ProductImage, error) {
+	images := map[int][]models.ProductImage{}
+	if len(productIDs) == 0 {
+		return images, nil
+	}
+
+	placeholders, args := helpers.InPlaceholders(productIDs)
+	query := fmt.Sprintf("SELECT id, product_id, storage_prefix, original_ext, thumb_ext, thumb_sizes, content_type, width, height, created_at FROM product_images WHERE product_id IN (%s) ORDER BY id", placeholders)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, productID, width, height int
+		var prefix, ext, thumbExt, sizes, contentType string
+		var createdAt []byte
+
+		err := rows.Scan(&id, &productID, &prefix, &ext, &thumbExt, &sizes, &contentType, &width, &height, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+
+		images[productID] = append(images[productID], buildProductImage(id, productID, prefix, ext, thumbExt, sizes, contentType, width, height, created))
+	}
+
+	return images, rows.Err()
+}
+
+func buildProductImage(id, productID int, prefix, ext, thumbExt, sizes, contentType string, width, height int, createdAt time.Time) models.ProductImage {
+	productImage := models.ProductImage{
+		ID:          id,
+		Product_id:  productID,
+		URL:         storage.Default.URL(fmt.Sprintf("%s/original.%s", prefix, ext)),
+		Thumbnails:  map[string]string{},
+		ContentType: contentType,
+		Width:       width,
+		Height:      height,
+		Created_at:  createdAt,
+	}
+
+	for _, name := range strings.Split(sizes, ",") {
+		if name != "" {
+			productImage.Thumbnails[name] = storage.Default.URL(fmt.Sprintf("%s/%s.%s", prefix, name, thumbExt))
+		}
+	}
+
+	return productImage
+}
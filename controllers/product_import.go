@@ -0,0 +1,593 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"loginApi/config"
+	"loginApi/database"
+	"loginApi/models"
+	"loginApi/money"
+	"loginApi/spreadsheet"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxImportBytes  = 50 << 20
+	maxImportErrors = 1000
+	maxSKULength    = 64
+)
+
+const skuRules = "SKU must be at most 64 characters and contain no whitespace"
+
+// productColumns are the columns exports write and imports accept. Imports
+// match rows on sku and ignore id; category is looked up by name or slug,
+// with category_id as the alternative.
+var productColumns = []string{"id", "sku", "name", "price", "currency", "category", "category_id", "stock", "low_stock_threshold", "status"}
+
+// normalizeSKU trims sku and checks it. An empty SKU becomes nil, which
+// clears it.
+func normalizeSKU(sku string) (*string, bool) {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return nil, true
+	}
+	if len(sku) > maxSKULength || strings.IndexFunc(sku, unicode.IsSpace) >= 0 {
+		return nil, false
+	}
+	return &sku, true
+}
+
+// importFormat picks the file format from ?format=, falling back to the
+// request's Content-Type, or "" if neither names one.
+func importFormat(r *http.Request) string {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		return spreadsheet.FormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if _, ok := spreadsheet.ContentTypes[format]; !ok {
+		return ""
+	}
+	return format
+}
+
+type importRowError struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku,omitempty"`
+	Error string `json:"error"`
+}
+
+// importReport tallies an import as it runs. Only the first
+// maxImportErrors row errors are kept; failed counts them all.
+type importReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Failed    int              `json:"failed"`
+	Errors    []importRowError `json:"errors"`
+	Truncated bool             `json:"errors_truncated"`
+}
+
+func (report *importReport) fail(row int, sku, message string) {
+	report.Failed++
+	if len(report.Errors) < maxImportErrors {
+		report.Errors = append(report.Errors, importRowError{Row: row, SKU: sku, Error: message})
+	} else {
+		report.Truncated = true
+	}
+}
+
+// rowProblem is a validation failure in one import row; its text goes into
+// the report as is.
+type rowProblem string
+
+func (p rowProblem) Error() string {
+	return string(p)
+}
+
+// categoryLookup resolves the category column of an import, by name or
+// slug ignoring case. Names need not be unique across the tree, so a name
+// shared by several categories is refused rather than guessed.
+type categoryLookup struct {
+	byName map[string][]int
+	byID   map[int]bool
+}
+
+func loadCategoryLookup() (*categoryLookup, error) {
+	rows, err := database.DB.Query("SELECT id, name, slug FROM categories WHERE deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lookup := &categoryLookup{byName: map[string][]int{}, byID: map[int]bool{}}
+	for rows.Next() {
+		var id int
+		var name, slug string
+		if err := rows.Scan(&id, &name, &slug); err != nil {
+			return nil, err
+		}
+		lookup.byID[id] = true
+		key := strings.ToLower(strings.TrimSpace(name))
+		lookup.byName[key] = append(lookup.byName[key], id)
+		if slugKey := strings.ToLower(slug); slugKey != key {
+			lookup.byName[slugKey] = append(lookup.byName[slugKey], id)
+		}
+	}
+	return lookup, rows.Err()
+}
+
+func (lookup *categoryLookup) resolve(values map[string]string) (int, error) {
+	if name := strings.TrimSpace(values["category"]); name != "" {
+		ids := lookup.byName[strings.ToLower(name)]
+		switch len(ids) {
+		case 0:
+			return 0, rowProblem(fmt.Sprintf("Category %q not found", name))
+		case 1:
+			return ids[0], nil
+		}
+		return 0, rowProblem(fmt.Sprintf("Category %q matches %d categories; use category_id", name, len(ids)))
+	}
+
+	id, present, err := importInt(values, "category_id")
+	if err != nil || !present {
+		return 0, err
+	}
+	if !lookup.byID[id] {
+		return 0, rowProblem("Category not found")
+	}
+	return id, nil
+}
+
+// importInt parses an optional whole-number column.
+func importInt(values map[string]string, column string) (int, bool, error) {
+	text := strings.TrimSpace(values[column])
+	if text == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, false, rowProblem(fmt.Sprintf("%s must be a whole number", column))
+	}
+	return n, true, nil
+}
+
+// ImportProducts serves POST /import/products. The body is a CSV, JSON
+// Lines or XLSX file (chosen by ?format= or Content-Type) with one product
+// per row. Rows are matched to the caller's products, or with ?shop_id=
+// to the shop's, by sku: new SKUs are created, known ones updated with the
+// columns that are filled in. Each row is applied on its own, so a bad row
+// is reported and skipped without holding up the rest. With ?dry_run=true
+// every row is validated against the database and then rolled back.
+func ImportProducts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, ok := requestCatalog(w, r, userID, models.ShopEditor)
+	if !ok {
+		return
+	}
+
+	format := importFormat(r)
+	if format == "" {
+		http.Error(w, "Format must be csv, jsonl or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	// Workbooks are zip archives, read from the end; spool them to disk
+	// rather than holding them in memory
+	if format == spreadsheet.XLSX {
+		spool, err := os.CreateTemp("", "import-*.xlsx")
+		if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+			fmt.Printf("Error creating temp file: %v\n", err)
+			return
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		_, err = io.Copy(spool, body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("File must be at most %d bytes", maxImportBytes), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			fmt.Printf("Error reading upload: %v\n", err)
+			return
+		}
+		body = spool
+	}
+
+	reader, err := spreadsheet.NewReader(format, body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid %s file: %v", format, err), http.StatusBadRequest)
+		return
+	}
+
+	if columns := reader.Columns(); columns != nil {
+		if column := unknownImportColumn(columns); column != "" {
+			http.Error(w, fmt.Sprintf("Unknown column %q", column), http.StatusBadRequest)
+			return
+		}
+		if !containsString(columns, "sku") {
+			http.Error(w, "The file must have a sku column", http.StatusBadRequest)
+			return
+		}
+	}
+
+	categories, err := loadCategoryLookup()
+	if err != nil {
+		http.Error(w, "Failed to load categories", http.StatusInternalServerError)
+		fmt.Printf("Error loading categories: %v\n", err)
+		return
+	}
+
+	report := importReport{DryRun: r.URL.Query().Get("dry_run") == "true", Errors: []importRowError{}}
+	seen := map[string]int{}
+	var stopped error
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *spreadsheet.RowError
+		if errors.As(err, &rowErr) {
+			report.fail(rowErr.Line, "", rowErr.Err.Error())
+			continue
+		} else if err != nil {
+			stopped = err
+			break
+		}
+
+		if column := unknownImportColumn(columnNames(record.Values)); column != "" {
+			report.fail(record.Line, "", fmt.Sprintf("Unknown column %q", column))
+			continue
+		}
+
+		sku, ok := normalizeSKU(record.Values["sku"])
+		if !ok {
+			report.fail(record.Line, record.Values["sku"], skuRules)
+			continue
+		}
+		if sku == nil {
+			report.fail(record.Line, "", "sku is required")
+			continue
+		}
+		if line, dup := seen[*sku]; dup {
+			report.fail(record.Line, *sku, fmt.Sprintf("SKU already appears on line %d", line))
+			continue
+		}
+		seen[*sku] = record.Line
+
+		action, err := importProductRow(c, *sku, record.Values, categories, report.DryRun)
+		var problem rowProblem
+		if errors.As(err, &problem) {
+			report.fail(record.Line, *sku, problem.Error())
+			continue
+		} else if err != nil {
+			report.fail(record.Line, *sku, "Failed to import row")
+			fmt.Printf("Error importing line %d: %v\n", record.Line, err)
+			continue
+		}
+
+		switch action {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+	}
+
+	// Rows already applied stay applied when the file turns out to be
+	// broken further down; the report says how far the import got
+	status := http.StatusOK
+	response := map[string]interface{}{
+		"import": report,
+	}
+	if stopped != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(stopped, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+			response["error"] = fmt.Sprintf("File must be at most %d bytes; rows after the limit were not read", maxImportBytes)
+		} else {
+			status = http.StatusBadRequest
+			response["error"] = fmt.Sprintf("Invalid %s file, import stopped: %v", format, stopped)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func unknownImportColumn(columns []string) string {
+	for _, column := range columns {
+		if column != "" && !containsString(productColumns, column) {
+			return column
+		}
+	}
+	return ""
+}
+
+func columnNames(values map[string]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	return names
+}
+
+// importProductRow creates or updates the product with the given SKU in
+// catalog c from one row, in its own transaction, and reports "created",
+// "updated" or "unchanged". Validation failures are rowProblems.
+func importProductRow(c catalog, sku string, values map[string]string, categories *categoryLookup, dryRun bool) (string, error) {
+	price, hasPrice, err := importInt(values, "price")
+	if err != nil {
+		return "", err
+	}
+	if hasPrice && price <= 0 {
+		return "", rowProblem("price must be greater than zero")
+	}
+
+	stock, hasStock, err := importInt(values, "stock")
+	if err != nil {
+		return "", err
+	}
+	threshold, hasThreshold, err := importInt(values, "low_stock_threshold")
+	if err != nil {
+		return "", err
+	}
+	if stock < 0 || threshold < 0 {
+		return "", rowProblem("stock and low_stock_threshold must not be negative")
+	}
+
+	categoryID, err := categories.resolve(values)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(values["name"])
+	status := strings.ToLower(strings.TrimSpace(values["status"]))
+	currency := strings.TrimSpace(values["currency"])
+	if currency != "" {
+		currency, err = money.NormalizeCurrency(currency)
+		if err != nil {
+			return "", rowProblem("currency must be a supported ISO 4217 code")
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var existing models.Product
+	condition, args := c.condition("")
+	query := "SELECT id, name, price, currency, category_id, stock, low_stock_threshold, status, deleted_at FROM products WHERE " + condition + " AND sku = ? FOR UPDATE"
+	err = tx.QueryRow(query, append(args, sku)...).Scan(&existing.ID, &existing.Name, &existing.Price, &existing.Currency, &existing.Category_id, &existing.Stock, &existing.Low_stock_threshold, &existing.Status, &existing.Deleted_at)
+
+	action := "updated"
+	var productID int
+	if err == sql.ErrNoRows {
+		action = "created"
+		productID, err = importNewProduct(tx, c, sku, name, price, currency, categoryID, stock, threshold, status)
+	} else if err == nil {
+		productID = existing.ID
+		var changed bool
+		changed, err = importExistingProduct(tx, c.userID, existing, name, price, currency, categoryID, stock, hasStock, threshold, hasThreshold, status)
+		if err == nil && !changed {
+			action = "unchanged"
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if dryRun || action == "unchanged" {
+		return action, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+	reindexProduct(productID)
+	return action, nil
+}
+
+func importNewProduct(tx *sql.Tx, c catalog, sku, name string, price int, currency string, categoryID, stock, threshold int, status string) (int, error) {
+	if name == "" || price <= 0 || categoryID <= 0 {
+		return 0, rowProblem("name, price and category are required for new products")
+	}
+	if currency == "" {
+		currency = config.App.Money.DefaultCurrency
+	}
+	if status == "" {
+		status = models.ProductDraft
+	}
+	if status != models.ProductDraft && status != models.ProductPublished {
+		return 0, rowProblem("status must be draft or published for new products")
+	}
+
+	query := "INSERT INTO products (sku, name, price, currency, user_id, shop_id, category_id, low_stock_threshold, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL)"
+	result, err := tx.Exec(query, sku, name, price, currency, c.userID, c.shopID, categoryID, threshold, status, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if stock > 0 {
+		_, err = applyStockMovement(tx, int(id), c.userID, "restock", stock, "Bulk import")
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(id), nil
+}
+
+// importExistingProduct applies the filled-in columns that differ from the
+// product. A different stock is booked as an adjustment, and a different
+// status must be an allowed transition; changing status drops any publish
+// schedule, as /status/products/{id} does.
+func importExistingProduct(tx *sql.Tx, userID int, existing models.Product, name string, price int, currency string, categoryID, stock int, hasStock bool, threshold int, hasThreshold bool, status string) (bool, error) {
+	if existing.Deleted_at.Valid {
+		return false, rowProblem("A product with this SKU is in the trash; restore it first")
+	}
+
+	var setClauses []string
+	var args []interface{}
+
+	if name != "" && name != existing.Name {
+		setClauses = append(setClauses, "name = ?")
+		args = append(args, name)
+	}
+	if price > 0 && price != existing.Price {
+		setClauses = append(setClauses, "price = ?")
+		args = append(args, price)
+	}
+	if currency != "" && currency != existing.Currency {
+		if price <= 0 {
+			return false, rowProblem("price is required when changing currency")
+		}
+		setClauses = append(setClauses, "currency = ?")
+		args = append(args, currency)
+	}
+	if categoryID > 0 && categoryID != existing.Category_id {
+		setClauses = append(setClauses, "category_id = ?")
+		args = append(args, categoryID)
+	}
+	if hasThreshold && threshold != *existing.Low_stock_threshold {
+		setClauses = append(setClauses, "low_stock_threshold = ?")
+		args = append(args, threshold)
+	}
+	if status != "" && status != existing.Status {
+		if !containsString(productTransitions[existing.Status], status) {
+			return false, rowProblem(fmt.Sprintf("A %s product cannot become %s", existing.Status, status))
+		}
+		setClauses = append(setClauses, "status = ?", "publish_at = NULL")
+		args = append(args, status)
+	}
+
+	changed := false
+	if len(setClauses) > 0 {
+		setClauses = append(setClauses, "updated_at = ?", "version = version + 1")
+		args = append(args, time.Now(), existing.ID)
+		query := fmt.Sprintf("UPDATE products SET %s WHERE id = ?", strings.Join(setClauses, ", "))
+		_, err := tx.Exec(query, args...)
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if hasStock && stock != existing.Stock {
+		_, err := applyStockMovement(tx, existing.ID, userID, "adjustment", stock-existing.Stock, "Bulk import")
+		if err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// ExportProducts serves GET /export/products?format=csv|jsonl|xlsx with the
+// caller's products, or with ?shop_id= the shop's, in the columns imports
+// accept, so an export can be edited and imported back. Rows are written
+// as they are read from the database; the catalog is never held in memory.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = spreadsheet.CSV
+	}
+	if _, ok := spreadsheet.ContentTypes[format]; !ok {
+		http.Error(w, "Format must be csv, jsonl or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	products, ok := requestCatalog(w, r, userID, models.ShopEditor)
+	if !ok {
+		return
+	}
+
+	condition, args := products.condition("p.")
+	query := `SELECT p.id, p.sku, p.name, p.price, p.currency, c.name, p.category_id, p.stock, p.low_stock_threshold, p.status
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id
+		WHERE ` + condition + ` AND p.deleted_at IS NULL
+		ORDER BY p.id`
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", spreadsheet.ContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="products-%s.%s"`, time.Now().Format("20060102"), format))
+	w.WriteHeader(http.StatusOK)
+
+	// Once the header is out, failures can only cut the file short
+	writer, err := spreadsheet.NewWriter(format, w)
+	if err == nil {
+		err = writer.WriteHeader(productColumns)
+	}
+	for err == nil && rows.Next() {
+		var id, price, categoryID, stock, threshold int64
+		var sku, categoryName sql.NullString
+		var name, currency, status string
+		err = rows.Scan(&id, &sku, &name, &price, &currency, &categoryName, &categoryID, &stock, &threshold, &status)
+		if err != nil {
+			break
+		}
+		err = writer.WriteRow([]interface{}{id, nullableString(sku), name, price, currency, nullableString(categoryName), categoryID, stock, threshold, status})
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		fmt.Printf("Error exporting products: %v\n", err)
+	}
+}
+
+func nullableString(s sql.NullString) interface{} {
+	if !s.Valid {
+		return nil
+	}
+	return s.String
+}
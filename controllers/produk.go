@@ -3,16 +3,158 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"loginApi/config"
 	"loginApi/database"
 	"loginApi/helpers"
 	"loginApi/models"
+	"loginApi/money"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// productError is a failed product check, carrying the status and message
+// the handlers answer with. Field names the offending field of a
+// uniqueness conflict.
+type productError struct {
+	Status  int
+	Field   string
+	Message string
+}
+
+func (e *productError) Error() string {
+	return e.Message
+}
+
+// writeProductError answers with err if it is a productError, or with a
+// 500 and the failure message otherwise.
+func writeProductError(w http.ResponseWriter, err error, failure string) {
+	var perr *productError
+	if errors.As(err, &perr) {
+		if perr.Field != "" {
+			writeConflict(w, perr.Field, perr.Message)
+			return
+		}
+		http.Error(w, perr.Message, perr.Status)
+		return
+	}
+	http.Error(w, failure, http.StatusInternalServerError)
+	fmt.Printf("%s: %v\n", failure, err)
+}
+
+// productStore runs the product write queries, on the database for a
+// single request or on a transaction for a batch.
+type productStore interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// validateNewProduct checks a product about to be created and fills in its
+// defaults.
+func validateNewProduct(q rowQueryer, product *models.Product) error {
+	if product.Name == "" || product.Price <= 0 || product.Category_id <= 0 {
+		fmt.Printf("Validation failed: Name=%s, Price=%d, Category_id=%d\n", product.Name, product.Price, product.Category_id)
+		return &productError{Status: http.StatusBadRequest, Message: "All fields are required and must be valid"}
+	}
+
+	if product.Stock < 0 || (product.Low_stock_threshold != nil && *product.Low_stock_threshold < 0) {
+		return &productError{Status: http.StatusBadRequest, Message: "Stock and low_stock_threshold must not be negative"}
+	}
+	if product.Low_stock_threshold == nil {
+		product.Low_stock_threshold = new(int)
+	}
+
+	var err error
+	if product.Currency == "" {
+		product.Currency = config.App.Money.DefaultCurrency
+	}
+	product.Currency, err = money.NormalizeCurrency(product.Currency)
+	if err != nil {
+		return &productError{Status: http.StatusBadRequest, Message: "Currency must be a supported ISO 4217 code"}
+	}
+
+	if product.SKU != nil {
+		sku, ok := normalizeSKU(*product.SKU)
+		if !ok {
+			return &productError{Status: http.StatusBadRequest, Message: skuRules}
+		}
+		product.SKU = sku
+	}
+
+	// New products are drafts unless published straight away
+	if product.Status == "" {
+		product.Status = models.ProductDraft
+	}
+	if product.Status != models.ProductDraft && product.Status != models.ProductPublished {
+		return &productError{Status: http.StatusBadRequest, Message: "Status must be draft or published"}
+	}
+	if err := checkPublishAt(product.Status, product.Publish_at); err != nil {
+		return err
+	}
+
+	return checkCategoryExists(q, product.Category_id)
+}
+
+// checkCategoryExists checks that categoryID names a category outside the
+// trash.
+func checkCategoryExists(q rowQueryer, categoryID int) error {
+	var exists bool
+	query := "SELECT EXISTS(SELECT 1 FROM categories WHERE id = ? AND deleted_at IS NULL)"
+	err := q.QueryRow(query, categoryID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("checking category existence: %w", err)
+	}
+
+	if !exists {
+		fmt.Printf("Validation failed: Category_id=%d not found\n", categoryID)
+		return &productError{Status: http.StatusBadRequest, Message: "Category not found"}
+	}
+	return nil
+}
+
+// insertProduct stores a validated product for userID, or for the shop it
+// names if userID is at least an editor there, and returns its ID. Stock
+// starts at zero and the initial quantity is booked as a restock so the
+// movement log adds up.
+func insertProduct(tx *sql.Tx, userID int, product *models.Product) (int, error) {
+	if product.Shop_id != nil {
+		err := checkShopRole(tx, *product.Shop_id, userID, models.ShopEditor)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	product.Created_at = time.Now()
+	product.Updated_at = sql.NullTime{Valid: false} // Set Updated_at to NULL
+	product.User_id = userID
+
+	query := "INSERT INTO products (sku, name, price, currency, user_id, shop_id, category_id, low_stock_threshold, status, publish_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, product.SKU, product.Name, product.Price, product.Currency, product.User_id, product.Shop_id, product.Category_id, product.Low_stock_threshold, product.Status, product.Publish_at, product.Created_at, product.Updated_at)
+	if _, ok := database.DuplicateKey(err); ok {
+		return 0, &productError{Status: http.StatusConflict, Field: "sku", Message: "You already have a product with this SKU"}
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Retrieve the last insert ID
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	product.ID = int(id)
+
+	if product.Stock > 0 {
+		_, err = applyStockMovement(tx, product.ID, userID, "restock", product.Stock, "Initial stock")
+		if err != nil {
+			return 0, fmt.Errorf("recording initial stock: %w", err)
+		}
+	}
+	return product.ID, nil
+}
+
 func CreateProduct(w http.ResponseWriter, r *http.Request) {
 	// Get the userID from the context
 	userID := r.Context().Value("userID").(int)
@@ -28,49 +170,34 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
-	if product.Name == "" || product.Price <= 0 || product.Category_id <= 0 {
-		http.Error(w, "All fields are required and must be valid", http.StatusBadRequest)
-		fmt.Printf("Validation failed: Name=%s, Price=%d, Category_id=%d\n", product.Name, product.Price, product.Category_id)
+	err = validateNewProduct(database.DB, &product)
+	if err != nil {
+		writeProductError(w, err, "Failed to check category existence")
 		return
 	}
 
-	// Check if category_id exists in categories table
-	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?)"
-	err = database.DB.QueryRow(query, product.Category_id).Scan(&exists)
+	tx, err := database.DB.Begin()
 	if err != nil {
-		http.Error(w, "Failed to check category existence", http.StatusInternalServerError)
-		fmt.Printf("Error checking category existence: %v\n", err)
+		http.Error(w, "Failed to create product", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
 		return
 	}
+	defer tx.Rollback()
 
-	if !exists {
-		http.Error(w, "Category not found", http.StatusBadRequest)
-		fmt.Printf("Validation failed: Category_id=%d not found\n", product.Category_id)
+	id, err := insertProduct(tx, userID, &product)
+	if err != nil {
+		writeProductError(w, err, "Failed to create product")
 		return
 	}
 
-	// Set creation and update times
-	now := time.Now()
-	product.Created_at = now
-	product.Updated_at = sql.NullTime{Valid: false} // Set Updated_at to NULL
-	product.User_id = userID
-
-	// SQL query to insert product
-	query = "INSERT INTO products (name, price, user_id, category_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)"
-	result, err := database.DB.Exec(query, product.Name, product.Price, product.User_id, product.Category_id, product.Created_at, product.Updated_at)
+	err = tx.Commit()
 	if err != nil {
 		http.Error(w, "Failed to create product", http.StatusInternalServerError)
-		fmt.Printf("Error executing query: %v\n", err)
+		fmt.Printf("Error committing transaction: %v\n", err)
 		return
 	}
 
-	// Retrieve the last insert ID
-	id, err := result.LastInsertId()
-	if err != nil {
-		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
-		return
-	}
+	reindexProduct(id)
 
 	// Respond with success
 	w.WriteHeader(http.StatusCreated)
@@ -78,8 +205,86 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetProduct(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, name, price, category_id, created_at, updated_at FROM products"
-	rows, err := database.DB.Query(query)
+	currency, locale, err := requestedDisplay(r)
+	if err != nil {
+		http.Error(w, "Currency must be a supported ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	query := "SELECT id, sku, version, name, price, currency, user_id, shop_id, category_id, stock, low_stock_threshold, status, publish_at, rating_avg, rating_count, created_at, updated_at, deleted_at FROM products"
+	var conditions []string
+	var args []interface{}
+	if !withDeleted {
+		// Administrators looking at the trash see every status too
+		visibility, visibilityArgs := productVisibility(r)
+		conditions = append(conditions, "deleted_at IS NULL", visibility)
+		args = append(args, visibilityArgs...)
+	}
+
+	// ?category_id= also lists products in the category's subcategories
+	if idStr := r.URL.Query().Get("category_id"); idStr != "" {
+		categoryID, err := strconv.Atoi(idStr)
+		if err != nil || categoryID <= 0 {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+
+		categoryIDs, err := categoryDescendants(database.DB, categoryID)
+		if err != nil {
+			http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+			fmt.Printf("Error fetching subcategories: %v\n", err)
+			return
+		}
+		if len(categoryIDs) == 0 {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+
+		placeholders, categoryArgs := helpers.InPlaceholders(categoryIDs)
+		conditions = append(conditions, fmt.Sprintf("category_id IN (%s)", placeholders))
+		args = append(args, categoryArgs...)
+	}
+
+	tagCondition, tagArgs, err := tagFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if tagCondition != "" {
+		conditions = append(conditions, tagCondition)
+		args = append(args, tagArgs...)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// ?sort=rating lists the best rated first; ?order=asc reverses it.
+	// Products with no reviews come last either way.
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case "rating":
+		direction := "DESC"
+		switch r.URL.Query().Get("order") {
+		case "", "desc":
+		case "asc":
+			direction = "ASC"
+		default:
+			http.Error(w, "Order must be asc or desc", http.StatusBadRequest)
+			return
+		}
+		query += fmt.Sprintf(" ORDER BY rating_count = 0, rating_avg %s, rating_count DESC, id", direction)
+	default:
+		http.Error(w, "Sort must be rating", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
 		fmt.Printf("Error executing query: %v\n", err)
@@ -91,16 +296,25 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var product models.Product
+		var publishAt []byte
 		var createdAt []byte
 		var updatedAt []byte
+		var deletedAt []byte
 
-		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Category_id, &createdAt, &updatedAt)
+		err := rows.Scan(&product.ID, &product.SKU, &product.Version, &product.Name, &product.Price, &product.Currency, &product.User_id, &product.Shop_id, &product.Category_id, &product.Stock, &product.Low_stock_threshold, &product.Status, &publishAt, &product.Rating_avg, &product.Rating_count, &createdAt, &updatedAt, &deletedAt)
 		if err != nil {
 			http.Error(w, "Failed to scan product", http.StatusInternalServerError)
 			fmt.Printf("Error scanning row: %v\n", err)
 			return
 		}
 
+		product.Publish_at, err = helpers.ParseOptionalDatetime(publishAt)
+		if err != nil {
+			http.Error(w, "Failed to parse publish_at", http.StatusInternalServerError)
+			fmt.Printf("Error parsing publish_at: %v\n", err)
+			return
+		}
+
 		// Parse created_at
 		product.Created_at, err = helpers.ParseDatetime(createdAt)
 		if err != nil {
@@ -117,6 +331,13 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		product.Deleted_at, err = helpers.ParseNullableDatetime(deletedAt)
+		if err != nil {
+			http.Error(w, "Failed to parse deleted_at", http.StatusInternalServerError)
+			fmt.Printf("Error parsing deleted_at: %v\n", err)
+			return
+		}
+
 		products = append(products, product)
 	}
 
@@ -126,6 +347,48 @@ func GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Attach images for the whole page in one query
+	productIDs := make([]int, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+	images, err := loadProductImages(productIDs)
+	if err != nil {
+		http.Error(w, "Failed to fetch product images", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product images: %v\n", err)
+		return
+	}
+	for i := range products {
+		products[i].Images = images[products[i].ID]
+		if products[i].Images == nil {
+			products[i].Images = []models.ProductImage{}
+		}
+	}
+
+	err = attachTagsToProducts(products)
+	if err != nil {
+		http.Error(w, "Failed to fetch product tags", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product tags: %v\n", err)
+		return
+	}
+
+	err = markFavorites(r, products)
+	if err != nil {
+		http.Error(w, "Failed to fetch wishlists", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlists: %v\n", err)
+		return
+	}
+
+	if currency != "" {
+		for i := range products {
+			err = convertProductPrice(&products[i], currency, locale)
+			if err != nil {
+				writeConversionError(w, currency, err)
+				return
+			}
+		}
+	}
+
 	// Wrap products in a map
 	response := map[string]interface{}{
 		"products": products,
@@ -155,20 +418,20 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the product belongs to the user
-	var existingUserID int
-	err = database.DB.QueryRow("SELECT user_id FROM products WHERE id = ?", id).Scan(&existingUserID)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	// Patch documents get PATCH semantics; plain JSON keeps the older
+	// rule that zero values are left alone
+	if patchType(r) != "" {
+		PatchProduct(w, r, id)
 		return
-	} else if err != nil {
-		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
-		fmt.Printf("Error fetching product: %v\n", err)
+	}
+
+	// Check if the product belongs to the user
+	if !authorizeProduct(w, id, userID, models.ShopEditor) {
 		return
 	}
 
-	if existingUserID != userID {
-		http.Error(w, "Unauthorized: You do not own this product", http.StatusUnauthorized)
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
 		return
 	}
 
@@ -180,17 +443,41 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = updateProduct(database.DB, id, versions, &product)
+	if err != nil {
+		writeProductError(w, err, "Failed to update product")
+		return
+	}
+
+	reindexProduct(id)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Product updated successfully")
+}
+
+// updateProduct applies the non-zero fields of product, and the pointer
+// fields that are present, to product id, whose access the caller has
+// checked, provided it is at one of versions (any version if nil).
+func updateProduct(store productStore, id int, versions []int, product *models.Product) error {
+	// Stock only moves through /stock/products/{id} so every change is logged
+	if product.Stock != 0 {
+		return &productError{Status: http.StatusBadRequest, Message: "Stock cannot be set directly; record a stock movement instead"}
+	}
+
+	// Status changes go through /status/products/{id} so transitions are checked
+	if product.Status != "" || product.Publish_at != nil {
+		return &productError{Status: http.StatusBadRequest, Message: "Status cannot be updated here; use /status/products/{id}"}
+	}
+
+	// So does ownership, through /transfer/products/{id}
+	if product.Shop_id != nil {
+		return &productError{Status: http.StatusBadRequest, Message: "Ownership cannot be changed here; use /transfer/products/{id}"}
+	}
+
 	if product.Category_id > 0 {
-		var categoryExists bool
-		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE id = ?)", product.Category_id).Scan(&categoryExists)
+		err := checkCategoryExists(store, product.Category_id)
 		if err != nil {
-			http.Error(w, "Failed to validate category ID", http.StatusInternalServerError)
-			fmt.Printf("Error checking category ID: %v\n", err)
-			return
-		}
-		if !categoryExists {
-			http.Error(w, "Category not found", http.StatusBadRequest)
-			return
+			return err
 		}
 	}
 
@@ -198,6 +485,15 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	var setClauses []string
 	var args []interface{}
 
+	if product.SKU != nil {
+		sku, ok := normalizeSKU(*product.SKU)
+		if !ok {
+			return &productError{Status: http.StatusBadRequest, Message: skuRules}
+		}
+		setClauses = append(setClauses, "sku = ?")
+		args = append(args, sku)
+	}
+
 	if product.Name != "" {
 		setClauses = append(setClauses, "name = ?")
 		args = append(args, product.Name)
@@ -208,47 +504,209 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		args = append(args, product.Price)
 	}
 
+	if product.Currency != "" {
+		currency, err := money.NormalizeCurrency(product.Currency)
+		if err != nil {
+			return &productError{Status: http.StatusBadRequest, Message: "Currency must be a supported ISO 4217 code"}
+		}
+
+		// Prices are in minor units of the currency, so the old amount
+		// means something else in the new one
+		if product.Price <= 0 {
+			var current string
+			err = store.QueryRow("SELECT currency FROM products WHERE id = ? AND deleted_at IS NULL", id).Scan(&current)
+			if err == sql.ErrNoRows {
+				return &productError{Status: http.StatusNotFound, Message: "Product not found"}
+			} else if err != nil {
+				return err
+			}
+			if currency != current {
+				return errCurrencyWithoutPrice
+			}
+		}
+
+		setClauses = append(setClauses, "currency = ?")
+		args = append(args, currency)
+	}
+
 	if product.Category_id > 0 {
 		setClauses = append(setClauses, "category_id = ?")
 		args = append(args, product.Category_id)
 	}
 
-	// Set Updated_at to the current time if any fields are updated
-	if len(setClauses) > 0 {
-		now := time.Now()
-		setClauses = append(setClauses, "updated_at = ?")
-		args = append(args, sql.NullTime{Time: now, Valid: true})
+	if product.Low_stock_threshold != nil {
+		if *product.Low_stock_threshold < 0 {
+			return &productError{Status: http.StatusBadRequest, Message: "low_stock_threshold must not be negative"}
+		}
+		setClauses = append(setClauses, "low_stock_threshold = ?")
+		args = append(args, *product.Low_stock_threshold)
 	}
 
 	if len(setClauses) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
-		return
+		return &productError{Status: http.StatusBadRequest, Message: "No fields to update"}
 	}
 
+	// Set Updated_at to the current time if any fields are updated
+	now := time.Now()
+	setClauses = append(setClauses, "updated_at = ?", "version = version + 1")
+	args = append(args, sql.NullTime{Time: now, Valid: true})
+
 	// Build the final query
-	query := fmt.Sprintf("UPDATE products SET %s WHERE id = ?", strings.Join(setClauses, ", "))
-	args = append(args, id)
+	condition, conditionArgs := versionCondition(versions)
+	query := fmt.Sprintf("UPDATE products SET %s WHERE id = ? AND deleted_at IS NULL%s", strings.Join(setClauses, ", "), condition)
+	args = append(append(args, id), conditionArgs...)
 
 	// Execute the query
-	result, err := database.DB.Exec(query, args...)
+	result, err := store.Exec(query, args...)
+	if _, ok := database.DuplicateKey(err); ok {
+		return &productError{Status: http.StatusConflict, Field: "sku", Message: "You already have a product with this SKU"}
+	} else if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 && versions != nil {
+		return errVersionMismatch
+	} else if rowsAffected == 0 {
+		return &productError{Status: http.StatusNotFound, Message: "Product not found"}
+	}
+	return nil
+}
+
+// productPatch holds the fields a patch may change. Stock and status have
+// their own endpoints, which log and check their changes.
+type productPatch struct {
+	SKU                 *string `json:"sku"`
+	Name                string  `json:"name"`
+	Price               int     `json:"price"`
+	Currency            string  `json:"currency"`
+	Category_id         int     `json:"category_id"`
+	Low_stock_threshold int     `json:"low_stock_threshold"`
+}
+
+// PatchProduct serves PATCH /update/products/{id} with a merge patch or
+// JSON Patch. The patch applies to the product's current fields and the
+// outcome is validated as a whole, so a field is only ever changed, or
+// cleared, by saying so.
+func PatchProduct(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+	patch, mediaType, ok := readPatch(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := database.DB.Begin()
 	if err != nil {
 		http.Error(w, "Failed to update product", http.StatusInternalServerError)
-		fmt.Printf("Error executing query: %v\n", err)
+		fmt.Printf("Error starting transaction: %v\n", err)
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	err = checkProductRole(tx, id, userID, models.ShopEditor, true)
 	if err != nil {
-		http.Error(w, "Failed to check affected rows", http.StatusInternalServerError)
-		fmt.Printf("Error checking affected rows: %v\n", err)
+		writeProductError(w, err, "Failed to fetch product")
 		return
 	}
 
-	if rowsAffected == 0 {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	var version int
+	var current productPatch
+	query := "SELECT version, sku, name, price, currency, category_id, low_stock_threshold FROM products WHERE id = ?"
+	err = tx.QueryRow(query, id).Scan(&version, &current.SKU, &current.Name, &current.Price, &current.Currency, &current.Category_id, &current.Low_stock_threshold)
+	if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Product updated successfully")
+	if versions != nil && !containsInt(versions, version) {
+		http.Error(w, errVersionMismatch.Message, errVersionMismatch.Status)
+		return
+	}
+
+	var patched productPatch
+	if !applyPatch(w, mediaType, patch, current, &patched) {
+		return
+	}
+
+	err = validateProductPatch(tx, &patched)
+	if err != nil {
+		writeProductError(w, err, "Failed to validate product")
+		return
+	}
+	if patched.Currency != current.Currency && !patchTouches(mediaType, patch, "price") {
+		http.Error(w, errCurrencyWithoutPrice.Message, http.StatusUnprocessableEntity)
+		return
+	}
+
+	query = "UPDATE products SET sku = ?, name = ?, price = ?, currency = ?, category_id = ?, low_stock_threshold = ?, updated_at = ?, version = version + 1 WHERE id = ?"
+	_, err = tx.Exec(query, patched.SKU, patched.Name, patched.Price, patched.Currency, patched.Category_id, patched.Low_stock_threshold, time.Now(), id)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "sku", "You already have a product with this SKU")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to update product", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	reindexProduct(id)
+
+	writePatched(w, "product", id, version+1, patched)
+}
+
+// errCurrencyWithoutPrice rejects a currency change that would leave the
+// price, an amount in minor units of the old currency, as it was.
+var errCurrencyWithoutPrice = &productError{Status: http.StatusBadRequest, Message: "Changing the currency requires a price in the new currency"}
+
+// validateProductPatch checks a patched product with the rules products
+// are created under, normalizing its SKU and currency.
+func validateProductPatch(q rowQueryer, product *productPatch) error {
+	product.Name = strings.TrimSpace(product.Name)
+	if product.Name == "" || product.Price <= 0 {
+		return &productError{Status: http.StatusUnprocessableEntity, Message: "Name is required and price must be greater than zero"}
+	}
+	if product.Low_stock_threshold < 0 {
+		return &productError{Status: http.StatusUnprocessableEntity, Message: "low_stock_threshold must not be negative"}
+	}
+
+	currency, err := money.NormalizeCurrency(product.Currency)
+	if err != nil {
+		return &productError{Status: http.StatusUnprocessableEntity, Message: "Currency must be a supported ISO 4217 code"}
+	}
+	product.Currency = currency
+
+	if product.SKU != nil {
+		sku, ok := normalizeSKU(*product.SKU)
+		if !ok {
+			return &productError{Status: http.StatusUnprocessableEntity, Message: skuRules}
+		}
+		product.SKU = sku
+	}
+
+	if product.Category_id <= 0 {
+		return &productError{Status: http.StatusUnprocessableEntity, Message: "category_id is required"}
+	}
+	return checkCategoryExists(q, product.Category_id)
 }
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// productTransitions lists the statuses each status may move to.
+// Scheduling is a draft with publish_at set, not a status of its own.
+var productTransitions = map[string][]string{
+	models.ProductDraft:     {models.ProductPublished, models.ProductArchived},
+	models.ProductPublished: {models.ProductDraft, models.ProductArchived},
+	models.ProductArchived:  {models.ProductDraft},
+}
+
+func validProductStatus(status string) bool {
+	_, ok := productTransitions[status]
+	return ok
+}
+
+// ChangeProductStatus serves POST /status/products/{id} with
+// {"status": "...", "publish_at": "2006-01-02T15:04:05Z"}. publish_at
+// schedules a draft for publication and may only accompany status "draft";
+// omitting it from a draft clears any schedule.
+func ChangeProductStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/status/products/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Status     string     `json:"status"`
+		Publish_at *time.Time `json:"publish_at"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if !validProductStatus(input.Status) {
+		http.Error(w, "Status must be draft, published or archived", http.StatusBadRequest)
+		return
+	}
+	if !validPublishAt(w, input.Status, input.Publish_at) {
+		return
+	}
+
+	if !authorizeProduct(w, id, userID, models.ShopEditor) {
+		return
+	}
+
+	var current string
+	err = database.DB.QueryRow("SELECT status FROM products WHERE id = ?", id).Scan(&current)
+	if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	// Staying a draft is how a schedule is set or cleared
+	if input.Status != current || current != models.ProductDraft {
+		if !containsString(productTransitions[current], input.Status) {
+			http.Error(w, fmt.Sprintf("A %s product cannot become %s", current, input.Status), http.StatusConflict)
+			return
+		}
+	}
+
+	// The status check guards against a concurrent change since the read
+	result, err := database.DB.Exec("UPDATE products SET status = ?, publish_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND status = ? AND deleted_at IS NULL", input.Status, input.Publish_at, time.Now(), id, current)
+	if err != nil {
+		http.Error(w, "Failed to change status", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to check affected rows", http.StatusInternalServerError)
+		fmt.Printf("Error checking affected rows: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "The product changed in the meantime; try again", http.StatusConflict)
+		return
+	}
+
+	reindexProduct(id)
+
+	response := map[string]interface{}{
+		"product_id": id,
+		"status":     input.Status,
+		"publish_at": input.Publish_at,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// validPublishAt checks that publishAt, if given, schedules a draft in the
+// future. It writes the error response and returns false otherwise.
+func validPublishAt(w http.ResponseWriter, status string, publishAt *time.Time) bool {
+	if err := checkPublishAt(status, publishAt); err != nil {
+		http.Error(w, err.Message, err.Status)
+		return false
+	}
+	return true
+}
+
+// checkPublishAt is validPublishAt for callers that report errors
+// themselves.
+func checkPublishAt(status string, publishAt *time.Time) *productError {
+	if publishAt == nil {
+		return nil
+	}
+	if status != models.ProductDraft {
+		return &productError{Status: http.StatusBadRequest, Message: "publish_at can only be set on drafts"}
+	}
+	if !publishAt.After(time.Now()) {
+		return &productError{Status: http.StatusBadRequest, Message: "publish_at must be in the future"}
+	}
+	return nil
+}
+
+// productVisibility returns the SQL condition limiting products to those
+// the requester may see: published ones, plus their own and their shops'
+// in any status.
+func productVisibility(r *http.Request) (string, []interface{}) {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		return "(status = 'published' OR (shop_id IS NULL AND user_id = ?) OR shop_id IN (SELECT shop_id FROM shop_members WHERE user_id = ?))", []interface{}{userID, userID}
+	}
+	return "status = 'published'", nil
+}
+
+// canViewProduct is productVisibility for a single loaded product.
+func canViewProduct(r *http.Request, product models.Product) bool {
+	if product.Status == models.ProductPublished {
+		return true
+	}
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		return false
+	}
+	if product.Shop_id == nil {
+		return userID == product.User_id
+	}
+
+	err := checkShopRole(database.DB, *product.Shop_id, userID, models.ShopEditor)
+	var perr *productError
+	if err != nil && !errors.As(err, &perr) {
+		fmt.Printf("Error checking shop membership: %v\n", err)
+	}
+	return err == nil
+}
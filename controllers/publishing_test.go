@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"loginApi/database/dbtest"
+	"loginApi/models"
+	"loginApi/search"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProductTransitions(t *testing.T) {
+	statuses := []string{models.ProductDraft, models.ProductPublished, models.ProductArchived}
+	allowed := map[[2]string]bool{
+		{models.ProductDraft, models.ProductPublished}:    true,
+		{models.ProductDraft, models.ProductArchived}:     true,
+		{models.ProductPublished, models.ProductDraft}:    true,
+		{models.ProductPublished, models.ProductArchived}: true,
+		{models.ProductArchived, models.ProductDraft}:     true,
+	}
+
+	for _, from := range statuses {
+		if !validProductStatus(from) {
+			t.Errorf("validProductStatus(%q) = false", from)
+		}
+		for _, to := range statuses {
+			got := containsString(productTransitions[from], to)
+			if got != allowed[[2]string{from, to}] {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, !got)
+			}
+		}
+	}
+
+	for _, status := range []string{"", "scheduled", "Published", "deleted"} {
+		if validProductStatus(status) {
+			t.Errorf("validProductStatus(%q) = true", status)
+		}
+	}
+}
+
+func TestCheckPublishAt(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		status    string
+		publishAt *time.Time
+		wantErr   string
+	}{
+		{"no schedule", models.ProductPublished, nil, ""},
+		{"draft scheduled ahead", models.ProductDraft, &future, ""},
+		{"draft scheduled in the past", models.ProductDraft, &past, "in the future"},
+		{"published with schedule", models.ProductPublished, &future, "only be set on drafts"},
+		{"archived with schedule", models.ProductArchived, &future, "only be set on drafts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPublishAt(tt.status, tt.publishAt)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Message)
+				}
+				return
+			}
+			if err == nil || err.Status != http.StatusBadRequest || !strings.Contains(err.Message, tt.wantErr) {
+				t.Fatalf("error %+v, want 400 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChangeProductStatus(t *testing.T) {
+	previous := search.Default
+	search.Default = search.NewMemory(nil)
+	t.Cleanup(func() { search.Default = previous })
+
+	tests := []struct {
+		current string
+		body    string
+		status  int
+	}{
+		{models.ProductDraft, `{"status": "published"}`, http.StatusOK},
+		{models.ProductPublished, `{"status": "archived"}`, http.StatusOK},
+		{models.ProductArchived, `{"status": "published"}`, http.StatusConflict},
+		{models.ProductArchived, `{"status": "draft"}`, http.StatusOK},
+		{models.ProductDraft, `{"status": "draft", "publish_at": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, http.StatusOK},
+		{models.ProductPublished, `{"status": "published", "publish_at": "` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, http.StatusBadRequest},
+		{models.ProductPublished, `{"status": "published"}`, http.StatusConflict},
+		{models.ProductDraft, `{"status": "gone"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current+" "+tt.body, func(t *testing.T) {
+			stub := dbtest.Use(t)
+			stub.On(`FROM products p LEFT JOIN shop_members m`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"user_id", "shop_id", "role"}, []driver.Value{7, nil, nil}), nil
+			})
+			stub.On(`^SELECT status FROM products WHERE id = \?`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"status"}, []driver.Value{tt.current}), nil
+			})
+			stub.On(`^UPDATE products SET status = \?`, func(args []driver.Value) (dbtest.Result, error) {
+				if args[4] != tt.current {
+					t.Errorf("update guarded by status %v, want %s", args[4], tt.current)
+				}
+				return dbtest.Result{Affected: 1}, nil
+			})
+			stub.On(`^SELECT name, category_id, status = 'published'`, func([]driver.Value) (dbtest.Result, error) {
+				return dbtest.Rows([]string{"name", "category_id", "searchable"}, []driver.Value{"Mug", 1, true}), nil
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/status/products/3", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r = r.WithContext(context.WithValue(r.Context(), "userID", 7))
+			w := httptest.NewRecorder()
+			ChangeProductStatus(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if updated := stub.Ran(`^UPDATE products SET status`); updated != (tt.status == http.StatusOK) {
+				t.Fatalf("update ran = %v", updated)
+			}
+		})
+	}
+}
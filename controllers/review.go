@@ -0,0 +1,510 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxReviewLength = 5000
+
+const reviewColumns = "rv.id, rv.product_id, rv.user_id, u.name, rv.rating, rv.body, rv.status, rv.verified_purchase, rv.created_at, rv.updated_at"
+
+const reviewJoins = "FROM reviews rv JOIN users u ON u.id = rv.user_id"
+
+func scanReview(row rowScanner) (models.Review, error) {
+	var review models.Review
+	var createdAt, updatedAt []byte
+
+	err := row.Scan(&review.ID, &review.Product_id, &review.User_id, &review.User_name, &review.Rating, &review.Body, &review.Status, &review.Verified_purchase, &createdAt, &updatedAt)
+	if err != nil {
+		return review, err
+	}
+
+	review.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return review, err
+	}
+	review.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	return review, err
+}
+
+// refreshProductRating recomputes a product's average rating and review
+// count from its approved reviews. The product row must already be locked
+// in tx so concurrent reviews do not overwrite each other's totals. The
+// version is left alone: no product update writes the rating, so a review
+// must not fail a seller's If-Match, and GETs still change ETag through
+// the body digest.
+func refreshProductRating(tx *sql.Tx, productID int) error {
+	query := `UPDATE products SET
+		rating_count = (SELECT COUNT(*) FROM reviews WHERE product_id = ? AND status = 'approved'),
+		rating_avg = (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE product_id = ? AND status = 'approved')
+		WHERE id = ?`
+	_, err := tx.Exec(query, productID, productID, productID)
+	return err
+}
+
+// reviewInput is the body of review creation and edits. Fields left out of
+// an edit keep their value.
+type reviewInput struct {
+	Rating *int    `json:"rating"`
+	Body   *string `json:"body"`
+}
+
+func (input *reviewInput) validate(w http.ResponseWriter) bool {
+	if input.Rating != nil && (*input.Rating < 1 || *input.Rating > 5) {
+		http.Error(w, "Rating must be from 1 to 5", http.StatusBadRequest)
+		return false
+	}
+	if input.Body != nil {
+		body := strings.TrimSpace(*input.Body)
+		if body == "" {
+			http.Error(w, "Review text is required", http.StatusBadRequest)
+			return false
+		}
+		if len(body) > maxReviewLength {
+			http.Error(w, fmt.Sprintf("Review text must be at most %d characters", maxReviewLength), http.StatusBadRequest)
+			return false
+		}
+		input.Body = &body
+	}
+	return true
+}
+
+// ProductReviews serves /reviews/products/{id}: GET lists the product's
+// reviews, POST adds the caller's review.
+func ProductReviews(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/reviews/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		GetProductReviews(w, r, productID)
+	case http.MethodPost:
+		CreateReview(w, r, productID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetProductReviews lists a product's approved reviews, newest first.
+// Reviewers also see their own review if it was hidden, and administrators
+// see every review.
+func GetProductReviews(w http.ResponseWriter, r *http.Request, productID int) {
+	var product models.Product
+	query := "SELECT user_id, shop_id, status, rating_avg, rating_count FROM products WHERE id = ? AND deleted_at IS NULL"
+	err := database.DB.QueryRow(query, productID).Scan(&product.User_id, &product.Shop_id, &product.Status, &product.Rating_avg, &product.Rating_count)
+	if err == sql.ErrNoRows || (err == nil && !canViewProduct(r, product)) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	query = "SELECT " + reviewColumns + " " + reviewJoins + " WHERE rv.product_id = ?"
+	args := []interface{}{productID}
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		admin, err := callerIsAdmin(r, userID)
+		if err != nil {
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			fmt.Printf("Error checking admin flag: %v\n", err)
+			return
+		}
+		if !admin {
+			query += " AND (rv.status = 'approved' OR rv.user_id = ?)"
+			args = append(args, userID)
+		}
+	} else {
+		query += " AND rv.status = 'approved'"
+	}
+	query += " ORDER BY rv.created_at DESC, rv.id DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan review", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		reviews = append(reviews, review)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"reviews":      reviews,
+		"rating_avg":   product.Rating_avg,
+		"rating_count": product.Rating_count,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// CreateReview adds the caller's review of a published product. Sellers
+// cannot review their own products, and each user reviews a product once.
+// Reviews from customers who have paid for the product are marked as
+// verified purchases.
+func CreateReview(w http.ResponseWriter, r *http.Request, productID int) {
+	userID := r.Context().Value("userID").(int)
+
+	var input reviewInput
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if input.Rating == nil || input.Body == nil {
+		http.Error(w, "Rating and review text are required", http.StatusBadRequest)
+		return
+	}
+	if !input.validate(w) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	var shopID sql.NullInt64
+	var memberRole sql.NullString
+	query := `SELECT p.user_id, p.shop_id, m.role FROM products p
+		LEFT JOIN shop_members m ON m.shop_id = p.shop_id AND m.user_id = ?
+		WHERE p.id = ? AND p.deleted_at IS NULL AND p.status = 'published' FOR UPDATE`
+	err = tx.QueryRow(query, userID, productID).Scan(&ownerID, &shopID, &memberRole)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	// Members of the product's shop count as its owners
+	if productRole(userID, ownerID, shopID, memberRole) != "" {
+		http.Error(w, "You cannot review your own product", http.StatusForbidden)
+		return
+	}
+
+	var verified bool
+	query = `SELECT EXISTS (SELECT 1 FROM order_items oi JOIN orders o ON o.id = oi.order_id
+		WHERE oi.product_id = ? AND o.user_id = ? AND o.status IN ('paid', 'shipped', 'delivered'))`
+	err = tx.QueryRow(query, productID, userID).Scan(&verified)
+	if err != nil {
+		http.Error(w, "Failed to check purchases", http.StatusInternalServerError)
+		fmt.Printf("Error checking purchases: %v\n", err)
+		return
+	}
+
+	query = "INSERT INTO reviews (product_id, user_id, rating, body, status, verified_purchase, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, productID, userID, *input.Rating, *input.Body, models.ReviewApproved, verified, time.Now())
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "product_id", "You have already reviewed this product; edit your review instead")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create review", http.StatusInternalServerError)
+		fmt.Printf("Error inserting review: %v\n", err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to create review", http.StatusInternalServerError)
+		fmt.Printf("Error getting last insert ID: %v\n", err)
+		return
+	}
+
+	err = refreshProductRating(tx, productID)
+	if err != nil {
+		http.Error(w, "Failed to update product rating", http.StatusInternalServerError)
+		fmt.Printf("Error updating product rating: %v\n", err)
+		return
+	}
+
+	review, err := scanReview(tx.QueryRow("SELECT "+reviewColumns+" "+reviewJoins+" WHERE rv.id = ?", id))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to create review", http.StatusInternalServerError)
+		fmt.Printf("Error saving review: %v\n", err)
+		return
+	}
+
+	writeReview(w, http.StatusCreated, review)
+}
+
+// Review serves /reviews/{id}: PUT edits the caller's review, DELETE
+// removes it. Administrators may delete any review.
+func Review(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/reviews/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		UpdateReview(w, r, id)
+	case http.MethodDelete:
+		DeleteReview(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// lockReview locks a review and its product, product first like
+// CreateReview does.
+func lockReview(tx *sql.Tx, id int) (models.Review, error) {
+	var productID int
+	err := tx.QueryRow("SELECT product_id FROM reviews WHERE id = ?", id).Scan(&productID)
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	err = tx.QueryRow("SELECT id FROM products WHERE id = ? FOR UPDATE", productID).Scan(&productID)
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	return scanReview(tx.QueryRow("SELECT "+reviewColumns+" "+reviewJoins+" WHERE rv.id = ? FOR UPDATE", id))
+}
+
+func UpdateReview(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	var input reviewInput
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if input.Rating == nil && input.Body == nil {
+		http.Error(w, "Nothing to update", http.StatusBadRequest)
+		return
+	}
+	if !input.validate(w) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, err := lockReview(tx, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch review", http.StatusInternalServerError)
+		fmt.Printf("Error fetching review: %v\n", err)
+		return
+	}
+
+	if review.User_id != userID {
+		http.Error(w, "Unauthorized: You can only edit your own reviews", http.StatusUnauthorized)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	review.Updated_at = sql.NullTime{Time: time.Now(), Valid: true}
+
+	_, err = tx.Exec("UPDATE reviews SET rating = ?, body = ?, updated_at = ? WHERE id = ?", review.Rating, review.Body, review.Updated_at.Time, id)
+	if err == nil {
+		err = refreshProductRating(tx, review.Product_id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to update review", http.StatusInternalServerError)
+		fmt.Printf("Error updating review: %v\n", err)
+		return
+	}
+
+	writeReview(w, http.StatusOK, review)
+}
+
+func DeleteReview(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, err := lockReview(tx, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch review", http.StatusInternalServerError)
+		fmt.Printf("Error fetching review: %v\n", err)
+		return
+	}
+
+	if review.User_id != userID {
+		admin, err := callerIsAdmin(r, userID)
+		if err != nil {
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			fmt.Printf("Error checking admin flag: %v\n", err)
+			return
+		}
+		if !admin {
+			http.Error(w, "Unauthorized: You can only delete your own reviews", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM reviews WHERE id = ?", id)
+	if err == nil {
+		err = refreshProductRating(tx, review.Product_id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete review", http.StatusInternalServerError)
+		fmt.Printf("Error deleting review: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Review deleted successfully")
+}
+
+// ModerateReview serves POST /moderate/reviews/{id} with {"status":
+// "approved"} or {"status": "hidden"}.
+func ModerateReview(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/moderate/reviews/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid review ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if input.Status != models.ReviewApproved && input.Status != models.ReviewHidden {
+		http.Error(w, "Status must be approved or hidden", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, err := lockReview(tx, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch review", http.StatusInternalServerError)
+		fmt.Printf("Error fetching review: %v\n", err)
+		return
+	}
+
+	query := "UPDATE reviews SET status = ?, moderated_by = ?, moderated_at = ? WHERE id = ?"
+	_, err = tx.Exec(query, input.Status, userID, time.Now(), id)
+	if err == nil {
+		err = refreshProductRating(tx, review.Product_id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, "Failed to moderate review", http.StatusInternalServerError)
+		fmt.Printf("Error moderating review: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Review %s", input.Status)
+}
+
+func writeReview(w http.ResponseWriter, status int, review models.Review) {
+	response := map[string]interface{}{
+		"review": review,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/search"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchProducts serves GET /products/search?q=...&category_id=&limit=&offset=
+// Signed-in callers see which results are on their wishlists.
+func SearchProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	q := search.Query{Text: params.Get("q"), Limit: defaultSearchLimit}
+	if len(search.Tokenize(q.Text)) == 0 {
+		http.Error(w, "The q parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if s := params.Get("category_id"); s != "" {
+		q.CategoryID, err = strconv.Atoi(s)
+		if err != nil || q.CategoryID <= 0 {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+	}
+	if s := params.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil || q.Limit <= 0 || q.Limit > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	if s := params.Get("offset"); s != "" {
+		q.Offset, err = strconv.Atoi(s)
+		if err != nil || q.Offset < 0 {
+			http.Error(w, "offset must not be negative", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := search.Default.Search(r.Context(), q)
+	if err != nil {
+		http.Error(w, "Failed to search products", http.StatusInternalServerError)
+		fmt.Printf("Error searching products: %v\n", err)
+		return
+	}
+
+	productIDs := make([]int, len(result.Hits))
+	for i, hit := range result.Hits {
+		productIDs[i] = hit.ProductID
+	}
+	products, err := loadProductsByID(productIDs)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching products: %v\n", err)
+		return
+	}
+
+	// Keep the index's ranking; skip hits whose product has since gone
+	results := []models.SearchResult{}
+	for _, hit := range result.Hits {
+		product, ok := products[hit.ProductID]
+		if !ok {
+			continue
+		}
+		results = append(results, models.SearchResult{Product: product, Score: hit.Score, Snippet: hit.Snippet})
+	}
+
+	page := make([]models.Product, len(results))
+	for i := range results {
+		page[i] = results[i].Product
+	}
+	err = markFavorites(r, page)
+	if err != nil {
+		http.Error(w, "Failed to fetch wishlists", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlists: %v\n", err)
+		return
+	}
+	for i := range results {
+		results[i].Product = page[i]
+	}
+
+	facets, err := namedFacets(result.Facets)
+	if err != nil {
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching facet categories: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"results":     results,
+		"total":       result.Total,
+		"facets":      facets,
+		"corrections": result.Corrections,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// loadProductsByID fetches products with their images and tags, keyed by
+// ID.
+func loadProductsByID(ids []int) (map[int]models.Product, error) {
+	products := map[int]models.Product{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	placeholders, args := helpers.InPlaceholders(ids)
+	query := fmt.Sprintf("SELECT id, sku, version, name, price, currency, user_id, shop_id, category_id, stock, low_stock_threshold, status, publish_at, rating_avg, rating_count, created_at, updated_at FROM products WHERE id IN (%s) AND deleted_at IS NULL AND status = 'published'", placeholders)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product models.Product
+		var publishAt []byte
+		var createdAt []byte
+		var updatedAt []byte
+
+		err := rows.Scan(&product.ID, &product.SKU, &product.Version, &product.Name, &product.Price, &product.Currency, &product.User_id, &product.Shop_id, &product.Category_id, &product.Stock, &product.Low_stock_threshold, &product.Status, &publishAt, &product.Rating_avg, &product.Rating_count, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		product.Publish_at, err = helpers.ParseOptionalDatetime(publishAt)
+		if err != nil {
+			return nil, err
+		}
+		product.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		product.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		products[product.ID] = product
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	images, err := loadProductImages(ids)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := loadProductTags(ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, product := range products {
+		product.Images = images[id]
+		if product.Images == nil {
+			product.Images = []models.ProductImage{}
+		}
+		product.Tags = tags[id]
+		if product.Tags == nil {
+			product.Tags = []models.Tag{}
+		}
+		products[id] = product
+	}
+
+	return products, nil
+}
+
+// namedFacets adds category names to the index's facet counts.
+func namedFacets(facets []search.Facet) ([]models.SearchFacet, error) {
+	named := []models.SearchFacet{}
+	if len(facets) == 0 {
+		return named, nil
+	}
+
+	ids := make([]int, len(facets))
+	for i, facet := range facets {
+		ids[i] = facet.CategoryID
+	}
+
+	placeholders, args := helpers.InPlaceholders(ids)
+	rows, err := database.DB.Query(fmt.Sprintf("SELECT id, name FROM categories WHERE id IN (%s)", placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, facet := range facets {
+		named = append(named, models.SearchFacet{Category_id: facet.CategoryID, Category_name: names[facet.CategoryID], Count: facet.Count})
+	}
+	return named, nil
+}
+
+// reindexProduct brings the search index in line with the product: live,
+// published products are (re)indexed with their current name and category,
+// anything else is removed. Failures are logged rather than failing the
+// write that triggered them.
+func reindexProduct(productID int) {
+	doc := search.Document{ProductID: productID}
+	var searchable bool
+	query := "SELECT name, category_id, status = 'published' AND deleted_at IS NULL FROM products WHERE id = ?"
+	err := database.DB.QueryRow(query, productID).Scan(&doc.Name, &doc.CategoryID, &searchable)
+	if err == nil && searchable {
+		err = search.Default.Put(doc)
+	} else if err == nil || err == sql.ErrNoRows {
+		err = search.Default.Remove(productID)
+	}
+	if err != nil {
+		fmt.Printf("Error indexing product %d: %v\n", productID, err)
+	}
+}
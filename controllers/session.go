@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/sessions"
+	"loginApi/utils"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// startSession issues a login token for the user and records the session
+// it belongs to, with the device and address the login came from.
+func startSession(r *http.Request, userID int, userName string) (string, error) {
+	tokenString, claims, err := utils.GenerateJWT(userID, userName)
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	err = sessions.Create(claims.Id, userID, userAgent, ip, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// MySessions serves GET /me/sessions and DELETE /me/sessions/{id}.
+func MySessions(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value("clientID") != nil {
+		http.Error(w, "Third-party tokens cannot manage sessions", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		GetSessions(w, r)
+	case http.MethodDelete:
+		DeleteSession(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+	currentID, _ := r.Context().Value("sessionID").(string)
+
+	query := "SELECT id, user_agent, ip_address, created_at, last_seen_at, expires_at FROM user_sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC"
+	rows, err := database.DB.Query(query, userID, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to fetch sessions", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	sessionList := []models.Session{}
+
+	for rows.Next() {
+		var session models.Session
+		var createdAt, lastSeenAt, expiresAt []byte
+
+		err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &createdAt, &lastSeenAt, &expiresAt)
+		if err != nil {
+			http.Error(w, "Failed to scan session", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+
+		session.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err == nil {
+			session.Last_seen_at, err = helpers.ParseDatetime(lastSeenAt)
+		}
+		if err == nil {
+			session.Expires_at, err = helpers.ParseDatetime(expiresAt)
+		}
+		if err != nil {
+			http.Error(w, "Failed to parse session times", http.StatusInternalServerError)
+			fmt.Printf("Error parsing session times: %v\n", err)
+			return
+		}
+
+		session.User_id = userID
+		session.Current = session.ID == currentID
+		sessionList = append(sessionList, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"sessions": sessionList,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode sessions to JSON", http.StatusInternalServerError)
+		fmt.Printf("Error encoding JSON: %v\n", err)
+		return
+	}
+}
+
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	sessionID := strings.TrimPrefix(r.URL.Path, "/me/sessions/")
+	if sessionID == "" || strings.Contains(sessionID, "/") {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := sessions.Revoke(sessionID, userID)
+	if err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		fmt.Printf("Error revoking session: %v\n", err)
+		return
+	}
+
+	if !revoked {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Session revoked successfully")
+}
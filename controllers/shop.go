@@ -0,0 +1,1059 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxShopName = 100
+
+// invitationTTL is how long an invitation can be accepted for.
+const invitationTTL = 7 * 24 * time.Hour
+
+// shopRoleRank orders the shop roles; each role can do everything the ones
+// below it can.
+var shopRoleRank = map[string]int{
+	models.ShopEditor:  1,
+	models.ShopManager: 2,
+	models.ShopOwner:   3,
+}
+
+// roleAtLeast reports whether role is required or a more powerful one.
+func roleAtLeast(role, required string) bool {
+	return shopRoleRank[role] > 0 && shopRoleRank[role] >= shopRoleRank[required]
+}
+
+// productRole is the role userID holds over a product with the given
+// owner and shop, where memberRole is userID's role in that shop. Users
+// act as owners of their personal products; a shop's products belong to
+// its members alone, whoever created them. "" means no access.
+func productRole(userID, ownerID int, shopID sql.NullInt64, memberRole sql.NullString) string {
+	if shopID.Valid {
+		return memberRole.String
+	}
+	if ownerID == userID {
+		return models.ShopOwner
+	}
+	return ""
+}
+
+// requireRole checks the role a caller holds over a product against the
+// one an action needs. Outsiders get the same answer as before shops
+// existed; members whose role is too weak are told which one it takes.
+func requireRole(role, required string) error {
+	if role == "" {
+		return &productError{Status: http.StatusUnauthorized, Message: "Unauthorized: You do not own this product"}
+	}
+	if !roleAtLeast(role, required) {
+		return &productError{Status: http.StatusForbidden, Message: fmt.Sprintf("Forbidden: This needs the %s role in the product's shop", required)}
+	}
+	return nil
+}
+
+// checkShopRole checks that userID is a member of shopID with at least
+// role. Shops the caller is not a member of are reported as missing.
+func checkShopRole(q rowQueryer, shopID, userID int, role string) error {
+	var memberRole string
+	err := q.QueryRow("SELECT role FROM shop_members WHERE shop_id = ? AND user_id = ?", shopID, userID).Scan(&memberRole)
+	if err == sql.ErrNoRows {
+		return &productError{Status: http.StatusNotFound, Message: "Shop not found"}
+	} else if err != nil {
+		return err
+	}
+
+	if !roleAtLeast(memberRole, role) {
+		return &productError{Status: http.StatusForbidden, Message: fmt.Sprintf("Forbidden: This needs the %s role in the shop", role)}
+	}
+	return nil
+}
+
+// authorizeShop is checkShopRole for handlers, writing the error response
+// and returning false on failure.
+func authorizeShop(w http.ResponseWriter, shopID, userID int, role string) bool {
+	err := checkShopRole(database.DB, shopID, userID, role)
+	if err != nil {
+		writeProductError(w, err, "Failed to fetch shop")
+		return false
+	}
+	return true
+}
+
+// catalog is the set of products a bulk request works on: the caller's
+// personal products, or those of one of their shops.
+type catalog struct {
+	userID int
+	shopID *int
+}
+
+// condition returns the SQL condition selecting the catalog's products,
+// with prefix qualifying the column names.
+func (c catalog) condition(prefix string) (string, []interface{}) {
+	if c.shopID != nil {
+		return prefix + "shop_id = ?", []interface{}{*c.shopID}
+	}
+	return fmt.Sprintf("%sshop_id IS NULL AND %suser_id = ?", prefix, prefix), []interface{}{c.userID}
+}
+
+// requestCatalog reads the catalog a request names with ?shop_id=, the
+// caller's own products without it. A shop needs the caller to hold at
+// least role in it. It writes the error response and returns ok == false
+// on failure.
+func requestCatalog(w http.ResponseWriter, r *http.Request, userID int, role string) (catalog, bool) {
+	c := catalog{userID: userID}
+	idStr := r.URL.Query().Get("shop_id")
+	if idStr == "" {
+		return c, true
+	}
+
+	shopID, err := strconv.Atoi(idStr)
+	if err != nil || shopID <= 0 {
+		http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+		return c, false
+	}
+	if !authorizeShop(w, shopID, userID, role) {
+		return c, false
+	}
+	c.shopID = &shopID
+	return c, true
+}
+
+// lockShopMembers locks a shop's memberships for the rest of tx and
+// returns each member's role.
+func lockShopMembers(tx *sql.Tx, shopID int) (map[int]string, error) {
+	rows, err := tx.Query("SELECT user_id, role FROM shop_members WHERE shop_id = ? FOR UPDATE", shopID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			return nil, err
+		}
+		members[userID] = role
+	}
+	return members, rows.Err()
+}
+
+// countOwners counts the owners among members.
+func countOwners(members map[int]string) int {
+	owners := 0
+	for _, role := range members {
+		if role == models.ShopOwner {
+			owners++
+		}
+	}
+	return owners
+}
+
+func validShopName(w http.ResponseWriter, name string) bool {
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if len(name) > maxShopName {
+		http.Error(w, fmt.Sprintf("Name must be at most %d characters", maxShopName), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func validShopRole(w http.ResponseWriter, role string) bool {
+	if shopRoleRank[role] == 0 {
+		http.Error(w, "Role must be owner, manager or editor", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+const shopColumns = "s.id, s.name, s.slug, m.role, s.created_by, s.created_at, s.updated_at"
+
+func scanShop(row rowScanner) (models.Shop, error) {
+	var shop models.Shop
+	var createdAt, updatedAt []byte
+
+	err := row.Scan(&shop.ID, &shop.Name, &shop.Slug, &shop.Role, &shop.Created_by, &createdAt, &updatedAt)
+	if err != nil {
+		return shop, err
+	}
+
+	shop.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return shop, err
+	}
+	shop.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	return shop, err
+}
+
+// Shops serves the shops the caller is a member of:
+//
+//	GET    /shops                                 list them with the caller's role
+//	POST   /shops                                 create one, owned by the caller
+//	GET    /shops/{id}                            one shop with its members
+//	PUT    /shops/{id}                            rename it (owners)
+//	PUT    /shops/{id}/members/{user_id}          change a member's role (managers)
+//	DELETE /shops/{id}/members/{user_id}          remove a member, or leave
+//	GET    /shops/{id}/invitations                pending invitations (managers)
+//	POST   /shops/{id}/invitations                invite an email address (managers)
+//	DELETE /shops/{id}/invitations/{id}           withdraw an invitation (managers)
+//
+// Members can only grant, change or remove roles up to their own, so
+// managers look after editors and other managers and owners after
+// everyone. A shop always keeps at least one owner; ownership passes by
+// making another member an owner before stepping down.
+func Shops(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/shops"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			GetShops(w, r)
+		case http.MethodPost:
+			CreateShop(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	idStr, rest, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid shop ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	collection, itemStr, _ := strings.Cut(rest, "/")
+	switch collection {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			GetShop(w, r, id)
+		case http.MethodPut:
+			RenameShop(w, r, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+
+	case "invitations":
+		if itemStr == "" {
+			switch r.Method {
+			case http.MethodGet:
+				GetShopInvitations(w, r, id)
+			case http.MethodPost:
+				CreateShopInvitation(w, r, id)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		invitationID, err := strconv.Atoi(itemStr)
+		if err != nil || invitationID <= 0 {
+			http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+			fmt.Printf("Invalid ID: %v\n", itemStr)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		DeleteShopInvitation(w, r, id, invitationID)
+		return
+
+	case "members":
+		memberID, err := strconv.Atoi(itemStr)
+		if err != nil || memberID <= 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			fmt.Printf("Invalid ID: %v\n", itemStr)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			ChangeShopMemberRole(w, r, id, memberID)
+		case http.MethodDelete:
+			RemoveShopMember(w, r, id, memberID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	http.Error(w, "Not found", http.StatusNotFound)
+}
+
+func GetShops(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	query := "SELECT " + shopColumns + " FROM shops s JOIN shop_members m ON m.shop_id = s.id WHERE m.user_id = ? ORDER BY s.name"
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch shops", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	shops := []models.Shop{}
+	for rows.Next() {
+		shop, err := scanShop(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan shop", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		shops = append(shops, shop)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"shops": shops,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// CreateShop creates a shop with the caller as its first owner. Without a
+// slug one is derived from the name.
+func CreateShop(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var shop models.Shop
+	err := helpers.ParseJSONRequestBody(r, &shop)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	shop.Name = strings.TrimSpace(shop.Name)
+	if !validShopName(w, shop.Name) {
+		return
+	}
+	if shop.Slug == "" {
+		shop.Slug = shop.Name
+	}
+	shop.Slug = helpers.Slugify(shop.Slug)
+	if shop.Slug == "" {
+		http.Error(w, "Slug must contain letters or digits", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create shop", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec("INSERT INTO shops (name, slug, created_by, created_at) VALUES (?, ?, ?, ?)", shop.Name, shop.Slug, userID, now)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "slug", "A shop with this slug already exists")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create shop", http.StatusInternalServerError)
+		fmt.Printf("Error inserting shop: %v\n", err)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO shop_members (shop_id, user_id, role, created_at) VALUES (?, ?, ?, ?)", id, userID, models.ShopOwner, now)
+	if err != nil {
+		http.Error(w, "Failed to create shop", http.StatusInternalServerError)
+		fmt.Printf("Error inserting shop owner: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to create shop", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Shop created successfully with ID: %d", id)
+}
+
+// GetShop returns one of the caller's shops with its members, owners
+// first.
+func GetShop(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	query := "SELECT " + shopColumns + " FROM shops s JOIN shop_members m ON m.shop_id = s.id WHERE s.id = ? AND m.user_id = ?"
+	shop, err := scanShop(database.DB.QueryRow(query, id, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch shop", http.StatusInternalServerError)
+		fmt.Printf("Error fetching shop: %v\n", err)
+		return
+	}
+
+	query = `SELECT m.user_id, u.name, u.email, m.role, m.created_at FROM shop_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.shop_id = ?
+		ORDER BY FIELD(m.role, 'owner', 'manager', 'editor'), u.name, m.user_id`
+	rows, err := database.DB.Query(query, id)
+	if err != nil {
+		http.Error(w, "Failed to fetch shop members", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	shop.Members = []models.ShopMember{}
+	for rows.Next() {
+		var member models.ShopMember
+		var createdAt []byte
+		err := rows.Scan(&member.User_id, &member.Name, &member.Email, &member.Role, &createdAt)
+		if err == nil {
+			member.Created_at, err = helpers.ParseDatetime(createdAt)
+		}
+		if err != nil {
+			http.Error(w, "Failed to scan shop member", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		shop.Members = append(shop.Members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"shop": shop,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// RenameShop changes a shop's name and, if one is given, its slug.
+func RenameShop(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	var input models.Shop
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if !validShopName(w, input.Name) {
+		return
+	}
+
+	if !authorizeShop(w, id, userID, models.ShopOwner) {
+		return
+	}
+
+	setClauses := []string{"name = ?", "updated_at = ?"}
+	args := []interface{}{input.Name, time.Now()}
+	if input.Slug != "" {
+		slug := helpers.Slugify(input.Slug)
+		if slug == "" {
+			http.Error(w, "Slug must contain letters or digits", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, "slug = ?")
+		args = append(args, slug)
+	}
+
+	query := fmt.Sprintf("UPDATE shops SET %s WHERE id = ?", strings.Join(setClauses, ", "))
+	_, err = database.DB.Exec(query, append(args, id)...)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "slug", "A shop with this slug already exists")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to update shop", http.StatusInternalServerError)
+		fmt.Printf("Error updating shop: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Shop updated successfully")
+}
+
+// ChangeShopMemberRole serves PUT /shops/{id}/members/{user_id} with
+// {"role": "..."}. The caller must be at least a manager and may only
+// move members between roles up to their own.
+func ChangeShopMemberRole(w http.ResponseWriter, r *http.Request, shopID, memberID int) {
+	userID := r.Context().Value("userID").(int)
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+	if !validShopRole(w, input.Role) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	members, err := lockShopMembers(tx, shopID)
+	if err != nil {
+		http.Error(w, "Failed to fetch shop members", http.StatusInternalServerError)
+		fmt.Printf("Error fetching shop members: %v\n", err)
+		return
+	}
+
+	callerRole, ok := members[userID]
+	if !ok {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	}
+	currentRole, ok := members[memberID]
+	if !ok {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	if !roleAtLeast(callerRole, models.ShopManager) || !roleAtLeast(callerRole, currentRole) || !roleAtLeast(callerRole, input.Role) {
+		http.Error(w, "Forbidden: You can only manage roles up to your own", http.StatusForbidden)
+		return
+	}
+	if currentRole == models.ShopOwner && input.Role != models.ShopOwner && countOwners(members) == 1 {
+		http.Error(w, "A shop must keep at least one owner; make another member an owner first", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE shop_members SET role = ? WHERE shop_id = ? AND user_id = ?", input.Role, shopID, memberID)
+	if err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		fmt.Printf("Error updating shop member: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Member role updated successfully")
+}
+
+// RemoveShopMember serves DELETE /shops/{id}/members/{user_id}. Anyone may
+// leave; removing someone else takes a manager whose role is at least
+// theirs. The shop's products stay with the shop.
+func RemoveShopMember(w http.ResponseWriter, r *http.Request, shopID, memberID int) {
+	userID := r.Context().Value("userID").(int)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	members, err := lockShopMembers(tx, shopID)
+	if err != nil {
+		http.Error(w, "Failed to fetch shop members", http.StatusInternalServerError)
+		fmt.Printf("Error fetching shop members: %v\n", err)
+		return
+	}
+
+	callerRole, ok := members[userID]
+	if !ok {
+		http.Error(w, "Shop not found", http.StatusNotFound)
+		return
+	}
+	memberRole, ok := members[memberID]
+	if !ok {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	if memberID != userID && (!roleAtLeast(callerRole, models.ShopManager) || !roleAtLeast(callerRole, memberRole)) {
+		http.Error(w, "Forbidden: You can only remove members whose role is at most your own", http.StatusForbidden)
+		return
+	}
+	if memberRole == models.ShopOwner && countOwners(members) == 1 {
+		http.Error(w, "A shop must keep at least one owner; make another member an owner first", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM shop_members WHERE shop_id = ? AND user_id = ?", shopID, memberID)
+	if err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		fmt.Printf("Error deleting shop member: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Member removed successfully")
+}
+
+const invitationColumns = "i.id, i.shop_id, s.name, i.email, i.role, i.invited_by, i.created_at, i.expires_at"
+
+// pendingInvitations lists the invitations matching condition that are
+// neither accepted nor expired, newest first.
+func pendingInvitations(condition string, args ...interface{}) ([]models.ShopInvitation, error) {
+	query := fmt.Sprintf(`SELECT %s FROM shop_invitations i JOIN shops s ON s.id = i.shop_id
+		WHERE %s AND i.accepted_at IS NULL AND i.expires_at > ?
+		ORDER BY i.created_at DESC, i.id DESC`, invitationColumns, condition)
+	rows, err := database.DB.Query(query, append(args, time.Now())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []models.ShopInvitation{}
+	for rows.Next() {
+		var invitation models.ShopInvitation
+		var createdAt, expiresAt []byte
+		err := rows.Scan(&invitation.ID, &invitation.Shop_id, &invitation.Shop_name, &invitation.Email, &invitation.Role, &invitation.Invited_by, &createdAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		invitation.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		invitation.Expires_at, err = helpers.ParseDatetime(expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func writeInvitations(w http.ResponseWriter, invitations []models.ShopInvitation) {
+	response := map[string]interface{}{
+		"invitations": invitations,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// GetShopInvitations lists a shop's pending invitations.
+func GetShopInvitations(w http.ResponseWriter, r *http.Request, shopID int) {
+	userID := r.Context().Value("userID").(int)
+
+	if !authorizeShop(w, shopID, userID, models.ShopManager) {
+		return
+	}
+
+	invitations, err := pendingInvitations("i.shop_id = ?", shopID)
+	if err != nil {
+		http.Error(w, "Failed to fetch invitations", http.StatusInternalServerError)
+		fmt.Printf("Error fetching invitations: %v\n", err)
+		return
+	}
+	writeInvitations(w, invitations)
+}
+
+// CreateShopInvitation serves POST /shops/{id}/invitations with
+// {"email": "...", "role": "..."}. The invitee accepts by signing in with
+// that address and posting the token to /accept/invitations/{token}. The
+// token is only returned here, for the inviter to pass on.
+func CreateShopInvitation(w http.ResponseWriter, r *http.Request, shopID int) {
+	userID := r.Context().Value("userID").(int)
+
+	var invitation models.ShopInvitation
+	err := helpers.ParseJSONRequestBody(r, &invitation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	invitation.Email = helpers.NormalizeEmail(invitation.Email)
+	if !strings.Contains(invitation.Email, "@") || len(invitation.Email) > 255 {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+	if invitation.Role == "" {
+		invitation.Role = models.ShopEditor
+	}
+	if !validShopRole(w, invitation.Role) {
+		return
+	}
+
+	// Inviting takes a manager, and nobody can invite above their own role
+	required := models.ShopManager
+	if invitation.Role == models.ShopOwner {
+		required = models.ShopOwner
+	}
+	if !authorizeShop(w, shopID, userID, required) {
+		return
+	}
+
+	var member, pending bool
+	query := `SELECT
+		EXISTS(SELECT 1 FROM shop_members m JOIN users u ON u.id = m.user_id WHERE m.shop_id = ? AND u.email = ?),
+		EXISTS(SELECT 1 FROM shop_invitations WHERE shop_id = ? AND email = ? AND accepted_at IS NULL AND expires_at > ?)`
+	err = database.DB.QueryRow(query, shopID, invitation.Email, shopID, invitation.Email, time.Now()).Scan(&member, &pending)
+	if err != nil {
+		http.Error(w, "Failed to check invitations", http.StatusInternalServerError)
+		fmt.Printf("Error checking invitations: %v\n", err)
+		return
+	}
+	if member {
+		writeConflict(w, "email", "This user is already a member of the shop")
+		return
+	}
+	if pending {
+		writeConflict(w, "email", "This address already has a pending invitation; withdraw it to send a new one")
+		return
+	}
+
+	invitation.Token, err = utils.GenerateRandomToken(24)
+	if err != nil {
+		http.Error(w, "Failed to generate invitation token", http.StatusInternalServerError)
+		fmt.Printf("Error generating invitation token: %v\n", err)
+		return
+	}
+
+	invitation.Shop_id = shopID
+	invitation.Invited_by = userID
+	invitation.Created_at = time.Now()
+	invitation.Expires_at = invitation.Created_at.Add(invitationTTL)
+
+	query = "INSERT INTO shop_invitations (shop_id, email, role, token_hash, invited_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	result, err := database.DB.Exec(query, shopID, invitation.Email, invitation.Role, utils.HashToken(invitation.Token), userID, invitation.Created_at, invitation.Expires_at)
+	if err != nil {
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		fmt.Printf("Error inserting invitation: %v\n", err)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+	invitation.ID = int(id)
+
+	response := map[string]interface{}{
+		"invitation":  invitation,
+		"accept_path": fmt.Sprintf("/accept/invitations/%s", invitation.Token),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// DeleteShopInvitation withdraws a pending invitation.
+func DeleteShopInvitation(w http.ResponseWriter, r *http.Request, shopID, invitationID int) {
+	userID := r.Context().Value("userID").(int)
+
+	if !authorizeShop(w, shopID, userID, models.ShopManager) {
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM shop_invitations WHERE id = ? AND shop_id = ? AND accepted_at IS NULL", invitationID, shopID)
+	if err != nil {
+		http.Error(w, "Failed to withdraw invitation", http.StatusInternalServerError)
+		fmt.Printf("Error deleting invitation: %v\n", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to withdraw invitation", http.StatusInternalServerError)
+		fmt.Printf("Error getting rows affected: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Invitation withdrawn successfully")
+}
+
+// MyInvitations serves GET /invitations: the pending invitations sent to
+// the caller's email address.
+func MyInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invitations, err := pendingInvitations("i.email = (SELECT email FROM users WHERE id = ?)", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch invitations", http.StatusInternalServerError)
+		fmt.Printf("Error fetching invitations: %v\n", err)
+		return
+	}
+	writeInvitations(w, invitations)
+}
+
+// AcceptInvitation serves POST /accept/invitations/{token}, adding the
+// caller to the shop with the invited role. Only the user signed in with
+// the address the invitation was sent to can accept it.
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/accept/invitations/")
+	if token == "" {
+		http.Error(w, "Invitation token is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var invitationID, shopID int
+	var email, role string
+	query := "SELECT id, shop_id, email, role FROM shop_invitations WHERE token_hash = ? AND accepted_at IS NULL AND expires_at > ? FOR UPDATE"
+	err = tx.QueryRow(query, utils.HashToken(token), time.Now()).Scan(&invitationID, &shopID, &email, &role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invitation not found or expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch invitation", http.StatusInternalServerError)
+		fmt.Printf("Error fetching invitation: %v\n", err)
+		return
+	}
+
+	var userEmail string
+	err = tx.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&userEmail)
+	if err != nil {
+		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		fmt.Printf("Error fetching user: %v\n", err)
+		return
+	}
+	if helpers.NormalizeEmail(userEmail) != email {
+		http.Error(w, "This invitation was sent to a different email address", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	_, err = tx.Exec("INSERT INTO shop_members (shop_id, user_id, role, created_at) VALUES (?, ?, ?, ?)", shopID, userID, role, now)
+	if _, dup := database.DuplicateKey(err); dup {
+		http.Error(w, "You are already a member of this shop", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		fmt.Printf("Error inserting shop member: %v\n", err)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE shop_invitations SET accepted_at = ? WHERE id = ?", now, invitationID)
+	if err != nil {
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		fmt.Printf("Error updating invitation: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Joined shop %d as %s", shopID, role)
+}
+
+// TransferProduct serves POST /transfer/products/{id} with {"user_id": n}
+// or {"shop_id": n}, handing the product to a user or a shop. It takes a
+// manager of the product, and moving it into a shop takes a manager of
+// that shop too. The product keeps its SKU, which must be free with the
+// new owner. If-Match is honored as on updates.
+func TransferProduct(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/transfer/products/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		User_id int `json:"user_id"`
+		Shop_id int `json:"shop_id"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+	if (input.User_id > 0) == (input.Shop_id > 0) {
+		http.Error(w, "Exactly one of user_id and shop_id is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to transfer product", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = checkProductRole(tx, id, userID, models.ShopManager, true)
+	if err != nil {
+		writeProductError(w, err, "Failed to fetch product")
+		return
+	}
+
+	var ownerID, version int
+	var shopID sql.NullInt64
+	err = tx.QueryRow("SELECT user_id, shop_id, version FROM products WHERE id = ?", id).Scan(&ownerID, &shopID, &version)
+	if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+	if versions != nil && !containsInt(versions, version) {
+		http.Error(w, errVersionMismatch.Message, errVersionMismatch.Status)
+		return
+	}
+
+	// Shop products keep the user who last owned them in person
+	newOwnerID := ownerID
+	var newShopID interface{}
+	if input.Shop_id > 0 {
+		if shopID.Valid && int(shopID.Int64) == input.Shop_id {
+			http.Error(w, "The product already belongs to this shop", http.StatusBadRequest)
+			return
+		}
+		err = checkShopRole(tx, input.Shop_id, userID, models.ShopManager)
+		if err != nil {
+			writeProductError(w, err, "Failed to fetch shop")
+			return
+		}
+		newShopID = input.Shop_id
+	} else {
+		if !shopID.Valid && ownerID == input.User_id {
+			http.Error(w, "The product already belongs to this user", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", input.User_id).Scan(&exists)
+		if err != nil {
+			http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+			fmt.Printf("Error fetching user: %v\n", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		newOwnerID = input.User_id
+	}
+
+	query := "UPDATE products SET user_id = ?, shop_id = ?, updated_at = ?, version = version + 1 WHERE id = ?"
+	_, err = tx.Exec(query, newOwnerID, newShopID, time.Now(), id)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "sku", "The new owner already has a product with this SKU")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to transfer product", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to transfer product", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	reindexProduct(id)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Product transferred successfully")
+}
@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxTagLength      = 50
+	maxTagsPerProduct = 30
+	maxTagSuggestions = 20
+)
+
+// ProductTags serves /tags/products/{id}: GET lists the product's tags,
+// POST attaches tags by name (creating unknown ones) and
+// DELETE /tags/products/{id}/{slug} detaches one. Routes only let
+// authenticated requests through for POST and DELETE.
+func ProductTags(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/tags/products/")
+	idStr, slug, _ := strings.Cut(path, "/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var exists bool
+		err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ? AND deleted_at IS NULL)", productID).Scan(&exists)
+		if err != nil {
+			http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+			fmt.Printf("Error fetching product: %v\n", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		if !authorizeProduct(w, productID, r.Context().Value("userID").(int), models.ShopEditor) {
+			return
+		}
+		if !attachTags(w, r, productID) {
+			return
+		}
+	case http.MethodDelete:
+		if slug == "" {
+			http.Error(w, "Tag slug is required", http.StatusBadRequest)
+			return
+		}
+		if !authorizeProduct(w, productID, r.Context().Value("userID").(int), models.ShopEditor) {
+			return
+		}
+		_, err = database.DB.Exec("DELETE pt FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.product_id = ? AND t.slug = ?", productID, slug)
+		if err != nil {
+			http.Error(w, "Failed to detach tag", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags, err := loadProductTags([]int{productID})
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		fmt.Printf("Error fetching tags: %v\n", err)
+		return
+	}
+	productTags := tags[productID]
+	if productTags == nil {
+		productTags = []models.Tag{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"tags": productTags})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// attachTags handles the POST body {"tags": ["Summer sale", ...]}. It
+// writes the error response and returns false on failure.
+func attachTags(w http.ResponseWriter, r *http.Request, productID int) bool {
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return false
+	}
+	if len(input.Tags) == 0 {
+		http.Error(w, "At least one tag is required", http.StatusBadRequest)
+		return false
+	}
+
+	names := map[string]string{} // slug -> name
+	var slugs []string
+	for _, name := range input.Tags {
+		name = strings.Join(strings.Fields(name), " ")
+		slug := helpers.Slugify(name)
+		if slug == "" || len([]rune(name)) > maxTagLength {
+			http.Error(w, fmt.Sprintf("Tags must contain letters or digits and be at most %d characters", maxTagLength), http.StatusBadRequest)
+			return false
+		}
+		if _, seen := names[slug]; !seen {
+			names[slug] = name
+			slugs = append(slugs, slug)
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to attach tags", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return false
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow("SELECT COUNT(*) FROM product_tags WHERE product_id = ?", productID).Scan(&current)
+	if err != nil {
+		http.Error(w, "Failed to attach tags", http.StatusInternalServerError)
+		fmt.Printf("Error counting tags: %v\n", err)
+		return false
+	}
+	if current+len(slugs) > maxTagsPerProduct {
+		// Some may already be attached; count precisely before refusing
+		placeholders, args := helpers.InStringPlaceholders(slugs)
+		var already int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.product_id = ? AND t.slug IN (%s)", placeholders)
+		err = tx.QueryRow(query, append([]interface{}{productID}, args...)...).Scan(&already)
+		if err != nil {
+			http.Error(w, "Failed to attach tags", http.StatusInternalServerError)
+			fmt.Printf("Error counting tags: %v\n", err)
+			return false
+		}
+		if current+len(slugs)-already > maxTagsPerProduct {
+			http.Error(w, fmt.Sprintf("A product can have at most %d tags", maxTagsPerProduct), http.StatusBadRequest)
+			return false
+		}
+	}
+
+	now := time.Now()
+	for _, slug := range slugs {
+		_, err = tx.Exec("INSERT IGNORE INTO tags (name, slug, created_at) VALUES (?, ?, ?)", names[slug], slug, now)
+		if err == nil {
+			_, err = tx.Exec("INSERT IGNORE INTO product_tags (product_id, tag_id) SELECT ?, id FROM tags WHERE slug = ?", productID, slug)
+		}
+		if err != nil {
+			http.Error(w, "Failed to attach tags", http.StatusInternalServerError)
+			fmt.Printf("Error attaching tag %s: %v\n", slug, err)
+			return false
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to attach tags", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// TagAutocomplete serves GET /tags/autocomplete?q=...: tags whose name or
+// slug starts with q, most used on published products first.
+func TagAutocomplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "The q parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxTagSuggestions {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxTagSuggestions), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	// Escape LIKE wildcards in what the user typed
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+	slugPrefix := helpers.Slugify(q) + "%"
+
+	query := `SELECT t.name, t.slug, COUNT(p.id) AS product_count
+		FROM tags t
+		LEFT JOIN product_tags pt ON pt.tag_id = t.id
+		LEFT JOIN products p ON p.id = pt.product_id AND p.deleted_at IS NULL AND p.status = 'published'
+		WHERE t.name LIKE ? OR t.slug LIKE ?
+		GROUP BY t.id, t.name, t.slug
+		ORDER BY product_count DESC, t.name
+		LIMIT ?`
+	rows, err := database.DB.Query(query, prefix, slugPrefix, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := []models.TagSuggestion{}
+	for rows.Next() {
+		var suggestion models.TagSuggestion
+		err := rows.Scan(&suggestion.Name, &suggestion.Slug, &suggestion.Product_count)
+		if err != nil {
+			http.Error(w, "Failed to scan tag", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"tags": suggestions})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// loadProductTags fetches the tags of several products in one query,
+// grouped by product ID and sorted by name.
+func loadProductTags(productIDs []int) (map[int][]models.Tag, error) {
+	tags := map[int][]models.Tag{}
+	if len(productIDs) == 0 {
+		return tags, nil
+	}
+
+	placeholders, args := helpers.InPlaceholders(productIDs)
+	query := fmt.Sprintf("SELECT pt.product_id, t.id, t.name, t.slug, t.created_at FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.product_id IN (%s) ORDER BY t.name", placeholders)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var tag models.Tag
+		var createdAt []byte
+		if err := rows.Scan(&productID, &tag.ID, &tag.Name, &tag.Slug, &createdAt); err != nil {
+			return nil, err
+		}
+		tag.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		tags[productID] = append(tags[productID], tag)
+	}
+	return tags, rows.Err()
+}
+
+// tagFilter turns ?tags=a,b&tag_mode=all|any into an SQL condition on
+// products.id. "any" (the default) matches products with at least one of
+// the tags, "all" only those with every one.
+func tagFilter(r *http.Request) (condition string, args []interface{}, err error) {
+	raw := r.URL.Query().Get("tags")
+	if raw == "" {
+		return "", nil, nil
+	}
+
+	var slugs []string
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(raw, ",") {
+		slug := helpers.Slugify(tag)
+		if slug != "" && !seen[slug] {
+			seen[slug] = true
+			slugs = append(slugs, slug)
+		}
+	}
+	if len(slugs) == 0 {
+		return "", nil, fmt.Errorf("tags must name at least one tag")
+	}
+
+	placeholders, args := helpers.InStringPlaceholders(slugs)
+	subquery := fmt.Sprintf("SELECT pt.product_id FROM product_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.slug IN (%s)", placeholders)
+
+	switch r.URL.Query().Get("tag_mode") {
+	case "", "any":
+		return fmt.Sprintf("id IN (%s)", subquery), args, nil
+	case "all":
+		subquery += " GROUP BY pt.product_id HAVING COUNT(DISTINCT t.id) = ?"
+		return fmt.Sprintf("id IN (%s)", subquery), append(args, len(slugs)), nil
+	default:
+		return "", nil, fmt.Errorf("tag_mode must be all or any")
+	}
+}
+
+// attachTagsToProducts fills Tags on each product, using an empty list for
+// products without tags.
+func attachTagsToProducts(products []models.Product) error {
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	tags, err := loadProductTags(ids)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		products[i].Tags = tags[products[i].ID]
+		if products[i].Tags == nil {
+			products[i].Tags = []models.Tag{}
+		}
+	}
+	return nil
+}
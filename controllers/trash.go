@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/search"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// includeDeleted reports whether the request asked for trashed rows with
+// ?include_deleted=true. Only administrators may; for anyone else it writes
+// the error response and returns ok == false.
+func includeDeleted(w http.ResponseWriter, r *http.Request) (withDeleted bool, ok bool) {
+	if r.URL.Query().Get("include_deleted") != "true" {
+		return false, true
+	}
+
+	userID, signedIn := r.Context().Value("userID").(int)
+	if !signedIn {
+		http.Error(w, "include_deleted requires an administrator token", http.StatusUnauthorized)
+		return false, false
+	}
+
+	admin, err := callerIsAdmin(r, userID)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		fmt.Printf("Error checking admin flag: %v\n", err)
+		return false, false
+	}
+	if !admin {
+		http.Error(w, "include_deleted is only available to administrators", http.StatusForbidden)
+		return false, false
+	}
+	return true, true
+}
+
+// DeleteProduct serves DELETE /products/{id}, moving the product to the
+// trash.
+func DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/products/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if !authorizeProduct(w, id, userID, models.ShopManager) {
+		return
+	}
+
+	versions, ok := checkIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = trashProduct(database.DB, id, versions)
+	if err != nil {
+		writeProductError(w, err, "Failed to delete product")
+		return
+	}
+
+	if err := search.Default.Remove(id); err != nil {
+		fmt.Printf("Error removing product %d from search: %v\n", id, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Product deleted successfully")
+}
+
+// trashProduct moves product id to the trash, provided it is at one of
+// versions (any version if nil).
+func trashProduct(store productStore, id int, versions []int) error {
+	condition, conditionArgs := versionCondition(versions)
+	query := "UPDATE products SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL" + condition
+	result, err := store.Exec(query, append([]interface{}{time.Now(), id}, conditionArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 && versions != nil {
+		return errVersionMismatch
+	}
+	return nil
+}
+
+// RestoreProduct serves POST /restore/products/{id} for the product's
+// owner or a manager of its shop. The product's category must not be in
+// the trash itself.
+func RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/restore/products/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var ownerID int
+	var shopID sql.NullInt64
+	var memberRole sql.NullString
+	var categoryDeleted bool
+	query := `SELECT p.user_id, p.shop_id, m.role, c.deleted_at IS NOT NULL FROM products p
+		JOIN categories c ON c.id = p.category_id
+		LEFT JOIN shop_members m ON m.shop_id = p.shop_id AND m.user_id = ?
+		WHERE p.id = ? AND p.deleted_at IS NOT NULL`
+	err = database.DB.QueryRow(query, userID, id).Scan(&ownerID, &shopID, &memberRole, &categoryDeleted)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found in trash", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	err = requireRole(productRole(userID, ownerID, shopID, memberRole), models.ShopManager)
+	if err != nil {
+		writeProductError(w, err, "Failed to restore product")
+		return
+	}
+	if categoryDeleted {
+		http.Error(w, "The product's category is in the trash; restore it first", http.StatusConflict)
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE products SET deleted_at = NULL WHERE id = ?", id)
+	if err != nil {
+		http.Error(w, "Failed to restore product", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	reindexProduct(id)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Product restored successfully")
+}
+
+// RestoreCategory serves POST /restore/categories/{id}. Subcategories and
+// products that were trashed together with the category, by a cascading
+// delete, are restored with it, provided the caller manages every one of
+// those products.
+func RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/restore/categories/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to restore category", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	var deletedAt []byte
+	err = tx.QueryRow("SELECT parent_id, deleted_at FROM categories WHERE id = ? AND deleted_at IS NOT NULL FOR UPDATE", id).Scan(&parentID, &deletedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found in trash", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch category", http.StatusInternalServerError)
+		fmt.Printf("Error fetching category: %v\n", err)
+		return
+	}
+
+	if parentID.Valid {
+		var parentDeleted bool
+		err = tx.QueryRow("SELECT deleted_at IS NOT NULL FROM categories WHERE id = ? FOR UPDATE", parentID.Int64).Scan(&parentDeleted)
+		if err != nil {
+			http.Error(w, "Failed to fetch parent category", http.StatusInternalServerError)
+			fmt.Printf("Error fetching parent category: %v\n", err)
+			return
+		}
+		if parentDeleted {
+			http.Error(w, "The parent category is in the trash; restore it first", http.StatusConflict)
+			return
+		}
+	}
+
+	// Compared as the stored string so no time zone conversion can get in
+	// the way
+	trashedAt := string(deletedAt)
+
+	// The category plus the part of its subtree trashed in the same delete
+	query := `WITH RECURSIVE batch (id) AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION DISTINCT
+			SELECT c.id FROM categories c JOIN batch b ON c.parent_id = b.id
+			WHERE c.deleted_at = ?
+		)
+		SELECT id FROM batch`
+	categoryIDs, err := scanIDs(tx.Query(query, id, trashedAt))
+	if err != nil {
+		http.Error(w, "Failed to fetch subcategories", http.StatusInternalServerError)
+		fmt.Printf("Error fetching subcategories: %v\n", err)
+		return
+	}
+
+	placeholders, args := helpers.InPlaceholders(categoryIDs)
+	productIDs, foreign, err := lockManagedProducts(tx, fmt.Sprintf("p.category_id IN (%s) AND p.deleted_at = ?", placeholders), append(args, trashedAt), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching products: %v\n", err)
+		return
+	}
+	if foreign > 0 {
+		http.Error(w, fmt.Sprintf("Cannot restore: %d products trashed with this category belong to other users or to shops you do not manage", foreign), http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE categories SET deleted_at = NULL WHERE id IN (%s)", placeholders), args...)
+	if err == nil && len(productIDs) > 0 {
+		productPlaceholders, productArgs := helpers.InPlaceholders(productIDs)
+		_, err = tx.Exec(fmt.Sprintf("UPDATE products SET deleted_at = NULL WHERE id IN (%s)", productPlaceholders), productArgs...)
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore category", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to restore category", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	for _, productID := range productIDs {
+		reindexProduct(productID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Category restored successfully with %d subcategories and %d products", len(categoryIDs)-1, len(productIDs))
+}
+
+// GetTrash serves GET /trash: the caller's trashed products, or with
+// ?shop_id= a shop's, and every trashed category, most recently deleted
+// first.
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	c, ok := requestCatalog(w, r, userID, models.ShopEditor)
+	if !ok {
+		return
+	}
+
+	condition, args := c.condition("")
+	query := "SELECT id, name, price, currency, user_id, shop_id, category_id, stock, low_stock_threshold, status, created_at, updated_at, deleted_at FROM products WHERE " + condition + " AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id"
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var product models.Product
+		var createdAt, updatedAt, deletedAt []byte
+
+		err := rows.Scan(&product.ID, &product.Name, &product.Price, &product.Currency, &product.User_id, &product.Shop_id, &product.Category_id, &product.Stock, &product.Low_stock_threshold, &product.Status, &createdAt, &updatedAt, &deletedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan product", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+
+		product.Images = []models.ProductImage{}
+		product.Tags = []models.Tag{}
+		product.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err == nil {
+			product.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+		}
+		if err == nil {
+			product.Deleted_at, err = helpers.ParseNullableDatetime(deletedAt)
+		}
+		if err != nil {
+			http.Error(w, "Failed to parse product dates", http.StatusInternalServerError)
+			fmt.Printf("Error parsing product dates: %v\n", err)
+			return
+		}
+
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	categoryRows, err := database.DB.Query("SELECT " + categoryColumns + " FROM categories WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+	if err != nil {
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer categoryRows.Close()
+
+	categories := []models.Category{}
+	for categoryRows.Next() {
+		category, err := scanCategory(categoryRows)
+		if err != nil {
+			http.Error(w, "Failed to scan category", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		categories = append(categories, category)
+	}
+	if err := categoryRows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"products":   products,
+		"categories": categories,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// scanIDs collects the single integer column of rows.
+func scanIDs(rows *sql.Rows, err error) ([]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,904 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authorizeProduct writes the error response and returns false unless
+// userID holds at least role over productID.
+func authorizeProduct(w http.ResponseWriter, productID, userID int, role string) bool {
+	err := checkProductRole(database.DB, productID, userID, role, false)
+	if err != nil {
+		writeProductError(w, err, "Failed to fetch product")
+		return false
+	}
+	return true
+}
+
+// checkProductRole is authorizeProduct for callers that report errors
+// themselves. With lock set the product row, and the caller's membership
+// of its shop, are locked until the transaction q belongs to ends.
+func checkProductRole(q rowQueryer, productID, userID int, role string, lock bool) error {
+	query := `SELECT p.user_id, p.shop_id, m.role FROM products p
+		LEFT JOIN shop_members m ON m.shop_id = p.shop_id AND m.user_id = ?
+		WHERE p.id = ? AND p.deleted_at IS NULL`
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var ownerID int
+	var shopID sql.NullInt64
+	var memberRole sql.NullString
+	err := q.QueryRow(query, userID, productID).Scan(&ownerID, &shopID, &memberRole)
+	if err == sql.ErrNoRows {
+		return &productError{Status: http.StatusNotFound, Message: "Product not found"}
+	} else if err != nil {
+		return err
+	}
+
+	return requireRole(productRole(userID, ownerID, shopID, memberRole), role)
+}
+
+// ProductOptions serves /options/products/{id}: GET lists the product's
+// options, POST adds one together with its values.
+func ProductOptions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/options/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		options, err := loadProductOptions(productID)
+		if err != nil {
+			http.Error(w, "Failed to fetch options", http.StatusInternalServerError)
+			fmt.Printf("Error fetching options: %v\n", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]interface{}{"options": options})
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	var input struct {
+		Name     string   `json:"name"`
+		Position int      `json:"position"`
+		Values   []string `json:"values"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Values) == 0 {
+		http.Error(w, "Name and at least one value are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create option", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the product serializes this with variant creation, so a
+	// variant cannot appear between the count below and the insert
+	var locked int
+	err = tx.QueryRow("SELECT id FROM products WHERE id = ? FOR UPDATE", productID).Scan(&locked)
+	if err != nil {
+		http.Error(w, "Failed to create option", http.StatusInternalServerError)
+		fmt.Printf("Error locking product: %v\n", err)
+		return
+	}
+
+	// Variants need one value per option, so a new option would leave
+	// existing variants incomplete
+	var variantCount int
+	err = tx.QueryRow("SELECT COUNT(*) FROM product_variants WHERE product_id = ?", productID).Scan(&variantCount)
+	if err != nil {
+		http.Error(w, "Failed to check variants", http.StatusInternalServerError)
+		fmt.Printf("Error counting variants: %v\n", err)
+		return
+	}
+	if variantCount > 0 {
+		http.Error(w, "Delete the product's variants before adding options", http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO product_options (product_id, name, position) VALUES (?, ?, ?)", productID, input.Name, input.Position)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "name", "The product already has an option with this name")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create option", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	optionID, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+
+	option := models.ProductOption{ID: int(optionID), Product_id: productID, Name: input.Name, Position: input.Position}
+	for position, value := range input.Values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			http.Error(w, "Option values must not be empty", http.StatusBadRequest)
+			return
+		}
+
+		result, err := tx.Exec("INSERT INTO product_option_values (option_id, value, position) VALUES (?, ?, ?)", optionID, value, position)
+		if _, dup := database.DuplicateKey(err); dup {
+			writeConflict(w, "values", fmt.Sprintf("Duplicate option value: %s", value))
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to create option value", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+
+		valueID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+			return
+		}
+		option.Values = append(option.Values, models.ProductOptionValue{ID: int(valueID), Option_id: int(optionID), Value: value, Position: position})
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to create option", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"option": option})
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// DeleteOption serves DELETE /options/{id}. Options still used by a
+// variant cannot be removed.
+func DeleteOption(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/options/")
+	optionID, err := strconv.Atoi(idStr)
+	if err != nil || optionID <= 0 {
+		http.Error(w, "Invalid option ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	var productID int
+	err = database.DB.QueryRow("SELECT product_id FROM product_options WHERE id = ?", optionID).Scan(&productID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Option not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch option", http.StatusInternalServerError)
+		fmt.Printf("Error fetching option: %v\n", err)
+		return
+	}
+
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	var inUse bool
+	query := `SELECT EXISTS(SELECT 1 FROM product_variant_values vv
+		JOIN product_option_values ov ON ov.id = vv.option_value_id
+		WHERE ov.option_id = ?)`
+	err = database.DB.QueryRow(query, optionID).Scan(&inUse)
+	if err != nil {
+		http.Error(w, "Failed to check option usage", http.StatusInternalServerError)
+		fmt.Printf("Error checking option usage: %v\n", err)
+		return
+	}
+	if inUse {
+		http.Error(w, "Option is used by variants", http.StatusConflict)
+		return
+	}
+
+	_, err = database.DB.Exec("DELETE FROM product_options WHERE id = ?", optionID)
+	if err != nil {
+		http.Error(w, "Failed to delete option", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Option deleted successfully")
+}
+
+// ProductVariants serves /variants/products/{id}: GET lists the product's
+// variants, POST creates one.
+func ProductVariants(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/variants/products/")
+	productID, err := strconv.Atoi(idStr)
+	if err != nil || productID <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		var basePrice int
+		err = database.DB.QueryRow("SELECT price FROM products WHERE id = ?", productID).Scan(&basePrice)
+		if err != nil {
+			http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+			fmt.Printf("Error fetching product: %v\n", err)
+			return
+		}
+
+		variants, err := loadProductVariants(productID, basePrice)
+		if err != nil {
+			http.Error(w, "Failed to fetch variants", http.StatusInternalServerError)
+			fmt.Printf("Error fetching variants: %v\n", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]interface{}{"variants": variants})
+		if err != nil {
+			fmt.Printf("Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	var variant models.ProductVariant
+	err = helpers.ParseJSONRequestBody(r, &variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	variant.SKU = strings.TrimSpace(variant.SKU)
+	if variant.SKU == "" {
+		http.Error(w, "SKU is required", http.StatusBadRequest)
+		return
+	}
+	if variant.Price != nil && *variant.Price <= 0 {
+		http.Error(w, "Price must be positive when given", http.StatusBadRequest)
+		return
+	}
+	if variant.Stock < 0 {
+		http.Error(w, "Stock must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	options, err := loadProductOptions(productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch options", http.StatusInternalServerError)
+		fmt.Printf("Error fetching options: %v\n", err)
+		return
+	}
+
+	// Exactly one value of each of the product's options
+	valueOption := map[int]int{}
+	for _, option := range options {
+		for _, value := range option.Values {
+			valueOption[value.ID] = option.ID
+		}
+	}
+	seenOption := map[int]bool{}
+	for _, valueID := range variant.Option_value_ids {
+		optionID, ok := valueOption[valueID]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Option value %d does not belong to this product", valueID), http.StatusBadRequest)
+			return
+		}
+		if seenOption[optionID] {
+			http.Error(w, "Only one value per option is allowed", http.StatusBadRequest)
+			return
+		}
+		seenOption[optionID] = true
+	}
+	if len(seenOption) != len(options) {
+		http.Error(w, "A value is required for every option of the product", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the product serializes variant creation, so two requests
+	// cannot both find a combination free and both insert it
+	var locked int
+	err = tx.QueryRow("SELECT id FROM products WHERE id = ? FOR UPDATE", productID).Scan(&locked)
+	if err != nil {
+		http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+		fmt.Printf("Error locking product: %v\n", err)
+		return
+	}
+
+	signatures, err := variantSignatures(tx, productID)
+	if err != nil {
+		http.Error(w, "Failed to fetch variants", http.StatusInternalServerError)
+		fmt.Printf("Error fetching variants: %v\n", err)
+		return
+	}
+	if sku, taken := signatures[variantSignature(variant.Option_value_ids)]; taken {
+		writeConflict(w, "option_value_ids", fmt.Sprintf("Variant %s already has this combination", sku))
+		return
+	}
+
+	// Stock starts at zero and the initial quantity is booked as a restock,
+	// as for products
+	now := time.Now()
+	query := "INSERT INTO product_variants (product_id, sku, price, stock, created_at, updated_at) VALUES (?, ?, ?, 0, ?, ?)"
+	result, err := tx.Exec(query, productID, variant.SKU, variant.Price, now, sql.NullTime{Valid: false})
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "sku", "SKU is already in use")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+
+	variantID, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+
+	for _, valueID := range variant.Option_value_ids {
+		_, err = tx.Exec("INSERT INTO product_variant_values (variant_id, option_value_id) VALUES (?, ?)", variantID, valueID)
+		if err != nil {
+			http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+	}
+
+	if variant.Stock > 0 {
+		_, err = applyVariantStockMovement(tx, productID, int(variantID), userID, "restock", variant.Stock, "Initial stock")
+		if err != nil {
+			http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+			fmt.Printf("Error recording initial stock: %v\n", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to create variant", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Variant created successfully with ID: %d", variantID)
+}
+
+// Variant serves /variants/{id}: PUT updates SKU, price and stock, DELETE
+// removes the variant.
+func Variant(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/variants/")
+	variantID, err := strconv.Atoi(idStr)
+	if err != nil || variantID <= 0 {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var productID int
+	err = database.DB.QueryRow("SELECT product_id FROM product_variants WHERE id = ?", variantID).Scan(&productID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch variant", http.StatusInternalServerError)
+		fmt.Printf("Error fetching variant: %v\n", err)
+		return
+	}
+
+	if !authorizeProduct(w, productID, userID, models.ShopEditor) {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		_, err = database.DB.Exec("DELETE FROM product_variants WHERE id = ?", variantID)
+		if err != nil {
+			http.Error(w, "Failed to delete variant", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Variant deleted successfully")
+		return
+	}
+
+	// Stock is a pointer so that it can be set to zero
+	var variant struct {
+		SKU              string `json:"sku"`
+		Price            *int   `json:"price"`
+		Stock            *int   `json:"stock"`
+		Reason           string `json:"reason"`
+		Option_value_ids []int  `json:"option_value_ids"`
+	}
+	err = helpers.ParseJSONRequestBody(r, &variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	if len(variant.Option_value_ids) > 0 {
+		http.Error(w, "Option values of a variant cannot be changed; create a new variant instead", http.StatusBadRequest)
+		return
+	}
+
+	var setClauses []string
+	var args []interface{}
+
+	if sku := strings.TrimSpace(variant.SKU); sku != "" {
+		setClauses = append(setClauses, "sku = ?")
+		args = append(args, sku)
+	}
+
+	if variant.Price != nil {
+		// A price of 0 clears the override so the product price applies again
+		if *variant.Price < 0 {
+			http.Error(w, "Price must not be negative", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, "price = ?")
+		if *variant.Price == 0 {
+			args = append(args, nil)
+		} else {
+			args = append(args, *variant.Price)
+		}
+	}
+
+	if variant.Stock != nil && *variant.Stock < 0 {
+		http.Error(w, "Stock must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if len(setClauses) == 0 && variant.Stock == nil {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update variant", http.StatusInternalServerError)
+		fmt.Printf("Error starting transaction: %v\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if len(setClauses) > 0 {
+		setClauses = append(setClauses, "updated_at = ?")
+		args = append(args, sql.NullTime{Time: time.Now(), Valid: true})
+
+		query := fmt.Sprintf("UPDATE product_variants SET %s WHERE id = ?", strings.Join(setClauses, ", "))
+		args = append(args, variantID)
+
+		_, err = tx.Exec(query, args...)
+		if _, dup := database.DuplicateKey(err); dup {
+			writeConflict(w, "sku", "SKU is already in use")
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to update variant", http.StatusInternalServerError)
+			fmt.Printf("Error executing query: %v\n", err)
+			return
+		}
+	}
+
+	// A new stock level is booked as an adjustment by the difference, so
+	// the movement log adds up
+	if variant.Stock != nil {
+		var stock int
+		err = tx.QueryRow("SELECT stock FROM product_variants WHERE id = ? FOR UPDATE", variantID).Scan(&stock)
+		if err != nil {
+			http.Error(w, "Failed to update variant", http.StatusInternalServerError)
+			fmt.Printf("Error fetching variant stock: %v\n", err)
+			return
+		}
+
+		if delta := *variant.Stock - stock; delta != 0 {
+			reason := variant.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("Stock set to %d", *variant.Stock)
+			}
+			_, err = applyVariantStockMovement(tx, productID, variantID, userID, "adjustment", delta, reason)
+			if err != nil {
+				http.Error(w, "Failed to update variant", http.StatusInternalServerError)
+				fmt.Printf("Error adjusting variant stock: %v\n", err)
+				return
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		http.Error(w, "Failed to update variant", http.StatusInternalServerError)
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Variant updated successfully")
+}
+
+// GetProductDetail serves GET /products/{id} with the product's images,
+// options and variants nested in.
+func GetProductDetail(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/products/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	currency, locale, err := requestedDisplay(r)
+	if err != nil {
+		http.Error(w, "Currency must be a supported ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+
+	withDeleted, ok := includeDeleted(w, r)
+	if !ok {
+		return
+	}
+
+	var product models.ProductDetail
+	var publishAt []byte
+	var createdAt []byte
+	var updatedAt []byte
+	var deletedAt []byte
+
+	query := "SELECT id, sku, version, name, price, currency, user_id, shop_id, category_id, stock, low_stock_threshold, status, publish_at, rating_avg, rating_count, created_at, updated_at, deleted_at FROM products WHERE id = ?"
+	if !withDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	err = database.DB.QueryRow(query, id).Scan(&product.ID, &product.SKU, &product.Version, &product.Name, &product.Price, &product.Currency, &product.User_id, &product.Shop_id, &product.Category_id, &product.Stock, &product.Low_stock_threshold, &product.Status, &publishAt, &product.Rating_avg, &product.Rating_count, &createdAt, &updatedAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	// Unpublished products are only shown to their owner
+	if !withDeleted && !canViewProduct(r, product.Product) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	product.Publish_at, err = helpers.ParseOptionalDatetime(publishAt)
+	if err != nil {
+		http.Error(w, "Failed to parse publish_at", http.StatusInternalServerError)
+		fmt.Printf("Error parsing publish_at: %v\n", err)
+		return
+	}
+
+	product.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		http.Error(w, "Failed to parse created_at", http.StatusInternalServerError)
+		fmt.Printf("Error parsing created_at: %v\n", err)
+		return
+	}
+
+	product.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	if err != nil {
+		http.Error(w, "Failed to parse updated_at", http.StatusInternalServerError)
+		fmt.Printf("Error parsing updated_at: %v\n", err)
+		return
+	}
+
+	product.Deleted_at, err = helpers.ParseNullableDatetime(deletedAt)
+	if err != nil {
+		http.Error(w, "Failed to parse deleted_at", http.StatusInternalServerError)
+		fmt.Printf("Error parsing deleted_at: %v\n", err)
+		return
+	}
+
+	images, err := loadProductImages([]int{product.ID})
+	if err != nil {
+		http.Error(w, "Failed to fetch product images", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product images: %v\n", err)
+		return
+	}
+	product.Images = images[product.ID]
+	if product.Images == nil {
+		product.Images = []models.ProductImage{}
+	}
+
+	tags, err := loadProductTags([]int{product.ID})
+	if err != nil {
+		http.Error(w, "Failed to fetch product tags", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product tags: %v\n", err)
+		return
+	}
+	product.Tags = tags[product.ID]
+	if product.Tags == nil {
+		product.Tags = []models.Tag{}
+	}
+
+	favorites := []models.Product{product.Product}
+	err = markFavorites(r, favorites)
+	if err != nil {
+		http.Error(w, "Failed to fetch wishlists", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlists: %v\n", err)
+		return
+	}
+	product.Favorited = favorites[0].Favorited
+
+	product.Options, err = loadProductOptions(product.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch options", http.StatusInternalServerError)
+		fmt.Printf("Error fetching options: %v\n", err)
+		return
+	}
+
+	product.Variants, err = loadProductVariants(product.ID, product.Price)
+	if err != nil {
+		http.Error(w, "Failed to fetch variants", http.StatusInternalServerError)
+		fmt.Printf("Error fetching variants: %v\n", err)
+		return
+	}
+
+	if currency != "" {
+		err = convertProductDetailPrices(&product, currency, locale)
+		if err != nil {
+			writeConversionError(w, currency, err)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"product": product,
+	}
+
+	writeVersionedJSON(w, r, product.Version, response)
+}
+
+func loadProductOptions(productID int) ([]models.ProductOption, error) {
+	query := `SELECT o.id, o.name, o.position, v.id, v.value, v.position
+		FROM product_options o
+		LEFT JOIN product_option_values v ON v.option_id = o.id
+		WHERE o.product_id = ?
+		ORDER BY o.position, o.id, v.position, v.id`
+	rows, err := database.DB.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []models.ProductOption{}
+	for rows.Next() {
+		var option models.ProductOption
+		var valueID, valuePosition sql.NullInt64
+		var value sql.NullString
+
+		err := rows.Scan(&option.ID, &option.Name, &option.Position, &valueID, &value, &valuePosition)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(options) == 0 || options[len(options)-1].ID != option.ID {
+			option.Product_id = productID
+			option.Values = []models.ProductOptionValue{}
+			options = append(options, option)
+		}
+
+		if valueID.Valid {
+			last := &options[len(options)-1]
+			last.Values = append(last.Values, models.ProductOptionValue{
+				ID:        int(valueID.Int64),
+				Option_id: option.ID,
+				Value:     value.String,
+				Position:  int(valuePosition.Int64),
+			})
+		}
+	}
+
+	return options, rows.Err()
+}
+
+func loadProductVariants(productID, basePrice int) ([]models.ProductVariant, error) {
+	query := "SELECT id, sku, price, stock, created_at, updated_at FROM product_variants WHERE product_id = ? ORDER BY id"
+	rows, err := database.DB.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []models.ProductVariant{}
+	index := map[int]int{}
+	for rows.Next() {
+		var variant models.ProductVariant
+		var price sql.NullInt64
+		var createdAt, updatedAt []byte
+
+		err := rows.Scan(&variant.ID, &variant.SKU, &price, &variant.Stock, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		variant.Product_id = productID
+		variant.Effective_price = basePrice
+		if price.Valid {
+			p := int(price.Int64)
+			variant.Price = &p
+			variant.Effective_price = p
+		}
+
+		variant.Created_at, err = helpers.ParseDatetime(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		variant.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		variant.Options = []models.VariantOptionValue{}
+		index[variant.ID] = len(variants)
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(variants) == 0 {
+		return variants, nil
+	}
+
+	query = `SELECT vv.variant_id, o.id, o.name, ov.id, ov.value
+		FROM product_variant_values vv
+		JOIN product_variants pv ON pv.id = vv.variant_id
+		JOIN product_option_values ov ON ov.id = vv.option_value_id
+		JOIN product_options o ON o.id = ov.option_id
+		WHERE pv.product_id = ?
+		ORDER BY o.position, o.id`
+	valueRows, err := database.DB.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer valueRows.Close()
+
+	for valueRows.Next() {
+		var variantID int
+		var value models.VariantOptionValue
+
+		err := valueRows.Scan(&variantID, &value.Option_id, &value.Option, &value.Value_id, &value.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[variantID]; ok {
+			variants[i].Options = append(variants[i].Options, value)
+			variants[i].Option_value_ids = append(variants[i].Option_value_ids, value.Value_id)
+		}
+	}
+
+	return variants, valueRows.Err()
+}
+
+// variantSignatures maps the option combination of each of productID's
+// variants to the variant's SKU.
+func variantSignatures(tx *sql.Tx, productID int) (map[string]string, error) {
+	query := `SELECT pv.id, pv.sku, vv.option_value_id
+		FROM product_variants pv
+		LEFT JOIN product_variant_values vv ON vv.variant_id = pv.id
+		WHERE pv.product_id = ?`
+	rows, err := tx.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skus := map[int]string{}
+	valueIDs := map[int][]int{}
+	for rows.Next() {
+		var variantID int
+		var sku string
+		var valueID sql.NullInt64
+		err := rows.Scan(&variantID, &sku, &valueID)
+		if err != nil {
+			return nil, err
+		}
+		skus[variantID] = sku
+		if valueID.Valid {
+			valueIDs[variantID] = append(valueIDs[variantID], int(valueID.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	signatures := map[string]string{}
+	for variantID, sku := range skus {
+		signatures[variantSignature(valueIDs[variantID])] = sku
+	}
+	return signatures, nil
+}
+
+// variantSignature identifies a combination of option values regardless
+// of order.
+func variantSignature(valueIDs []int) string {
+	sorted := append([]int(nil), valueIDs...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, id := range sorted {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"database/sql/driver"
+	"loginApi/database/dbtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProductOptionsChecksVariantsUnderLock(t *testing.T) {
+	for _, variants := range []int{0, 2} {
+		stub := dbtest.Use(t)
+		stub.On(`FROM products p LEFT JOIN shop_members m`, func([]driver.Value) (dbtest.Result, error) {
+			return dbtest.Rows([]string{"user_id", "shop_id", "role"}, []driver.Value{7, nil, nil}), nil
+		})
+		stub.On(`^SELECT id FROM products WHERE id = \? FOR UPDATE$`, func([]driver.Value) (dbtest.Result, error) {
+			return dbtest.Rows([]string{"id"}, []driver.Value{3}), nil
+		})
+		stub.On(`^SELECT COUNT\(\*\) FROM product_variants`, func([]driver.Value) (dbtest.Result, error) {
+			return dbtest.Rows([]string{"count"}, []driver.Value{variants}), nil
+		})
+		stub.On(`^INSERT INTO product_option`, func([]driver.Value) (dbtest.Result, error) {
+			return dbtest.Result{InsertID: 1, Affected: 1}, nil
+		})
+
+		r := httptest.NewRequest(http.MethodPost, "/options/products/3", strings.NewReader(`{"name": "Size", "values": ["S", "M"]}`))
+		r.Header.Set("Content-Type", "application/json")
+		r = r.WithContext(context.WithValue(r.Context(), "userID", 7))
+		w := httptest.NewRecorder()
+		ProductOptions(w, r)
+
+		want := http.StatusCreated
+		if variants > 0 {
+			want = http.StatusConflict
+		}
+		if w.Code != want {
+			t.Fatalf("%d variants: status %d, want %d: %s", variants, w.Code, want, w.Body)
+		}
+
+		// The count must see the product locked, inside the transaction
+		begin, lock, count := -1, -1, -1
+		for i, statement := range stub.Statements() {
+			switch {
+			case statement == "BEGIN":
+				begin = i
+			case strings.HasPrefix(statement, "SELECT id FROM products") && strings.HasSuffix(statement, "FOR UPDATE"):
+				lock = i
+			case strings.HasPrefix(statement, "SELECT COUNT(*) FROM product_variants"):
+				count = i
+			}
+		}
+		if begin < 0 || lock < begin || count < lock {
+			t.Fatalf("%d variants: statements %q", variants, stub.Statements())
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/models"
+	"loginApi/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxWishlistName = 100
+
+const wishlistColumns = "w.id, w.user_id, w.name, w.share_token, (SELECT COUNT(*) FROM wishlist_items wi WHERE wi.wishlist_id = w.id), w.created_at, w.updated_at"
+
+func scanWishlist(row rowScanner) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	var createdAt, updatedAt []byte
+
+	err := row.Scan(&wishlist.ID, &wishlist.User_id, &wishlist.Name, &wishlist.Share_token, &wishlist.Item_count, &createdAt, &updatedAt)
+	if err != nil {
+		return wishlist, err
+	}
+
+	wishlist.Created_at, err = helpers.ParseDatetime(createdAt)
+	if err != nil {
+		return wishlist, err
+	}
+	wishlist.Updated_at, err = helpers.ParseNullableDatetime(updatedAt)
+	return wishlist, err
+}
+
+// markFavorites sets Favorited on each product for signed-in callers: true
+// when the product is on any of their wishlists. One query covers the whole
+// page. Anonymous callers get no flag.
+func markFavorites(r *http.Request, products []models.Product) error {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok || len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	placeholders, args := helpers.InPlaceholders(ids)
+
+	query := fmt.Sprintf(`SELECT DISTINCT wi.product_id FROM wishlist_items wi
+		JOIN wishlists w ON w.id = wi.wishlist_id
+		WHERE w.user_id = ? AND wi.product_id IN (%s)`, placeholders)
+	favorites, err := scanIDs(database.DB.Query(query, append([]interface{}{userID}, args...)...))
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		favorited := containsInt(favorites, products[i].ID)
+		products[i].Favorited = &favorited
+	}
+	return nil
+}
+
+// wishlistProducts returns the products on a wishlist, most recently added
+// first. Products that are no longer published are left out.
+func wishlistProducts(wishlistID int) ([]models.Product, error) {
+	ids, err := scanIDs(database.DB.Query("SELECT product_id FROM wishlist_items WHERE wishlist_id = ? ORDER BY created_at DESC, product_id DESC", wishlistID))
+	if err != nil {
+		return nil, err
+	}
+
+	byID, err := loadProductsByID(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []models.Product{}
+	for _, id := range ids {
+		if product, ok := byID[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+func validWishlistName(w http.ResponseWriter, name string) bool {
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if len(name) > maxWishlistName {
+		http.Error(w, fmt.Sprintf("Name must be at most %d characters", maxWishlistName), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// Wishlists serves the caller's wishlists:
+//
+//	GET    /wishlists                              list them
+//	POST   /wishlists                              create one
+//	GET    /wishlists/{id}                         one list with its products
+//	PUT    /wishlists/{id}                         rename it
+//	DELETE /wishlists/{id}                         delete it
+//	POST   /wishlists/{id}/products/{product_id}   add a product
+//	DELETE /wishlists/{id}/products/{product_id}   remove a product
+func Wishlists(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/wishlists"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			GetWishlists(w, r)
+		case http.MethodPost:
+			CreateWishlist(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	idStr, rest, _ := strings.Cut(path, "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid wishlist ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if rest != "" {
+		productStr := strings.TrimPrefix(rest, "products/")
+		productID, err := strconv.Atoi(productStr)
+		if productStr == rest || err != nil || productID <= 0 {
+			http.Error(w, "Invalid product ID", http.StatusBadRequest)
+			fmt.Printf("Invalid ID: %v\n", productStr)
+			return
+		}
+		WishlistItem(w, r, id, productID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		GetWishlist(w, r, id)
+	case http.MethodPut:
+		RenameWishlist(w, r, id)
+	case http.MethodDelete:
+		DeleteWishlist(w, r, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ownWishlist reports whether the wishlist exists and belongs to userID,
+// writing the error response if not.
+func ownWishlist(w http.ResponseWriter, wishlistID, userID int) bool {
+	var ownerID int
+	err := database.DB.QueryRow("SELECT user_id FROM wishlists WHERE id = ?", wishlistID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		// Other users' lists are reported as missing rather than forbidden
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlist: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func GetWishlists(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	rows, err := database.DB.Query("SELECT "+wishlistColumns+" FROM wishlists w WHERE w.user_id = ? ORDER BY w.name", userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch wishlists", http.StatusInternalServerError)
+		fmt.Printf("Error executing query: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	wishlists := []models.Wishlist{}
+	for rows.Next() {
+		wishlist, err := scanWishlist(rows)
+		if err != nil {
+			http.Error(w, "Failed to scan wishlist", http.StatusInternalServerError)
+			fmt.Printf("Error scanning row: %v\n", err)
+			return
+		}
+		wishlists = append(wishlists, wishlist)
+	}
+
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Error during row iteration", http.StatusInternalServerError)
+		fmt.Printf("Error during row iteration: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"wishlists": wishlists,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+func CreateWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	var wishlist models.Wishlist
+	err := helpers.ParseJSONRequestBody(r, &wishlist)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	wishlist.Name = strings.TrimSpace(wishlist.Name)
+	if !validWishlistName(w, wishlist.Name) {
+		return
+	}
+
+	result, err := database.DB.Exec("INSERT INTO wishlists (user_id, name, created_at) VALUES (?, ?, ?)", userID, wishlist.Name, time.Now())
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "name", "You already have a wishlist with this name")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to create wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error inserting wishlist: %v\n", err)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, "Failed to retrieve last insert ID", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "Wishlist created successfully with ID: %d", id)
+}
+
+func GetWishlist(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	wishlist, err := scanWishlist(database.DB.QueryRow("SELECT "+wishlistColumns+" FROM wishlists w WHERE w.id = ? AND w.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlist: %v\n", err)
+		return
+	}
+
+	writeWishlist(w, r, wishlist)
+}
+
+func RenameWishlist(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	var input models.Wishlist
+	err := helpers.ParseJSONRequestBody(r, &input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		fmt.Printf("Error parsing JSON: %v\n", err)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if !validWishlistName(w, input.Name) {
+		return
+	}
+
+	if !ownWishlist(w, id, userID) {
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE wishlists SET name = ?, updated_at = ? WHERE id = ?", input.Name, time.Now(), id)
+	if _, dup := database.DuplicateKey(err); dup {
+		writeConflict(w, "name", "You already have a wishlist with this name")
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to rename wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error renaming wishlist: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Wishlist updated successfully")
+}
+
+func DeleteWishlist(w http.ResponseWriter, r *http.Request, id int) {
+	userID := r.Context().Value("userID").(int)
+
+	result, err := database.DB.Exec("DELETE FROM wishlists WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error deleting wishlist: %v\n", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, "Failed to delete wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error getting rows affected: %v\n", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Wishlist deleted successfully")
+}
+
+// WishlistItem adds a product to or removes it from one of the caller's
+// wishlists. Adding a product that is already there is not an error.
+func WishlistItem(w http.ResponseWriter, r *http.Request, wishlistID, productID int) {
+	userID := r.Context().Value("userID").(int)
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !ownWishlist(w, wishlistID, userID) {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		_, err := database.DB.Exec("DELETE FROM wishlist_items WHERE wishlist_id = ? AND product_id = ?", wishlistID, productID)
+		if err != nil {
+			http.Error(w, "Failed to remove product from wishlist", http.StatusInternalServerError)
+			fmt.Printf("Error removing wishlist item: %v\n", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Product removed from wishlist")
+		return
+	}
+
+	var product models.Product
+	err := database.DB.QueryRow("SELECT user_id, shop_id, status FROM products WHERE id = ? AND deleted_at IS NULL", productID).Scan(&product.User_id, &product.Shop_id, &product.Status)
+	if err == sql.ErrNoRows || (err == nil && !canViewProduct(r, product)) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch product", http.StatusInternalServerError)
+		fmt.Printf("Error fetching product: %v\n", err)
+		return
+	}
+
+	_, err = database.DB.Exec("INSERT IGNORE INTO wishlist_items (wishlist_id, product_id, created_at) VALUES (?, ?, ?)", wishlistID, productID, time.Now())
+	if err != nil {
+		http.Error(w, "Failed to add product to wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error adding wishlist item: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Product added to wishlist")
+}
+
+// ShareWishlist serves /share/wishlists/{id}: POST turns sharing on with a
+// new token, replacing any earlier one, and DELETE turns it off. Links
+// handed out before stop working either way.
+func ShareWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int)
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/share/wishlists/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid wishlist ID", http.StatusBadRequest)
+		fmt.Printf("Invalid ID: %v\n", idStr)
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !ownWishlist(w, id, userID) {
+		return
+	}
+
+	var token interface{}
+	if r.Method == http.MethodPost {
+		token, err = utils.GenerateRandomToken(24)
+		if err != nil {
+			http.Error(w, "Failed to generate share token", http.StatusInternalServerError)
+			fmt.Printf("Error generating share token: %v\n", err)
+			return
+		}
+	}
+
+	_, err = database.DB.Exec("UPDATE wishlists SET share_token = ?, updated_at = ? WHERE id = ?", token, time.Now(), id)
+	if err != nil {
+		http.Error(w, "Failed to update sharing", http.StatusInternalServerError)
+		fmt.Printf("Error updating share token: %v\n", err)
+		return
+	}
+
+	if token == nil {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "Wishlist is no longer shared")
+		return
+	}
+
+	response := map[string]interface{}{
+		"share_token": token,
+		"share_path":  fmt.Sprintf("/shared/wishlists/%s", token),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
+
+// GetSharedWishlist serves GET /shared/wishlists/{token} to anyone holding
+// the link. The owner is not revealed.
+func GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/shared/wishlists/")
+	if token == "" {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+
+	wishlist, err := scanWishlist(database.DB.QueryRow("SELECT "+wishlistColumns+" FROM wishlists w WHERE w.share_token = ?", token))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlist: %v\n", err)
+		return
+	}
+
+	wishlist.User_id = 0
+	wishlist.Share_token = nil
+	writeWishlist(w, r, wishlist)
+}
+
+// writeWishlist responds with a wishlist and its products.
+func writeWishlist(w http.ResponseWriter, r *http.Request, wishlist models.Wishlist) {
+	var err error
+	wishlist.Products, err = wishlistProducts(wishlist.ID)
+	if err == nil {
+		err = markFavorites(r, wishlist.Products)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch wishlist products", http.StatusInternalServerError)
+		fmt.Printf("Error fetching wishlist products: %v\n", err)
+		return
+	}
+	wishlist.Item_count = len(wishlist.Products)
+
+	response := map[string]interface{}{
+		"wishlist": wishlist,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		fmt.Printf("Error encoding JSON: %v\n", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package dbtest replaces database.DB with a scripted stand-in for tests
+// that exercise handlers without a MySQL server. Tests register a handler
+// per statement pattern; statements nobody handles fail, so a test states
+// every query the code under test may run.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"loginApi/database"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Result is what a handled statement returns: rows for queries, the last
+// insert ID and affected row count for everything else.
+type Result struct {
+	Columns  []string
+	Rows     [][]driver.Value
+	InsertID int64
+	Affected int64
+}
+
+// Rows builds a query result with the given columns and rows.
+func Rows(columns []string, rows ...[]driver.Value) Result {
+	return Result{Columns: columns, Rows: rows}
+}
+
+// Handler answers a statement given its arguments.
+type Handler func(args []driver.Value) (Result, error)
+
+type handler struct {
+	pattern *regexp.Regexp
+	fn      Handler
+}
+
+// Stub is the scripted database.
+type Stub struct {
+	mu       sync.Mutex
+	handlers []handler
+	log      []string
+}
+
+// Use installs a fresh Stub as database.DB for the rest of the test.
+func Use(t *testing.T) *Stub {
+	t.Helper()
+	stub := &Stub{}
+	previous := database.DB
+	database.DB = sql.OpenDB(connector{stub})
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = previous
+	})
+	return stub
+}
+
+// On handles statements matching pattern, a regular expression applied to
+// the statement with its whitespace collapsed. Later handlers take
+// precedence, so a test can override an earlier one.
+func (s *Stub) On(pattern string, fn Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handler{regexp.MustCompile(pattern), fn})
+}
+
+// Statements returns the statements run so far, with BEGIN, COMMIT and
+// ROLLBACK marking transactions.
+func (s *Stub) Statements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+// Ran reports whether a statement matching pattern was run.
+func (s *Stub) Ran(pattern string) bool {
+	re := regexp.MustCompile(pattern)
+	for _, statement := range s.Statements() {
+		if re.MatchString(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stub) record(statement string) {
+	s.mu.Lock()
+	s.log = append(s.log, statement)
+	s.mu.Unlock()
+}
+
+func (s *Stub) run(query string, named []driver.NamedValue) (Result, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	s.record(query)
+
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	s.mu.Lock()
+	var fn Handler
+	for i := len(s.handlers) - 1; i >= 0; i-- {
+		if s.handlers[i].pattern.MatchString(query) {
+			fn = s.handlers[i].fn
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if fn == nil {
+		return Result{}, fmt.Errorf("dbtest: unexpected statement %q", query)
+	}
+	return fn(args)
+}
+
+type connector struct{ stub *Stub }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{c.stub}, nil }
+func (c connector) Driver() driver.Driver                        { return stubDriver{} }
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: open through Use")
+}
+
+type conn struct{ stub *Stub }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c.stub, query}, nil }
+func (c *conn) Close() error                              { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.stub.record("BEGIN")
+	return tx{c.stub}, nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.stub.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{result: result}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.stub.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(result), nil
+}
+
+type tx struct{ stub *Stub }
+
+func (t tx) Commit() error {
+	t.stub.record("COMMIT")
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.stub.record("ROLLBACK")
+	return nil
+}
+
+type stmt struct {
+	stub  *Stub
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	result, err := s.stub.run(s.query, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	return execResult(result), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	result, err := s.stub.run(s.query, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	return &rows{result: result}, nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type execResult Result
+
+func (r execResult) LastInsertId() (int64, error) { return r.InsertID, nil }
+func (r execResult) RowsAffected() (int64, error) { return r.Affected, nil }
+
+type rows struct {
+	result Result
+	next   int
+}
+
+func (r *rows) Columns() []string { return r.result.Columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.Rows) {
+		return io.EOF
+	}
+	row := r.result.Rows[r.next]
+	r.next++
+	for i := range dest {
+		dest[i] = normalize(row[i])
+	}
+	return nil
+}
+
+// normalize turns the Go values tests write into the ones drivers return.
+func normalize(value driver.Value) driver.Value {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case string:
+		return []byte(v)
+	}
+	return value
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ER_DUP_ENTRY
+const errDuplicateEntry = 1062
+
+var duplicateKeyPattern = regexp.MustCompile(`for key '(?:[^'.]+\.)?([^']+)'`)
+
+// DuplicateKey reports whether err is a MySQL duplicate-key error and, if
+// so, the name of the unique index that was violated.
+func DuplicateKey(err error) (string, bool) {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != errDuplicateEntry {
+		return "", false
+	}
+
+	match := duplicateKeyPattern.FindStringSubmatch(mysqlErr.Message)
+	if match == nil {
+		return "", true
+	}
+	return match[1], true
+}
@@ -0,0 +1,26 @@
+-- OpenID Connect login: external identities linked to local users and the
+-- short-lived state of in-flight logins. Users created through an identity
+-- provider have no local password or phone number.
+
+ALTER TABLE users
+    MODIFY phone_number VARCHAR(20) NULL,
+    MODIFY password VARCHAR(255) NULL;
+
+CREATE TABLE user_identities (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE KEY uniq_provider_subject (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE oidc_login_states (
+    state_hash CHAR(64) PRIMARY KEY,
+    provider VARCHAR(64) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    expires_at DATETIME NOT NULL
+);
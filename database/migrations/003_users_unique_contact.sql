@@ -0,0 +1,9 @@
+-- Emails are stored normalized (trimmed, lower case) and, like phone
+-- numbers, must be unique. Existing rows are normalized first; resolve any
+-- duplicates this reveals before adding the indexes.
+
+UPDATE users SET email = LOWER(TRIM(email)), phone_number = TRIM(phone_number);
+
+ALTER TABLE users
+    ADD UNIQUE KEY uniq_users_email (email),
+    ADD UNIQUE KEY uniq_users_phone_number (phone_number);
@@ -0,0 +1,14 @@
+-- Login sessions, one per issued first-party JWT, keyed by the token's jti.
+
+CREATE TABLE user_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    user_agent VARCHAR(512) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    KEY idx_user_sessions_user (user_id, revoked_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -0,0 +1,19 @@
+-- Product images. Files live in the configured storage backend under
+-- storage_prefix: "original.<original_ext>" plus one "<size>.<thumb_ext>"
+-- per configured thumbnail size.
+
+CREATE TABLE product_images (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    storage_prefix VARCHAR(255) NOT NULL,
+    original_ext VARCHAR(10) NOT NULL,
+    thumb_ext VARCHAR(10) NOT NULL,
+    thumb_sizes VARCHAR(255) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at DATETIME NOT NULL,
+    KEY idx_product_images_product (product_id),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
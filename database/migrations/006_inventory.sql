@@ -0,0 +1,20 @@
+-- Inventory: current stock and low-stock threshold per product, plus an
+-- append-only log of every stock movement.
+
+ALTER TABLE products
+    ADD COLUMN stock INT NOT NULL DEFAULT 0,
+    ADD COLUMN low_stock_threshold INT NOT NULL DEFAULT 0;
+
+CREATE TABLE stock_movements (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    type ENUM('restock', 'sale', 'adjustment') NOT NULL,
+    quantity INT NOT NULL,
+    stock_after INT NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    KEY idx_stock_movements_product (product_id, created_at),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
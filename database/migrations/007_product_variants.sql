@@ -0,0 +1,41 @@
+-- Product options (e.g. Size, Color), their values (S, M, L / Red, Blue)
+-- and sellable variants, each a combination of one value per option with
+-- its own SKU, optional price override and stock.
+
+CREATE TABLE product_options (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE KEY uniq_product_options_name (product_id, name),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE product_option_values (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    option_id INT NOT NULL,
+    value VARCHAR(100) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE KEY uniq_product_option_values_value (option_id, value),
+    FOREIGN KEY (option_id) REFERENCES product_options(id) ON DELETE CASCADE
+);
+
+CREATE TABLE product_variants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    price INT NULL,
+    stock INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_product_variants_sku (sku),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE product_variant_values (
+    variant_id INT NOT NULL,
+    option_value_id INT NOT NULL,
+    PRIMARY KEY (variant_id, option_value_id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_value_id) REFERENCES product_option_values(id)
+);
@@ -0,0 +1,6 @@
+-- Product prices become money: the existing integer price is the amount in
+-- the currency's minor unit, and each product now records its currency.
+-- Existing prices are in rupiah.
+
+ALTER TABLE products
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR' AFTER price;
@@ -0,0 +1,5 @@
+-- FULLTEXT index backing the "mysql" search driver. InnoDB skips words
+-- shorter than innodb_ft_min_token_size (3 by default) and its stopwords.
+
+ALTER TABLE products
+    ADD FULLTEXT INDEX ft_products_name (name);
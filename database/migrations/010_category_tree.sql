@@ -0,0 +1,24 @@
+-- Categories become a tree: each has an optional parent, a position among
+-- its siblings and a unique URL slug. Existing categories stay at the root;
+-- their slugs are derived from their names (MySQL 8 REGEXP_REPLACE), with
+-- the ID appended where two names give the same slug.
+
+ALTER TABLE categories
+    ADD COLUMN parent_id INT NULL AFTER id,
+    ADD COLUMN slug VARCHAR(191) NULL AFTER name,
+    ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER slug,
+    ADD CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories(id),
+    ADD INDEX idx_categories_parent (parent_id, position);
+
+UPDATE categories
+    SET slug = TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(name, '[^A-Za-z0-9]+', '-')));
+
+UPDATE categories SET slug = CONCAT('category-', id) WHERE slug = '';
+
+UPDATE categories c
+    JOIN (SELECT slug FROM categories GROUP BY slug HAVING COUNT(*) > 1) dup ON dup.slug = c.slug
+    SET c.slug = CONCAT(c.slug, '-', c.id);
+
+ALTER TABLE categories
+    MODIFY slug VARCHAR(191) NOT NULL,
+    ADD UNIQUE KEY uniq_categories_slug (slug);
@@ -0,0 +1,7 @@
+-- Products now reference their category through a foreign key, so a
+-- category cannot disappear from under its products. Adding the key fails
+-- if orphaned products exist; find them first with
+--   SELECT p.id FROM products p LEFT JOIN categories c ON c.id = p.category_id WHERE c.id IS NULL;
+
+ALTER TABLE products
+    ADD CONSTRAINT fk_products_category FOREIGN KEY (category_id) REFERENCES categories(id);
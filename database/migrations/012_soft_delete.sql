@@ -0,0 +1,18 @@
+-- Soft deletion: deleted rows keep their data with deleted_at set until the
+-- purge job removes them after the configured retention. Administrators
+-- (users.is_admin) can list deleted rows and manage contact messages.
+
+ALTER TABLE products
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD INDEX idx_products_deleted_at (deleted_at);
+
+ALTER TABLE categories
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD INDEX idx_categories_deleted_at (deleted_at);
+
+ALTER TABLE messages
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD INDEX idx_messages_deleted_at (deleted_at);
+
+ALTER TABLE users
+    ADD COLUMN is_admin TINYINT(1) NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+-- Free-form product tags. Tags are identified by their slug, so "Sale" and
+-- "sale" are the same tag; name keeps the spelling it was first created with.
+
+CREATE TABLE tags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    slug VARCHAR(60) NOT NULL,
+    created_at DATETIME NOT NULL,
+    UNIQUE KEY uniq_tags_slug (slug)
+);
+
+CREATE TABLE product_tags (
+    product_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (product_id, tag_id),
+    KEY idx_product_tags_tag (tag_id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
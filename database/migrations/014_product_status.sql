@@ -0,0 +1,12 @@
+-- Publishing workflow. Products are draft, published or archived; only
+-- published ones appear in public listings and search. A draft with
+-- publish_at set is published by the scheduler once that time passes.
+-- Existing products were all public, so they start out published.
+
+ALTER TABLE products
+    ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'published' AFTER low_stock_threshold,
+    ADD COLUMN publish_at DATETIME NULL AFTER status,
+    ADD INDEX idx_products_status_publish_at (status, publish_at);
+
+ALTER TABLE products
+    ALTER COLUMN status SET DEFAULT 'draft';
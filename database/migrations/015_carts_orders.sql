@@ -0,0 +1,57 @@
+-- Shopping carts and orders. A cart belongs either to a user or, before
+-- login, to whoever holds its signed cart token (token_nonce is the random
+-- part of that token). Order items copy the product name and price at the
+-- time of purchase so later product edits do not rewrite history.
+
+CREATE TABLE carts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,
+    token_nonce VARCHAR(64) NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    UNIQUE KEY uniq_carts_user (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE cart_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    cart_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT NULL,
+    quantity INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    KEY idx_cart_items_cart (cart_id),
+    FOREIGN KEY (cart_id) REFERENCES carts(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE
+);
+
+CREATE TABLE orders (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    subtotal BIGINT NOT NULL,
+    total BIGINT NOT NULL,
+    item_count INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    KEY idx_orders_user (user_id, id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE order_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT NULL,
+    product_name VARCHAR(255) NOT NULL,
+    sku VARCHAR(64) NULL,
+    unit_price BIGINT NOT NULL,
+    quantity INT NOT NULL,
+    line_total BIGINT NOT NULL,
+    KEY idx_order_items_order (order_id),
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
@@ -0,0 +1,47 @@
+-- Order lifecycle and payments. Every status change of an order is kept in
+-- order_events. Payments record what the provider authorized, captured and
+-- refunded; payment_webhook_events remembers which webhook deliveries were
+-- handled so a redelivered event is applied only once.
+
+CREATE TABLE order_events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    from_status VARCHAR(20) NULL,
+    to_status VARCHAR(20) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    user_id INT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    KEY idx_order_events_order (order_id, id),
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE payments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    provider_ref VARCHAR(128) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL,
+    captured_amount BIGINT NOT NULL DEFAULT 0,
+    refunded_amount BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_payments_ref (provider, provider_ref),
+    KEY idx_payments_order (order_id),
+    FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE payment_webhook_events (
+    event_id VARCHAR(128) NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    payment_ref VARCHAR(128) NOT NULL,
+    received_at DATETIME NOT NULL,
+    PRIMARY KEY (provider, event_id)
+);
+
+-- Orders placed before this migration get their creation as first event
+INSERT INTO order_events (order_id, from_status, to_status, source, user_id, reason, created_at)
+SELECT id, NULL, status, 'checkout', user_id, '', created_at FROM orders;
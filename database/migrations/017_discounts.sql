@@ -0,0 +1,61 @@
+-- Discounts. A discount with a code is a coupon the customer enters; one
+-- without is a promotion applied automatically at checkout. Scopes limit a
+-- discount to some products or categories (including subcategories).
+-- Redemptions record what each order saved and why; they count towards
+-- usage limits unless the order was cancelled.
+
+CREATE TABLE discounts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(64) NULL,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    currency CHAR(3) NULL,
+    min_subtotal BIGINT NOT NULL DEFAULT 0,
+    starts_at DATETIME NULL,
+    ends_at DATETIME NULL,
+    usage_limit INT NULL,
+    per_user_limit INT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_discounts_code (code)
+);
+
+CREATE TABLE discount_products (
+    discount_id INT NOT NULL,
+    product_id INT NOT NULL,
+    PRIMARY KEY (discount_id, product_id),
+    FOREIGN KEY (discount_id) REFERENCES discounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE TABLE discount_categories (
+    discount_id INT NOT NULL,
+    category_id INT NOT NULL,
+    PRIMARY KEY (discount_id, category_id),
+    FOREIGN KEY (discount_id) REFERENCES discounts(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE discount_redemptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    discount_id INT NOT NULL,
+    order_id INT NOT NULL,
+    user_id INT NOT NULL,
+    code VARCHAR(64) NULL,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL,
+    explanation VARCHAR(500) NOT NULL,
+    created_at DATETIME NOT NULL,
+    KEY idx_discount_redemptions_discount (discount_id, user_id),
+    KEY idx_discount_redemptions_order (order_id),
+    FOREIGN KEY (discount_id) REFERENCES discounts(id),
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+ALTER TABLE orders
+    ADD COLUMN discount_total BIGINT NOT NULL DEFAULT 0 AFTER subtotal,
+    ADD COLUMN shipping BIGINT NOT NULL DEFAULT 0 AFTER discount_total;
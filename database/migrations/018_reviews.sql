@@ -0,0 +1,28 @@
+-- Product reviews. Each user may review a product once. Reviews are shown
+-- as soon as they are written; administrators can hide them and approve
+-- them again. Only approved reviews count towards a product's rating, which
+-- is kept on the product so listings can be sorted by it.
+
+CREATE TABLE reviews (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'approved',
+    verified_purchase BOOLEAN NOT NULL DEFAULT FALSE,
+    moderated_by INT NULL,
+    moderated_at DATETIME NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_reviews_product_user (product_id, user_id),
+    KEY idx_reviews_product_status (product_id, status, created_at),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (moderated_by) REFERENCES users(id)
+);
+
+ALTER TABLE products
+    ADD COLUMN rating_avg DECIMAL(3,2) NOT NULL DEFAULT 0 AFTER publish_at,
+    ADD COLUMN rating_count INT NOT NULL DEFAULT 0 AFTER rating_avg,
+    ADD INDEX idx_products_rating (rating_avg, rating_count);
@@ -0,0 +1,25 @@
+-- Wishlists. Users keep any number of named lists of products. A list can
+-- be shared read-only through its share_token, which is random and only
+-- set while sharing is switched on.
+
+CREATE TABLE wishlists (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    share_token VARCHAR(64) NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_wishlists_user_name (user_id, name),
+    UNIQUE KEY uniq_wishlists_share_token (share_token),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE wishlist_items (
+    wishlist_id INT NOT NULL,
+    product_id INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (wishlist_id, product_id),
+    KEY idx_wishlist_items_product (product_id),
+    FOREIGN KEY (wishlist_id) REFERENCES wishlists(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
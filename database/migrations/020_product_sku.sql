@@ -0,0 +1,8 @@
+-- Seller-assigned stock keeping units on products, the key bulk imports
+-- match rows on. SKUs are optional and unique per seller; products in the
+-- trash keep theirs, so a trashed product must be restored rather than
+-- imported again.
+
+ALTER TABLE products
+    ADD COLUMN sku VARCHAR(64) NULL AFTER id,
+    ADD UNIQUE KEY uniq_products_user_sku (user_id, sku);
@@ -0,0 +1,9 @@
+-- Row versions for optimistic concurrency. Every change to a product or
+-- category row bumps its version; GETs put it in their ETag and updates
+-- and deletes check it against If-Match.
+
+ALTER TABLE products
+    ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER sku;
+
+ALTER TABLE categories
+    ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER id;
@@ -0,0 +1,55 @@
+-- Shops let sellers work in teams. A shop has members with a role (owner,
+-- manager or editor) and can own products; products without a shop stay
+-- owned by their user_id alone. Invitations are addressed to an email
+-- address and accepted by the user signed in with it; only a hash of the
+-- token is kept.
+
+CREATE TABLE shops (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(120) NOT NULL,
+    created_by INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NULL,
+    UNIQUE KEY uniq_shops_slug (slug),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE shop_members (
+    shop_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role ENUM('owner', 'manager', 'editor') NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (shop_id, user_id),
+    KEY idx_shop_members_user (user_id),
+    FOREIGN KEY (shop_id) REFERENCES shops(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE shop_invitations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    shop_id INT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role ENUM('owner', 'manager', 'editor') NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    invited_by INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    accepted_at DATETIME NULL,
+    UNIQUE KEY uniq_shop_invitations_token (token_hash),
+    KEY idx_shop_invitations_email (email),
+    FOREIGN KEY (shop_id) REFERENCES shops(id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id)
+);
+
+-- A shop's products keep the user_id of whoever last owned them in person.
+-- SKUs become unique per owner: per shop for shop products, per user for
+-- the rest.
+ALTER TABLE products
+    ADD COLUMN shop_id INT NULL AFTER user_id,
+    ADD COLUMN owner_key VARCHAR(24) AS (IF(shop_id IS NULL, CONCAT('user:', user_id), CONCAT('shop:', shop_id))) STORED,
+    ADD KEY idx_products_user (user_id),
+    ADD KEY idx_products_shop (shop_id),
+    DROP INDEX uniq_products_user_sku,
+    ADD UNIQUE KEY uniq_products_owner_sku (owner_key, sku),
+    ADD FOREIGN KEY (shop_id) REFERENCES shops(id);
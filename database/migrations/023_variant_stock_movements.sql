@@ -0,0 +1,7 @@
+-- Variant stock changes go through the stock ledger too. Movements of a
+-- variant carry its id next to the product's; there is no foreign key so
+-- the history outlives variants that are deleted.
+
+ALTER TABLE stock_movements
+    ADD COLUMN variant_id INT NULL AFTER product_id,
+    ADD KEY idx_stock_movements_variant (variant_id, created_at);
@@ -0,0 +1,26 @@
+package helpers
+
+import "strings"
+
+// InPlaceholders returns "?, ?, ?" for use in an SQL IN clause together
+// with the matching query arguments.
+func InPlaceholders(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// InStringPlaceholders is InPlaceholders for string values.
+func InStringPlaceholders(values []string) (string, []interface{}) {
+	placeholders := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		placeholders[i] = "?"
+		args[i] = value
+	}
+	return strings.Join(placeholders, ", "), args
+}
@@ -39,3 +39,13 @@ func FormatNullableTime(nt sql.NullTime) string {
 	}
 	return ""
 }
+
+// ParseOptionalDatetime is ParseNullableDatetime for fields exposed as
+// *time.Time, which encode as null in JSON rather than as a struct.
+func ParseOptionalDatetime(datetime []byte) (*time.Time, error) {
+	nt, err := ParseNullableDatetime(datetime)
+	if err != nil || !nt.Valid {
+		return nil, err
+	}
+	return &nt.Time, nil
+}
@@ -0,0 +1,158 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// sameJSON reports whether two documents hold the same JSON value.
+func sameJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var a, b interface{}
+	if err := json.Unmarshal(got, &a); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &b); err != nil {
+		t.Fatalf("expected %s: %v", want, err)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// The examples of RFC 7396, Appendix A, and a few more.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// The example of RFC 7396, section 3
+		{
+			`{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`,
+			`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`,
+			`{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged","phoneNumber":"+01-123-456-7890"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			got, err := Apply(MergePatchType, []byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchKeepsLargeIntegers(t *testing.T) {
+	got, err := MergePatch([]byte(`{"id":9007199254740993}`), []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"id":9007199254740993}` {
+		t.Fatalf("got %s", got)
+	}
+}
+
+// The examples of RFC 6902, Appendix A, and the edge cases around them.
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{"A.1 adding an object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"A.2 adding an array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"A.3 removing an object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"A.4 removing an array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"A.5 replacing a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{
+			"A.6 moving a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil,
+		},
+		{"A.7 moving an array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"A.8 testing a value: success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"A.9 testing a value: error", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrFailed},
+		{"A.10 adding a nested member object", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"A.11 ignoring unrecognized elements", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`, nil},
+		{"A.12 adding to a nonexistent target", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrFailed},
+		{"A.14 ~ escape ordering", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`, nil},
+		{"A.15 comparing strings and numbers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, "", ErrFailed},
+		{"A.16 adding an array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, nil},
+
+		{"empty patch", `{"a":1}`, `[]`, `{"a":1}`, nil},
+		{"add replaces a member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`, nil},
+		{"add null", `{"a":1}`, `[{"op":"add","path":"/b","value":null}]`, `{"a":1,"b":null}`, nil},
+		{"add at the end of an array", `[1,2]`, `[{"op":"add","path":"/2","value":3}]`, `[1,2,3]`, nil},
+		{"add past the end of an array", `[1,2]`, `[{"op":"add","path":"/3","value":3}]`, "", ErrFailed},
+		{"add with a leading zero index", `[1,2]`, `[{"op":"add","path":"/01","value":3}]`, "", ErrFailed},
+		{"add without a value", `{}`, `[{"op":"add","path":"/a"}]`, "", ErrInvalid},
+		{"replace the whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"replace a missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", ErrFailed},
+		{"replace an array element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":3}]`, `{"a":[3,2]}`, nil},
+		{"remove a missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, "", ErrFailed},
+		{"remove the whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, "", ErrInvalid},
+		{"copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"copy without from", `{"a":1}`, `[{"op":"copy","path":"/b"}]`, "", ErrInvalid},
+		{"move onto itself", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`, nil},
+		{"move into a child of itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, "", ErrInvalid},
+		{"test numbers by value", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`, nil},
+		{"test objects regardless of order", `{"a":{"x":1,"y":2}}`, `[{"op":"test","path":"/a","value":{"y":2,"x":1}}]`, `{"a":{"x":1,"y":2}}`, nil},
+		{"test a missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`, "", ErrFailed},
+		{"a failed test fails the whole patch", `{"a":1}`, `[{"op":"replace","path":"/a","value":2},{"op":"test","path":"/a","value":1}]`, "", ErrFailed},
+		{"pointer without a slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`, "", ErrInvalid},
+		{"missing path", `{"a":1}`, `[{"op":"remove"}]`, "", ErrInvalid},
+		{"unknown op", `{"a":1}`, `[{"op":"increment","path":"/a"}]`, "", ErrInvalid},
+		{"not an array", `{"a":1}`, `{"op":"remove","path":"/a"}`, "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(JSONPatchType, []byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(t, got, tt.want) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	if _, err := Apply("application/json", []byte(`{}`), []byte(`{}`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unsupported media type: %v", err)
+	}
+	if _, err := Apply(MergePatchType, []byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("malformed merge patch: %v", err)
+	}
+	if _, err := Apply(MergePatchType, []byte(`{}`), []byte(`{} {}`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("trailing data in merge patch: %v", err)
+	}
+	// A broken document is the caller's problem, not the patch's
+	if _, err := Apply(JSONPatchType, []byte(`{`), []byte(`[]`)); err == nil || errors.Is(err, ErrInvalid) || errors.Is(err, ErrFailed) {
+		t.Errorf("malformed document: %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies an RFC 6902 patch, a list of add, remove, replace,
+// move, copy and test operations run in order. If any operation fails the
+// whole patch fails.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: a JSON Patch must be an array of operations", ErrInvalid)
+	}
+
+	for i, op := range operations {
+		root, err = applyOperation(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyOperation(root interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: %q needs a path", ErrInvalid, op.Op)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		// A null value arrives as "null"; only a missing one is empty
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: %q needs a value", ErrInvalid, op.Op)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		}
+		current, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, fmt.Errorf("%w: test failed at %q", ErrFailed, *op.Path)
+		}
+		return root, nil
+
+	case "remove":
+		root, _, err := remove(root, path)
+		return root, err
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: %q needs from", ErrInvalid, op.Op)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			value, err := get(root, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(root, path, deepCopy(value))
+		}
+
+		if *op.From == *op.Path {
+			_, err := get(root, from)
+			return root, err
+		}
+		if strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move %q into itself", ErrInvalid, *op.From)
+		}
+		root, value, err := remove(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalid, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token, which must lie within [0, max].
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrFailed, token)
+	}
+	if index > max {
+		return 0, fmt.Errorf("%w: index %d is out of range", ErrFailed, index)
+	}
+	return index, nil
+}
+
+func missing(token string) error {
+	return fmt.Errorf("%w: %q not found", ErrFailed, token)
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, missing(token)
+			}
+			node = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[index]
+		default:
+			return nil, missing(token)
+		}
+	}
+	return node, nil
+}
+
+// add sets the member or inserts the array element path names, returning
+// the new node.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, missing(token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+
+	case []interface{}:
+		if len(path) == 1 {
+			if token == "-" {
+				return append(n, value), nil
+			}
+			index, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+		index, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(n[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = child
+		return n, nil
+	}
+	return nil, missing(token)
+}
+
+// remove deletes what path names, returning the new node and the removed
+// value.
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalid)
+	}
+	token := path[0]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, missing(token)
+		}
+		if len(path) == 1 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := n[index]
+			return append(n[:index], n[index+1:]...), removed, nil
+		}
+		child, removed, err := remove(n[index], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[index] = child
+		return n, removed, nil
+	}
+	return nil, nil, missing(token)
+}
+
+// replace swaps the value path names, which must exist.
+func replace(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if _, err := get(node, path); err != nil {
+		return nil, err
+	}
+
+	parent, err := get(node, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[token] = value
+	case []interface{}:
+		index, _ := strconv.Atoi(token)
+		p[index] = value
+	}
+	return node, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for name, member := range v {
+			object[name] = deepCopy(member)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, element := range v {
+			array[i] = deepCopy(element)
+		}
+		return array
+	}
+	return value
+}
+
+// equal compares JSON values as test requires: numbers by value, objects
+// regardless of member order.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for name, member := range x {
+			other, ok := y[name]
+			if !ok || !equal(member, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -1,13 +1,29 @@
 package main
 
 import (
+	"loginApi/config"
 	"loginApi/database"
+	"loginApi/money"
+	"loginApi/payments"
+	"loginApi/publishing"
 	"loginApi/routes"
+	"loginApi/search"
+	"loginApi/sessions"
+	"loginApi/storage"
+	"loginApi/trash"
 	"net/http"
 )
 
 func main() {
+	config.Load()
+	storage.Init()
+	money.Init()
+	payments.Init()
 	database.Connect()
+	search.Init()
+	sessions.StartCacheJanitor()
+	trash.StartPurgeJob()
+	publishing.StartScheduler()
 	routes.RegisterRoutes()
 	http.ListenAndServe(":8080", nil)
 }
@@ -7,40 +7,184 @@ import (
 	"strconv"
 	"strings"
 
+	"loginApi/sessions"
 	"loginApi/utils" // Adjust the import path as necessary
 )
 
+// JWTAuth requires a bearer token issued for a user. OAuth2 access tokens
+// only reach next when it is wrapped in RequireScope: a route that does not
+// say which scope it needs is for first-party logins alone, so a new route
+// cannot be opened to third-party clients by forgetting its scope.
 func JWTAuth(next http.Handler) http.Handler {
+	_, scoped := next.(scopedHandler)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the token from the Authorization header
-		tokenString := extractToken(r)
-		if tokenString == "" {
-			http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+		ctx, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		// Client-credentials tokens act for an application, not a user
+		if _, ok := ctx.Value("userID").(int); !ok {
+			http.Error(w, "This endpoint needs a token issued for a user", http.StatusForbidden)
 			return
 		}
 
-		// Parse and validate the token
-		token, claims, err := utils.ParseJWT(tokenString)
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if _, delegated := ctx.Value("clientID").(string); delegated && !scoped {
+			http.Error(w, "This endpoint does not accept OAuth2 access tokens", http.StatusForbidden)
 			return
 		}
 
-		// Convert the Subject claim (userID) to an integer
-		userIDStr := claims.Subject
-		userID, err := strconv.Atoi(userIDStr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate validates the bearer token and returns the request context
+// carrying its claims. Tokens issued to a client without a user carry a
+// clientID and scopes but no userID. On failure it writes the response.
+func authenticate(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	// Extract the token from the Authorization header
+	tokenString := extractToken(r)
+	if tokenString == "" {
+		http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Parse and validate the token
+	token, claims, err := utils.ParseJWT(tokenString)
+	if err != nil || !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// OAuth2 access tokens can be revoked before they expire
+	if claims.ClientID != "" {
+		revoked, err := utils.IsTokenRevoked(claims.Id)
+		if err != nil {
+			fmt.Printf("Error checking token revocation: %v\n", err)
+			http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+			return nil, false
+		}
+		if revoked {
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return nil, false
+		}
+	}
+
+	ctx := r.Context()
+
+	// Delegated tokens are limited to the scopes the user consented to
+	if claims.ClientID != "" {
+		ctx = context.WithValue(ctx, "clientID", claims.ClientID)
+		ctx = context.WithValue(ctx, "scopes", utils.ParseScope(claims.Scope))
+		if claims.Subject == "" {
+			return ctx, true
+		}
+	}
+
+	// Convert the Subject claim (userID) to an integer
+	userIDStr := claims.Subject
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		fmt.Printf("Error converting subject to integer: %v\n", err)
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// First-party tokens must belong to a session that is still active
+	if claims.ClientID == "" {
+		active, err := sessions.IsActive(claims.Id, userID)
 		if err != nil {
-			fmt.Printf("Error converting subject to integer: %v\n", err)
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			fmt.Printf("Error checking session: %v\n", err)
+			http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+			return nil, false
+		}
+		if !active {
+			http.Error(w, "Session has ended, please log in again", http.StatusUnauthorized)
+			return nil, false
+		}
+		ctx = context.WithValue(ctx, "sessionID", claims.Id)
+	}
+
+	// Add the userID to the request context
+	return context.WithValue(ctx, "userID", userID), true
+}
+
+// scopedHandler marks a handler wrapped in RequireScope.
+type scopedHandler struct {
+	http.Handler
+}
+
+// RequireScope must run after JWTAuth. First-party login tokens carry no
+// scopes and are let through; OAuth2 access tokens need the given scope.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return scopedHandler{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, ok := r.Context().Value("scopes").([]string)
+		if ok && !utils.ScopeSubset([]string{scope}, scopes) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			http.Error(w, "Insufficient scope", http.StatusForbidden)
 			return
 		}
+		next.ServeHTTP(w, r)
+	})}
+}
 
-		// Add the userID to the request context
-		ctx := context.WithValue(r.Context(), "userID", userID)
+// OptionalAuth authenticates requests that carry a bearer token and lets
+// anonymous ones through unchanged, for public endpoints that show more to
+// signed-in users. Client-credentials tokens are accepted and reach the
+// handler without a userID.
+func OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if extractToken(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// RequireAdmin rejects users without the administrator flag, and OAuth2
+// access tokens whatever their scope: no client acts as an administrator.
+// It must run after JWTAuth.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, delegated := r.Context().Value("clientID").(string); delegated {
+			http.Error(w, "Administrator access requires a first-party login", http.StatusForbidden)
+			return
+		}
+
+		userID := r.Context().Value("userID").(int)
+		admin, err := utils.IsAdmin(userID)
+		if err != nil {
+			http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+			fmt.Printf("Error checking admin flag: %v\n", err)
+			return
+		}
+		if !admin {
+			http.Error(w, "Administrator access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProtectWrites sends GET and HEAD requests to public and everything else
+// to protected, for paths that are readable by anyone but writable only
+// when authenticated.
+func ProtectWrites(public, protected http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			public.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
 // Helper function to extract the token from the Authorization header
 func extractToken(r *http.Request) string {
 	bearerToken := r.Header.Get("Authorization")
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"database/sql/driver"
+	"loginApi/database/dbtest"
+	"loginApi/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCredentialsToken(t *testing.T) {
+	stub := dbtest.Use(t)
+	revoked := map[string]bool{}
+	stub.On(`FROM oauth_revoked_tokens WHERE jti = \?`, func(args []driver.Value) (dbtest.Result, error) {
+		return dbtest.Rows([]string{"revoked"}, []driver.Value{revoked[args[0].(string)]}), nil
+	})
+
+	token, claims, err := utils.GenerateAccessToken(0, "service", "orders", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser, gotClient, gotScopes interface{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = r.Context().Value("userID")
+		gotClient = r.Context().Value("clientID")
+		gotScopes = r.Context().Value("scopes")
+	})
+
+	serve := func(h http.Handler) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve(JWTAuth(handler)); code != http.StatusForbidden {
+		t.Fatalf("JWTAuth: status %d, want 403", code)
+	}
+
+	if code := serve(OptionalAuth(RequireScope("orders", handler))); code != http.StatusOK {
+		t.Fatalf("OptionalAuth: status %d, want 200", code)
+	}
+	if gotUser != nil || gotClient != "service" {
+		t.Fatalf("OptionalAuth: userID %v, clientID %v", gotUser, gotClient)
+	}
+	if scopes, _ := gotScopes.([]string); len(scopes) != 1 || scopes[0] != "orders" {
+		t.Fatalf("OptionalAuth: scopes %v", gotScopes)
+	}
+
+	if code := serve(OptionalAuth(RequireScope("profile", handler))); code != http.StatusForbidden {
+		t.Fatalf("RequireScope: status %d, want 403", code)
+	}
+
+	revoked[claims.Id] = true
+	if code := serve(OptionalAuth(handler)); code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: status %d, want 401", code)
+	}
+}
+
+func TestDelegatedToken(t *testing.T) {
+	stub := dbtest.Use(t)
+	stub.On(`FROM oauth_revoked_tokens`, func([]driver.Value) (dbtest.Result, error) {
+		return dbtest.Rows([]string{"revoked"}, []driver.Value{false}), nil
+	})
+
+	token, _, err := utils.GenerateAccessToken(42, "spa", "profile", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotUser, gotSession interface{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = r.Context().Value("userID")
+		gotSession = r.Context().Value("sessionID")
+	})
+
+	serve := func(h http.Handler) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve(JWTAuth(RequireScope("profile", handler))); code != http.StatusOK || gotUser != 42 || gotSession != nil {
+		t.Fatalf("status %d, userID %v, sessionID %v", code, gotUser, gotSession)
+	}
+	if code := serve(JWTAuth(RequireScope("orders", handler))); code != http.StatusForbidden {
+		t.Fatalf("scope not granted: status %d, want 403", code)
+	}
+
+	// Routes that do not name a scope are for first-party logins
+	gotUser = nil
+	for name, h := range map[string]http.Handler{
+		"no scope":       JWTAuth(handler),
+		"admin":          JWTAuth(RequireAdmin(handler)),
+		"scope in admin": JWTAuth(RequireScope("profile", RequireAdmin(handler))),
+		"scope hidden":   JWTAuth(ProtectWrites(RequireScope("profile", handler), handler)),
+	} {
+		if code := serve(h); code != http.StatusForbidden || gotUser != nil {
+			t.Errorf("%s: status %d, handler reached with userID %v", name, code, gotUser)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Cart is a shopping cart with its items priced at the current product
+// prices, and the discounts checkout would apply. Token is only set for
+// anonymous carts, when it is first issued.
+type Cart struct {
+	ID             int               `json:"id"`
+	Items          []CartItem        `json:"items"`
+	Currency       string            `json:"currency"`
+	Subtotal       int64             `json:"subtotal"`
+	Discount_total int64             `json:"discount_total"`
+	Shipping       int64             `json:"shipping"`
+	Total          int64             `json:"total"`
+	Item_count     int               `json:"item_count"`
+	Discounts      []AppliedDiscount `json:"discounts"`
+	Coupon         *RejectedDiscount `json:"coupon_error,omitempty"`
+	Token          string            `json:"cart_token,omitempty"`
+	Updated_at     time.Time         `json:"updated_at"`
+}
+
+// CartItem is one line of a cart. Available is false when the product can
+// no longer be bought or not in the requested quantity.
+type CartItem struct {
+	ID          int    `json:"id"`
+	Product_id  int    `json:"product_id"`
+	Category_id int    `json:"category_id"`
+	Variant_id  *int   `json:"variant_id"`
+	Name        string `json:"name"`
+	SKU         string `json:"sku,omitempty"`
+	Currency    string `json:"currency"`
+	Unit_price  int64  `json:"unit_price"`
+	Quantity    int    `json:"quantity"`
+	Line_total  int64  `json:"line_total"`
+	Available   bool   `json:"available"`
+}
@@ -7,7 +7,33 @@ import (
 
 type Category struct {
 	ID         int          `json:"id"`
+	Version    int          `json:"version"`
+	Parent_id  *int         `json:"parent_id"`
 	Name       string       `json:"name"`
+	Slug       string       `json:"slug"`
+	Position   int          `json:"position"`
 	Created_at time.Time    `json:"created_at"`
 	Updated_at sql.NullTime `json:"updated_at"`
+	Deleted_at sql.NullTime `json:"deleted_at"`
+}
+
+// CategoryNode is a category with its subcategories, as returned by
+// /categories/tree.
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// CategoryDetail is a single category with the path from the root to it
+// and its direct subcategories.
+type CategoryDetail struct {
+	Category
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+	Children    []Category   `json:"children"`
+}
+
+type Breadcrumb struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
 }
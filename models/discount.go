@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Discount is a coupon when Code is set and an automatic promotion when it
+// is not. Value is a whole percentage for "percentage" discounts and an
+// amount in Currency's minor unit for "fixed_amount" ones.
+type Discount struct {
+	ID             int          `json:"id"`
+	Code           *string      `json:"code"`
+	Name           string       `json:"name"`
+	Kind           string       `json:"kind"`
+	Value          int64        `json:"value"`
+	Currency       *string      `json:"currency"`
+	Min_subtotal   int64        `json:"min_subtotal"`
+	Product_ids    []int        `json:"product_ids"`
+	Category_ids   []int        `json:"category_ids"`
+	Starts_at      *time.Time   `json:"starts_at"`
+	Ends_at        *time.Time   `json:"ends_at"`
+	Usage_limit    *int         `json:"usage_limit"`
+	Per_user_limit *int         `json:"per_user_limit"`
+	Active         bool         `json:"active"`
+	Times_used     int          `json:"times_used"`
+	Created_at     time.Time    `json:"created_at"`
+	Updated_at     sql.NullTime `json:"updated_at"`
+}
+
+// AppliedDiscount is a discount that took Amount off a cart or order, with
+// a sentence explaining it.
+type AppliedDiscount struct {
+	Discount_id int     `json:"discount_id"`
+	Code        *string `json:"code"`
+	Name        string  `json:"name"`
+	Kind        string  `json:"kind"`
+	Amount      int64   `json:"amount"`
+	Explanation string  `json:"explanation"`
+}
+
+// RejectedDiscount explains why a coupon could not be used.
+type RejectedDiscount struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type UserIdentity struct {
+	ID         int       `json:"id"`
+	User_id    int       `json:"user_id"`
+	Provider   string    `json:"provider"`
+	Subject    string    `json:"subject"`
+	Email      string    `json:"email"`
+	Created_at time.Time `json:"created_at"`
+}
@@ -1,14 +1,18 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type Message struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Email       string    `json:"email"`
-	PhoneNumber string    `json:"phone_number"`
-	Subject     string    `json:"subject"`
-	Message     string    `json:"message"`
-	Created_at  time.Time `json:"created_at"`
-	Updated_at  time.Time `json:"updated_at"`
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Email       string       `json:"email"`
+	PhoneNumber string       `json:"phone_number"`
+	Subject     string       `json:"subject"`
+	Message     string       `json:"message"`
+	Created_at  time.Time    `json:"created_at"`
+	Updated_at  time.Time    `json:"updated_at"`
+	Deleted_at  sql.NullTime `json:"deleted_at"`
 }
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Order statuses. An order starts pending and moves along the transitions
+// allowed by the order controller; cancelled and refunded are final.
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderShipped   = "shipped"
+	OrderDelivered = "delivered"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+type Order struct {
+	ID             int               `json:"id"`
+	User_id        int               `json:"user_id"`
+	Status         string            `json:"status"`
+	Currency       string            `json:"currency"`
+	Subtotal       int64             `json:"subtotal"`
+	Discount_total int64             `json:"discount_total"`
+	Shipping       int64             `json:"shipping"`
+	Total          int64             `json:"total"`
+	Item_count     int               `json:"item_count"`
+	Items          []OrderItem       `json:"items,omitempty"`
+	Discounts      []AppliedDiscount `json:"discounts,omitempty"`
+	Payments       []Payment         `json:"payments,omitempty"`
+	History        []OrderEvent      `json:"history,omitempty"`
+	Created_at     time.Time         `json:"created_at"`
+	Updated_at     sql.NullTime      `json:"updated_at"`
+}
+
+// OrderItem records what was bought, with the name and price as they were
+// when the order was placed.
+type OrderItem struct {
+	ID           int    `json:"id"`
+	Order_id     int    `json:"order_id"`
+	Product_id   int    `json:"product_id"`
+	Variant_id   *int   `json:"variant_id"`
+	Product_name string `json:"product_name"`
+	SKU          string `json:"sku,omitempty"`
+	Unit_price   int64  `json:"unit_price"`
+	Quantity     int    `json:"quantity"`
+	Line_total   int64  `json:"line_total"`
+}
+
+// OrderEvent records one status change. Source says what caused it:
+// "checkout", "user", "admin", "payment" or "webhook".
+type OrderEvent struct {
+	ID          int       `json:"id"`
+	Order_id    int       `json:"order_id"`
+	From_status *string   `json:"from_status"`
+	To_status   string    `json:"to_status"`
+	Source      string    `json:"source"`
+	User_id     *int      `json:"user_id"`
+	Reason      string    `json:"reason"`
+	Created_at  time.Time `json:"created_at"`
+}
+
+// Payment statuses.
+const (
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentRefunded   = "refunded"
+	PaymentFailed     = "failed"
+)
+
+type Payment struct {
+	ID              int          `json:"id"`
+	Order_id        int          `json:"order_id"`
+	Provider        string       `json:"provider"`
+	Provider_ref    string       `json:"provider_ref"`
+	Status          string       `json:"status"`
+	Amount          int64        `json:"amount"`
+	Captured_amount int64        `json:"captured_amount"`
+	Refunded_amount int64        `json:"refunded_amount"`
+	Created_at      time.Time    `json:"created_at"`
+	Updated_at      sql.NullTime `json:"updated_at"`
+}
@@ -5,12 +5,42 @@ import (
 	"time"
 )
 
+// Product statuses. Only published products are visible to everyone.
+const (
+	ProductDraft     = "draft"
+	ProductPublished = "published"
+	ProductArchived  = "archived"
+)
+
 type Product struct {
-	ID          int          `json:"id"`
-	Name        string       `json:"name"`
-	Price       int          `json:"price"`
-	User_id     int          `json:"user_id"`
-	Category_id int          `json:"category_id"`
-	Created_at  time.Time    `json:"created_at"`
-	Updated_at  sql.NullTime `json:"updated_at"`
+	ID                  int            `json:"id"`
+	SKU                 *string        `json:"sku"`
+	Version             int            `json:"version"`
+	Name                string         `json:"name"`
+	Price               int            `json:"price"`
+	Currency            string         `json:"currency"`
+	User_id             int            `json:"user_id"`
+	Shop_id             *int           `json:"shop_id"`
+	Category_id         int            `json:"category_id"`
+	Stock               int            `json:"stock"`
+	Low_stock_threshold *int           `json:"low_stock_threshold"`
+	Status              string         `json:"status"`
+	Publish_at          *time.Time     `json:"publish_at"`
+	Rating_avg          float64        `json:"rating_avg"`
+	Rating_count        int            `json:"rating_count"`
+	Created_at          time.Time      `json:"created_at"`
+	Updated_at          sql.NullTime   `json:"updated_at"`
+	Deleted_at          sql.NullTime   `json:"deleted_at"`
+	Images              []ProductImage `json:"images"`
+	Tags                []Tag          `json:"tags"`
+	Converted_price     *PriceView     `json:"converted_price,omitempty"`
+	Favorited           *bool          `json:"favorited,omitempty"`
+}
+
+// PriceView is a price converted for display in the currency and locale
+// the client asked for.
+type PriceView struct {
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Formatted string `json:"formatted"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type ProductImage struct {
+	ID          int               `json:"id"`
+	Product_id  int               `json:"product_id"`
+	URL         string            `json:"url"`
+	Thumbnails  map[string]string `json:"thumbnails"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	Created_at  time.Time         `json:"created_at"`
+}
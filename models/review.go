@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Review statuses. Only approved reviews are shown publicly and count
+// towards a product's rating.
+const (
+	ReviewApproved = "approved"
+	ReviewHidden   = "hidden"
+)
+
+type Review struct {
+	ID                int          `json:"id"`
+	Product_id        int          `json:"product_id"`
+	User_id           int          `json:"user_id"`
+	User_name         string       `json:"user_name"`
+	Rating            int          `json:"rating"`
+	Body              string       `json:"body"`
+	Status            string       `json:"status"`
+	Verified_purchase bool         `json:"verified_purchase"`
+	Created_at        time.Time    `json:"created_at"`
+	Updated_at        sql.NullTime `json:"updated_at"`
+}
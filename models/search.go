@@ -0,0 +1,13 @@
+package models
+
+type SearchResult struct {
+	Product Product `json:"product"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+type SearchFacet struct {
+	Category_id   int    `json:"category_id"`
+	Category_name string `json:"category_name"`
+	Count         int    `json:"count"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Session struct {
+	ID           string       `json:"id"`
+	User_id      int          `json:"user_id"`
+	UserAgent    string       `json:"user_agent"`
+	IPAddress    string       `json:"ip_address"`
+	Created_at   time.Time    `json:"created_at"`
+	Last_seen_at time.Time    `json:"last_seen_at"`
+	Expires_at   time.Time    `json:"expires_at"`
+	Revoked_at   sql.NullTime `json:"revoked_at"`
+	Current      bool         `json:"current"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Shop roles, from most to least powerful. Editors work on the shop's
+// products, managers also delete and transfer them and manage the team,
+// and owners also manage the shop itself and its other owners.
+const (
+	ShopOwner   = "owner"
+	ShopManager = "manager"
+	ShopEditor  = "editor"
+)
+
+// Shop is a team of sellers that owns products together. Role is the
+// caller's role in it; Members is only filled in when a single shop is
+// fetched.
+type Shop struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Slug       string       `json:"slug"`
+	Role       string       `json:"role,omitempty"`
+	Created_by int          `json:"created_by"`
+	Members    []ShopMember `json:"members,omitempty"`
+	Created_at time.Time    `json:"created_at"`
+	Updated_at sql.NullTime `json:"updated_at"`
+}
+
+type ShopMember struct {
+	User_id    int       `json:"user_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// ShopInvitation asks the user with Email to join a shop. Token is only
+// known when the invitation is created.
+type ShopInvitation struct {
+	ID         int       `json:"id"`
+	Shop_id    int       `json:"shop_id"`
+	Shop_name  string    `json:"shop_name,omitempty"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	Token      string    `json:"token,omitempty"`
+	Invited_by int       `json:"invited_by"`
+	Created_at time.Time `json:"created_at"`
+	Expires_at time.Time `json:"expires_at"`
+}
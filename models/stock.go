@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// StockMovement is one change to a product's stock. Quantity is signed:
+// positive for stock coming in, negative for stock going out.
+type StockMovement struct {
+	ID          int       `json:"id"`
+	Product_id  int       `json:"product_id"`
+	Variant_id  *int      `json:"variant_id"`
+	Type        string    `json:"type"`
+	Quantity    int       `json:"quantity"`
+	Stock_after int       `json:"stock_after"`
+	Reason      string    `json:"reason"`
+	User_id     int       `json:"user_id"`
+	Created_at  time.Time `json:"created_at"`
+}
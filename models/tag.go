@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// TagSuggestion is an autocomplete entry with the number of published
+// products carrying the tag.
+type TagSuggestion struct {
+	Name          string `json:"name"`
+	Slug          string `json:"slug"`
+	Product_count int    `json:"product_count"`
+}
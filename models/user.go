@@ -5,7 +5,7 @@ type User struct {
 	Name        string `json:"name"`
 	Email       string `json:"email"`
 	PhoneNumber string `json:"phone_number"`
-	Password    string `json:"password"`
+	Password    string `json:"password,omitempty"`
 }
 
 type LoginResponse struct {
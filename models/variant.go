@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ProductOption struct {
+	ID         int                  `json:"id"`
+	Product_id int                  `json:"product_id"`
+	Name       string               `json:"name"`
+	Position   int                  `json:"position"`
+	Values     []ProductOptionValue `json:"values"`
+}
+
+type ProductOptionValue struct {
+	ID        int    `json:"id"`
+	Option_id int    `json:"option_id"`
+	Value     string `json:"value"`
+	Position  int    `json:"position"`
+}
+
+// ProductVariant is one sellable combination of option values. Price is
+// nil when the variant sells at the product's price. Converted_price is the
+// effective price in the currency asked for with ?currency=.
+type ProductVariant struct {
+	ID               int                  `json:"id"`
+	Product_id       int                  `json:"product_id"`
+	SKU              string               `json:"sku"`
+	Price            *int                 `json:"price"`
+	Effective_price  int                  `json:"effective_price"`
+	Stock            int                  `json:"stock"`
+	Option_value_ids []int                `json:"option_value_ids,omitempty"`
+	Options          []VariantOptionValue `json:"options"`
+	Created_at       time.Time            `json:"created_at"`
+	Updated_at       sql.NullTime         `json:"updated_at"`
+	Converted_price  *PriceView           `json:"converted_price,omitempty"`
+}
+
+type VariantOptionValue struct {
+	Option_id int    `json:"option_id"`
+	Option    string `json:"option"`
+	Value_id  int    `json:"value_id"`
+	Value     string `json:"value"`
+}
+
+// ProductDetail is a product with everything needed to render its page.
+type ProductDetail struct {
+	Product
+	Options  []ProductOption  `json:"options"`
+	Variants []ProductVariant `json:"variants"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Wishlist is a named list of products a user saved for later. Share_token
+// is set while the list is shared; Products is only filled in when a
+// single list is fetched.
+type Wishlist struct {
+	ID          int          `json:"id"`
+	User_id     int          `json:"user_id,omitempty"`
+	Name        string       `json:"name"`
+	Share_token *string      `json:"share_token,omitempty"`
+	Item_count  int          `json:"item_count"`
+	Products    []Product    `json:"products,omitempty"`
+	Created_at  time.Time    `json:"created_at"`
+	Updated_at  sql.NullTime `json:"updated_at"`
+}
@@ -0,0 +1,129 @@
+package money
+
+import (
+	"strconv"
+	"strings"
+)
+
+type localeFormat struct {
+	group        string
+	decimal      string
+	symbolAfter  bool
+	spaceBetween bool
+}
+
+// locales covers the locales our storefronts use; anything else falls back
+// to en-US conventions.
+var locales = map[string]localeFormat{
+	"en-US": {group: ",", decimal: "."},
+	"en-GB": {group: ",", decimal: "."},
+	"id-ID": {group: ".", decimal: ","},
+	"ms-MY": {group: ",", decimal: "."},
+	"ja-JP": {group: ",", decimal: "."},
+	"de-DE": {group: ".", decimal: ",", symbolAfter: true, spaceBetween: true},
+	"es-ES": {group: ".", decimal: ",", symbolAfter: true, spaceBetween: true},
+	"fr-FR": {group: " ", decimal: ",", symbolAfter: true, spaceBetween: true},
+	"nl-NL": {group: ".", decimal: ",", spaceBetween: true},
+}
+
+// languageDefaults picks a locale for a bare or unsupported regional tag.
+var languageDefaults = map[string]string{
+	"de": "de-DE", "en": "en-US", "es": "es-ES", "fr": "fr-FR",
+	"id": "id-ID", "ja": "ja-JP", "ms": "ms-MY", "nl": "nl-NL",
+}
+
+var symbols = map[string]string{
+	"AUD": "A$", "BRL": "R$", "CAD": "CA$", "CNY": "CN¥", "EUR": "€",
+	"GBP": "£", "HKD": "HK$", "IDR": "Rp", "INR": "₹", "JPY": "¥",
+	"KRW": "₩", "MXN": "MX$", "MYR": "RM", "NZD": "NZ$", "PHP": "₱",
+	"SGD": "S$", "THB": "฿", "USD": "$", "VND": "₫",
+}
+
+// Format renders m for display in locale, e.g. "$1,234.50" for en-US or
+// "1.234,50 €" for de-DE.
+func Format(m Money, locale string) string {
+	format, ok := locales[locale]
+	if !ok {
+		format = locales["en-US"]
+	}
+
+	symbol, ok := symbols[m.Currency]
+	space := format.spaceBetween
+	if !ok {
+		symbol = m.Currency
+		space = true
+	}
+
+	amount := m.Amount
+	negative := amount < 0
+	if negative {
+		amount = -amount
+	}
+
+	digits := MinorUnits(m.Currency)
+	divisor := int64(1)
+	for i := 0; i < digits; i++ {
+		divisor *= 10
+	}
+
+	number := groupThousands(strconv.FormatInt(amount/divisor, 10), format.group)
+	if digits > 0 {
+		fraction := strconv.FormatInt(amount%divisor, 10)
+		number += format.decimal + strings.Repeat("0", digits-len(fraction)) + fraction
+	}
+
+	separator := ""
+	if space {
+		separator = " "
+	}
+
+	var result string
+	if format.symbolAfter {
+		result = number + separator + symbol
+	} else {
+		result = symbol + separator + number
+	}
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
+
+func groupThousands(digits, separator string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	lead := len(digits) % 3
+	if lead > 0 {
+		b.WriteString(digits[:lead])
+	}
+	for i := lead; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(separator)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// MatchLocale picks a supported locale from an Accept-Language style list,
+// falling back to def.
+func MatchLocale(acceptLanguage, def string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if tag == "" {
+			continue
+		}
+		for locale := range locales {
+			if strings.EqualFold(locale, tag) {
+				return locale
+			}
+		}
+		language := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if locale, ok := languageDefaults[language]; ok {
+			return locale
+		}
+	}
+	return def
+}
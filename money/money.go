@@ -0,0 +1,87 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"loginApi/config"
+	"math/big"
+	"strings"
+)
+
+var ErrUnknownCurrency = errors.New("unknown currency code")
+
+// Money is an amount in the currency's minor unit (cents for USD, yen for
+// JPY) together with its ISO 4217 code.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// currencies maps supported ISO 4217 codes to their number of minor-unit
+// digits. IDR is treated as having none: sen are not used in practice and
+// our existing prices are stored in whole rupiah.
+var currencies = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "DKK": 2,
+	"EUR": 2, "GBP": 2, "HKD": 2, "IDR": 0, "INR": 2, "JPY": 0, "KRW": 0,
+	"KWD": 3, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "PHP": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+// NormalizeCurrency upper-cases and validates a currency code.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencies[code]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return code, nil
+}
+
+// MinorUnits returns the number of decimal digits of the currency's minor
+// unit.
+func MinorUnits(code string) int {
+	return currencies[code]
+}
+
+// Convert converts m into currency using rates, rounding half away from
+// zero to the target's minor unit.
+func Convert(m Money, currency string, rates RateProvider) (Money, error) {
+	if m.Currency == currency {
+		return m, nil
+	}
+
+	rate, err := rates.Rate(m.Currency, currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	// amount * rate * 10^to / 10^from, kept exact until the final rounding
+	value := new(big.Rat).SetInt64(m.Amount)
+	value.Mul(value, rate)
+	value.Mul(value, new(big.Rat).SetInt(pow10(MinorUnits(currency))))
+	value.Quo(value, new(big.Rat).SetInt(pow10(MinorUnits(m.Currency))))
+
+	return Money{Amount: roundHalfAway(value), Currency: currency}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func roundHalfAway(r *big.Rat) int64 {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if remainder.Mul(remainder, big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
+
+// Init selects the rate provider from config.
+func Init() {
+	Rates = NewStaticFileProvider(config.App.Money.RatesFile)
+}
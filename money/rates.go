@@ -0,0 +1,132 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// RateProvider supplies exchange rates: one unit of from is worth Rate
+// units of to.
+type RateProvider interface {
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// Rates is the provider used by the API, set by Init.
+var Rates RateProvider = &StaticFileProvider{}
+
+// StaticFileProvider reads rates from a JSON file so prices can be
+// converted offline:
+//
+//	{"base": "USD", "updated_at": "2024-08-01T00:00:00Z", "rates": {"EUR": "0.92", "IDR": "16250"}}
+//
+// Rates are relative to base; cross rates are derived through it. The file
+// is reloaded when its modification time changes.
+type StaticFileProvider struct {
+	Path string
+
+	mu        sync.Mutex
+	modTime   time.Time
+	base      string
+	rates     map[string]*big.Rat
+	UpdatedAt time.Time
+}
+
+type rateFile struct {
+	Base      string                     `json:"base"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Rates     map[string]json.RawMessage `json:"rates"`
+}
+
+func NewStaticFileProvider(path string) *StaticFileProvider {
+	return &StaticFileProvider{Path: path}
+}
+
+func (p *StaticFileProvider) Rate(from, to string) (*big.Rat, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+
+	fromRate, ok := p.lookup(from)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRateUnavailable, from)
+	}
+	toRate, ok := p.lookup(to)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRateUnavailable, to)
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+func (p *StaticFileProvider) lookup(code string) (*big.Rat, bool) {
+	if code == p.base {
+		return big.NewRat(1, 1), true
+	}
+	rate, ok := p.rates[code]
+	return rate, ok
+}
+
+func (p *StaticFileProvider) reload() error {
+	if p.Path == "" {
+		return fmt.Errorf("%w: no rates file configured", ErrRateUnavailable)
+	}
+
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+	}
+	if p.rates != nil && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+	}
+
+	var file rateFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", p.Path, err)
+	}
+
+	base, err := NormalizeCurrency(file.Base)
+	if err != nil {
+		return fmt.Errorf("rates file base: %w", err)
+	}
+
+	rates := map[string]*big.Rat{}
+	for code, raw := range file.Rates {
+		code, err := NormalizeCurrency(code)
+		if err != nil {
+			continue
+		}
+
+		// Rates may be JSON numbers or strings; both parse exactly as decimals
+		var text string
+		if json.Unmarshal(raw, &text) != nil {
+			text = string(raw)
+		}
+		rate, ok := new(big.Rat).SetString(text)
+		if !ok || rate.Sign() <= 0 {
+			return fmt.Errorf("invalid rate for %s in %s", code, p.Path)
+		}
+		rates[code] = rate
+	}
+
+	p.base = base
+	p.rates = rates
+	p.UpdatedAt = file.UpdatedAt
+	p.modTime = info.ModTime()
+	return nil
+}
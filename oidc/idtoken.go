@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew is how far our clock may drift from the provider's.
+const clockSkew = time.Minute
+
+// keysRefreshInterval bounds how often an unknown kid triggers a JWKS fetch.
+const keysRefreshInterval = time.Minute
+
+type keySet map[string]*rsa.PublicKey
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// audience accepts both the single-string and array forms of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// flexBool accepts providers that send email_verified as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// IDTokenClaims are the ID token claims we rely on.
+type IDTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// Valid implements jwt.Claims; issuer, audience and nonce are checked by
+// VerifyIDToken, which knows what to expect.
+func (c *IDTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("id token is expired")
+	}
+	if c.IssuedAt != 0 && time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return errors.New("id token was issued in the future")
+	}
+	return nil
+}
+
+// VerifyIDToken checks the ID token signature against the provider's JWKS
+// and validates issuer, audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(raw string, nonce string) (*IDTokenClaims, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(d.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(p.Config.Issuer, "/") {
+		return nil, errors.New("id token issuer mismatch")
+	}
+
+	found := false
+	for _, aud := range claims.Audience {
+		if aud == p.Config.ClientID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("id token audience mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.Config.ClientID {
+		return nil, errors.New("id token authorized party mismatch")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id token nonce mismatch")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	return claims, nil
+}
+
+// signingKey returns the key for kid, refetching the JWKS when the provider
+// has rotated to a key we have not seen yet.
+func (p *Provider) signingKey(jwksURI, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.keys.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	}
+
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := p.getJSON(jwksURI, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := keySet{}
+	for _, jwk := range doc.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			fmt.Printf("Skipping JWKS key %s: %v\n", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = &keys
+	p.keysFetched = time.Now()
+
+	if key := p.keys.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no signing key with kid %q", kid)
+}
+
+// lookup finds the key for kid. Tokens without a kid are accepted only when
+// the set holds a single key.
+func (ks *keySet) lookup(kid string) *rsa.PublicKey {
+	if ks == nil {
+		return nil
+	}
+	if kid == "" && len(*ks) == 1 {
+		for _, key := range *ks {
+			return key
+		}
+	}
+	return (*ks)[kid]
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+		return nil, errors.New("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
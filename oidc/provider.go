@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"loginApi/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Discovery is the subset of the OpenID Provider Metadata we use.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Provider is a configured identity provider. Discovery and signing keys
+// are fetched lazily and cached.
+type Provider struct {
+	Name   string
+	Config config.OIDCProvider
+	Client *http.Client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	keys        *keySet
+	keysFetched time.Time
+}
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]*Provider{}
+)
+
+// GetProvider returns the provider registered under name in config.App.
+func GetProvider(name string) (*Provider, error) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if p, ok := providers[name]; ok {
+		return p, nil
+	}
+
+	cfg, ok := config.App.OIDCProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	p := &Provider{
+		Name:   name,
+		Config: cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	providers[name] = p
+	return p, nil
+}
+
+// Discover fetches and caches the issuer's discovery document.
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+	var d Discovery
+	err := p.getJSON(wellKnown, &d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+
+	// The discovery document must describe the issuer we were configured with
+	if strings.TrimSuffix(d.Issuer, "/") != strings.TrimSuffix(p.Config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", d.Issuer, p.Config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// AuthCodeURL builds the authorization request URL the user is sent to.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", p.Config.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	target, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := target.Query()
+	for key := range params {
+		q.Set(key, params.Get(key))
+	}
+	target.RawQuery = q.Encode()
+	return target.String(), nil
+}
+
+// Exchange redeems an authorization code at the token endpoint.
+func (p *Provider) Exchange(code, codeVerifier string) (*TokenResponse, error) {
+	d, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var token TokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return &token, nil
+}
+
+func (p *Provider) getJSON(target string, v interface{}) error {
+	resp, err := p.Client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", target, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,270 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"loginApi/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// fakeIssuer is an OpenID provider serving discovery, a JWKS and a token
+// endpoint that hands out ID tokens it signs with its current key.
+type fakeIssuer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PrivateKey
+	current   string
+	jwksHits  int
+	nextToken string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	f := &fakeIssuer{t: t, keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                f.URL,
+			AuthorizationEndpoint: f.URL + "/authorize",
+			TokenEndpoint:         f.URL + "/token",
+			JWKSURI:               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.jwksHits++
+		var keys []jsonWebKey
+		for kid, key := range f.keys {
+			keys = append(keys, jsonWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "app" || secret != "app-secret" || r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		token := f.nextToken
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "at", TokenType: "Bearer", IDToken: token, ExpiresIn: 3600})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	f.rotate("key-1")
+	return f
+}
+
+// rotate publishes a new signing key and signs with it from now on. Old
+// keys stay published, as providers keep them until their tokens expire.
+func (f *fakeIssuer) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.keys[kid] = key
+	f.current = kid
+	f.mu.Unlock()
+}
+
+func (f *fakeIssuer) provider() *Provider {
+	return &Provider{
+		Name: "fake",
+		Config: config.OIDCProvider{
+			Issuer:       f.URL,
+			ClientID:     "app",
+			ClientSecret: "app-secret",
+			RedirectURL:  "https://api.example/auth/oidc/fake/callback",
+		},
+		Client: f.Client(),
+	}
+}
+
+// sign issues an ID token with claims, after edit has adjusted them.
+func (f *fakeIssuer) sign(edit func(jwt.MapClaims)) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            "user-1",
+		"aud":            "app",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          "n-0S6_WzA2Mj",
+		"email":          "jane@example.com",
+		"email_verified": true,
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	f.mu.Lock()
+	kid, key := f.current, f.keys[f.current]
+	f.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": issuer.URL, "sub": "user-1", "aud": "app", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n-0S6_WzA2Mj"})
+	forged.Header["kid"] = "key-1"
+	forgedRaw, err := forged.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		nonce   string
+		wantErr string
+	}{
+		{"valid", issuer.sign(nil), "n-0S6_WzA2Mj", ""},
+		{"audience array with azp", issuer.sign(func(c jwt.MapClaims) { c["aud"] = []string{"app", "other"}; c["azp"] = "app" }), "n-0S6_WzA2Mj", ""},
+		{"expired within skew", issuer.sign(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }), "n-0S6_WzA2Mj", ""},
+		{"expired", issuer.sign(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), "n-0S6_WzA2Mj", "expired"},
+		{"no exp", issuer.sign(func(c jwt.MapClaims) { delete(c, "exp") }), "n-0S6_WzA2Mj", "expired"},
+		{"issued in the future", issuer.sign(func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }), "n-0S6_WzA2Mj", "future"},
+		{"wrong issuer", issuer.sign(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }), "n-0S6_WzA2Mj", "issuer mismatch"},
+		{"wrong audience", issuer.sign(func(c jwt.MapClaims) { c["aud"] = "other" }), "n-0S6_WzA2Mj", "audience mismatch"},
+		{"audience array without azp", issuer.sign(func(c jwt.MapClaims) { c["aud"] = []string{"app", "other"} }), "n-0S6_WzA2Mj", "authorized party mismatch"},
+		{"wrong nonce", issuer.sign(nil), "replayed", "nonce mismatch"},
+		{"no subject", issuer.sign(func(c jwt.MapClaims) { delete(c, "sub") }), "n-0S6_WzA2Mj", "no subject"},
+		{"forged signature", forgedRaw, "n-0S6_WzA2Mj", "invalid id token"},
+		{"unsigned", strings.Join(strings.Split(issuer.sign(nil), ".")[:2], ".") + ".", "n-0S6_WzA2Mj", "invalid id token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.VerifyIDToken(tt.raw, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims.Subject != "user-1" || claims.Email != "jane@example.com" || !bool(claims.EmailVerified) {
+					t.Fatalf("claims: %+v", claims)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+
+	if _, err := p.VerifyIDToken(issuer.sign(nil), "n-0S6_WzA2Mj"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(issuer.sign(nil), "n-0S6_WzA2Mj"); err != nil {
+		t.Fatal(err)
+	}
+	if issuer.jwksHits != 1 {
+		t.Fatalf("JWKS fetched %d times for a known kid, want 1", issuer.jwksHits)
+	}
+
+	// A kid we have just refreshed for is not fetched again right away.
+	issuer.rotate("key-2")
+	rotated := issuer.sign(nil)
+	if _, err := p.VerifyIDToken(rotated, "n-0S6_WzA2Mj"); err == nil || !strings.Contains(err.Error(), `kid "key-2"`) {
+		t.Fatalf("error %v, want unknown kid", err)
+	}
+	if issuer.jwksHits != 1 {
+		t.Fatalf("JWKS refetched within the refresh interval")
+	}
+
+	// Once the interval has passed the new key is picked up, and tokens
+	// signed with the old key still verify.
+	p.keysFetched = time.Now().Add(-keysRefreshInterval)
+	if _, err := p.VerifyIDToken(rotated, "n-0S6_WzA2Mj"); err != nil {
+		t.Fatal(err)
+	}
+	if issuer.jwksHits != 2 {
+		t.Fatalf("JWKS fetched %d times after rotation, want 2", issuer.jwksHits)
+	}
+	issuer.mu.Lock()
+	issuer.current = "key-1"
+	issuer.mu.Unlock()
+	if _, err := p.VerifyIDToken(issuer.sign(nil), "n-0S6_WzA2Mj"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+	p.Config.Issuer = issuer.URL + "/tenant"
+
+	_, err := p.Discover()
+	if err == nil {
+		t.Fatal("discovery for another issuer accepted")
+	}
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := issuer.provider()
+
+	authURL, err := p.AuthCodeURL("state-1", "n-0S6_WzA2Mj", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := target.Query()
+	if target.Path != "/authorize" || q.Get("client_id") != "app" || q.Get("nonce") != "n-0S6_WzA2Mj" || q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid email profile" {
+		t.Fatalf("authorization URL %s", authURL)
+	}
+
+	issuer.nextToken = issuer.sign(nil)
+	token, err := p.Exchange("good-code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(token.IDToken, "n-0S6_WzA2Mj"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Exchange("bad-code", "verifier"); err == nil {
+		t.Fatal("exchange of a rejected code succeeded")
+	}
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"loginApi/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsBreached reports whether password appears in the local breached-password
+// list. The list is laid out like the Pwned Passwords range API: one file per
+// five-character SHA-1 prefix, each holding "SUFFIX:COUNT" lines. Only the
+// file for the password's prefix is read. With no list configured every
+// password passes.
+func IsBreached(password string) (bool, error) {
+	dir := config.App.Password.BreachedListDir
+	if dir == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(dir, prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, _ := strings.Cut(line, ":")
+		if strings.EqualFold(candidate, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
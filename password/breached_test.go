@@ -0,0 +1,68 @@
+package password
+
+import (
+	"loginApi/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsBreached(t *testing.T) {
+	// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	// SHA-1("letmein")  = B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3
+	// SHA-1("123456")   = 7C4A8D09CA3762AF61E59520943DC26494F8941B
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("5BAA6", "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n")
+	write("B7A87.txt", "5fc1ea228b9061041b7cec4bd3c52ab3ce3:12\n")
+	write("7C4A8", "D09CA3762AF61E59520943DC26494F8941B:0\n")
+
+	// A list whose file for the prefix of "password" lacks its suffix
+	other := t.TempDir()
+	if err := os.WriteFile(filepath.Join(other, "5BAA6"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		password string
+		want     bool
+	}{
+		{"listed", dir, "password", true},
+		{"listed in a .txt file, lower case", dir, "letmein", true},
+		{"padding entry with a zero count", dir, "123456", false},
+		{"prefix file without the suffix", other, "password", false},
+		{"case matters before hashing", dir, "Password", false},
+		{"no file for the prefix", dir, "correct horse battery staple", false},
+		{"no list configured", "", "password", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePolicy(t, config.Password{BreachedListDir: tt.dir})
+			got, err := IsBreached(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBreachedUnreadableList(t *testing.T) {
+	dir := t.TempDir()
+	// A directory where the prefix file should be cannot be read
+	if err := os.Mkdir(filepath.Join(dir, "5BAA6"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	usePolicy(t, config.Password{BreachedListDir: dir})
+	if _, err := IsBreached("password"); err == nil {
+		t.Fatal("expected an error reading the list")
+	}
+}
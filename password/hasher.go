@@ -0,0 +1,127 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"loginApi/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var ErrUnknownHash = errors.New("unrecognized password hash format")
+
+// Hash hashes password with the configured algorithm.
+func Hash(password string) (string, error) {
+	cfg := config.App.Password
+	if cfg.Algorithm == "argon2id" {
+		return hashArgon2id(password, cfg.Argon2Time, cfg.Argon2MemoryKiB, cfg.Argon2Threads)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Verify checks password against a stored bcrypt or argon2id hash.
+func Verify(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1, nil
+	}
+
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// weaker parameters than are currently configured.
+func NeedsRehash(hash string) bool {
+	cfg := config.App.Password
+
+	if cfg.Algorithm == "argon2id" {
+		params, _, _, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		return params.time != cfg.Argon2Time || params.memory != cfg.Argon2MemoryKiB || params.threads != cfg.Argon2Threads
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != cfg.BcryptCost
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// hashArgon2id encodes the result in the PHC string format used by the
+// reference implementation: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func hashArgon2id(password string, time, memory uint32, threads uint8) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2 key")
+	}
+
+	return params, salt, key, nil
+}
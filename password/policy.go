@@ -0,0 +1,78 @@
+package password
+
+import (
+	"fmt"
+	"loginApi/config"
+	"strings"
+	"unicode"
+)
+
+// Validate checks password against the configured policy and returns one
+// message per rule it breaks. name and email are the account's own details,
+// which must not appear in the password.
+func Validate(password, name, email string) []string {
+	policy := config.App.Password
+	var problems []string
+
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("Password must be at least %d characters long", policy.MinLength))
+	}
+
+	// bcrypt silently ignores everything past 72 bytes
+	if policy.Algorithm != "argon2id" && len(password) > 72 {
+		problems = append(problems, "Password must be at most 72 bytes long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		problems = append(problems, "Password must contain an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		problems = append(problems, "Password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		problems = append(problems, "Password must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		problems = append(problems, "Password must contain a symbol")
+	}
+
+	if policy.DisallowPersonalInfo && containsPersonalInfo(password, name, email) {
+		problems = append(problems, "Password must not contain your name or email")
+	}
+
+	return problems
+}
+
+// containsPersonalInfo looks for the name, each word of it, and the local
+// part of the email inside the password, ignoring case. Fragments shorter
+// than three characters are too common to be meaningful.
+func containsPersonalInfo(password, name, email string) bool {
+	lower := strings.ToLower(password)
+
+	candidates := strings.Fields(strings.ToLower(name))
+	candidates = append(candidates, strings.ToLower(strings.Join(strings.Fields(name), "")))
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok {
+		candidates = append(candidates, local)
+	}
+
+	for _, c := range candidates {
+		if len(c) >= 3 && strings.Contains(lower, c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package password
+
+import (
+	"loginApi/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func usePolicy(t *testing.T, policy config.Password) {
+	previous := config.App.Password
+	config.App.Password = policy
+	t.Cleanup(func() { config.App.Password = previous })
+}
+
+func TestValidate(t *testing.T) {
+	strict := config.Password{
+		MinLength:            10,
+		RequireUpper:         true,
+		RequireLower:         true,
+		RequireDigit:         true,
+		RequireSymbol:        true,
+		DisallowPersonalInfo: true,
+	}
+
+	tests := []struct {
+		name     string
+		policy   config.Password
+		password string
+		problems []string
+	}{
+		{"meets every rule", strict, "Tr0ub4dor&3x", nil},
+		{"too short", strict, "Tr0ub&3", []string{"Password must be at least 10 characters long"}},
+		{"length counts characters, not bytes", config.Password{MinLength: 4}, "äöüß", nil},
+		{"no uppercase", strict, "tr0ub4dor&3x", []string{"Password must contain an uppercase letter"}},
+		{"no lowercase", strict, "TR0UB4DOR&3X", []string{"Password must contain a lowercase letter"}},
+		{"no digit", strict, "Troubadour&xx", []string{"Password must contain a digit"}},
+		{"no symbol", strict, "Tr0ub4dor33x", []string{"Password must contain a symbol"}},
+		{"space counts as a symbol", strict, "Tr0ub4dor 3x", nil},
+		{"non-ASCII letters count", strict, "Ünïcödé4&xyz", nil},
+		{"several rules broken", strict, "abc", []string{
+			"Password must be at least 10 characters long",
+			"Password must contain an uppercase letter",
+			"Password must contain a digit",
+			"Password must contain a symbol",
+		}},
+		{"rules off", config.Password{}, "a", nil},
+		{"over bcrypt's limit", config.Password{}, strings.Repeat("a", 73), []string{"Password must be at most 72 bytes long"}},
+		{"at bcrypt's limit", config.Password{}, strings.Repeat("a", 72), nil},
+		{"long with argon2id", config.Password{Algorithm: "argon2id"}, strings.Repeat("a", 200), nil},
+		{"contains the name", strict, "Xj4&Margaret!", []string{"Password must not contain your name or email"}},
+		{"contains the email", strict, "Q9#mvdb1970x", []string{"Password must not contain your name or email"}},
+		{"personal info allowed", config.Password{}, "margaret", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePolicy(t, tt.policy)
+			problems := Validate(tt.password, "Margaret van der Berg", "mvdb1970@example.com")
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Fatalf("Validate(%q) = %q, want %q", tt.password, problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestContainsPersonalInfo(t *testing.T) {
+	tests := []struct {
+		password, name, email string
+		want                  bool
+	}{
+		{"xxMARGARETxx", "Margaret Berg", "m@example.com", true},
+		{"xxbergxx", "Margaret Berg", "m@example.com", true},
+		{"margaretberg1", "Margaret Berg", "m@example.com", true},
+		{"xxmbergxx", "Ann", "mberg@example.com", true},
+		{"example.com!", "Ann", "mberg@example.com", false},
+		{"xxvanxx", "Margaret van Berg", "m@example.com", true},
+		// Fragments under three characters are ignored
+		{"xxLixx", "Li Wu", "li@example.com", false},
+		{"xxliwuxx", "Li Wu", "li@example.com", true},
+		{"anything", "", "", false},
+		{"nobody@", "", "not-an-email", false},
+	}
+	for _, tt := range tests {
+		if got := containsPersonalInfo(tt.password, tt.name, tt.email); got != tt.want {
+			t.Errorf("containsPersonalInfo(%q, %q, %q) = %v, want %v", tt.password, tt.name, tt.email, got, tt.want)
+		}
+	}
+}
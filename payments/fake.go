@@ -0,0 +1,80 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DeclinedSource is the payment source the fake provider always declines.
+const DeclinedSource = "fake_declined"
+
+type fakePayment struct {
+	authorized int64
+	captured   int64
+	refunded   int64
+}
+
+// Fake is an in-memory provider for development and tests. It accepts every
+// source except DeclinedSource and keeps payments only for the life of the
+// process.
+type Fake struct {
+	mu       sync.Mutex
+	next     int
+	payments map[string]*fakePayment
+}
+
+func NewFake() *Fake {
+	return &Fake{payments: map[string]*fakePayment{}}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(ctx context.Context, req Request) (Authorization, error) {
+	if req.Amount <= 0 {
+		return Authorization{}, fmt.Errorf("invalid amount %d", req.Amount)
+	}
+	if req.Source == DeclinedSource {
+		return Authorization{}, ErrDeclined
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	ref := fmt.Sprintf("fake_%d", f.next)
+	f.payments[ref] = &fakePayment{authorized: req.Amount}
+	return Authorization{Ref: ref, Amount: req.Amount}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, ref string, amount int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[ref]
+	if !ok {
+		return ErrNotFound
+	}
+	if p.captured > 0 || amount <= 0 || amount > p.authorized {
+		return ErrInvalidState
+	}
+	p.captured = amount
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, ref string, amount int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.payments[ref]
+	if !ok {
+		return ErrNotFound
+	}
+	if amount <= 0 || p.refunded+amount > p.captured {
+		return ErrInvalidState
+	}
+	p.refunded += amount
+	return nil
+}
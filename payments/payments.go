@@ -0,0 +1,104 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"loginApi/config"
+	"strings"
+)
+
+var (
+	// ErrDeclined means the provider refused to authorize the payment.
+	ErrDeclined = errors.New("payment declined")
+	// ErrInvalidState means the payment cannot be captured or refunded
+	// in its current state, or not for the amount asked.
+	ErrInvalidState = errors.New("payment is not in a state that allows this")
+	// ErrNotFound means the provider does not know the payment.
+	ErrNotFound = errors.New("payment not found")
+)
+
+// Request describes a payment to authorize. Source identifies how the
+// customer pays (a card token, wallet ID and so on) and is passed through
+// to the provider as is.
+type Request struct {
+	OrderID  int
+	Amount   int64
+	Currency string
+	Source   string
+}
+
+// Authorization is a payment the provider has reserved funds for. Ref is
+// the provider's own ID for it.
+type Authorization struct {
+	Ref    string
+	Amount int64
+}
+
+// Provider is a payment service. Amounts are in the currency's minor unit.
+// Capture may take less than was authorized, and refunds may be partial
+// as long as they do not add up to more than was captured.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, req Request) (Authorization, error)
+	Capture(ctx context.Context, ref string, amount int64) error
+	Refund(ctx context.Context, ref string, amount int64) error
+}
+
+// Event is a webhook notification about a payment. ID is unique per event
+// and is used to ignore deliveries that were already handled.
+type Event struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	PaymentRef string `json:"payment_ref"`
+	Amount     int64  `json:"amount"`
+}
+
+// Webhook event types.
+const (
+	EventCaptured = "payment.captured"
+	EventRefunded = "payment.refunded"
+	EventFailed   = "payment.failed"
+)
+
+// Default is the provider selected by config.App.Payments, set by Init.
+var Default Provider
+
+// Init builds the configured payment provider.
+func Init() {
+	cfg := config.App.Payments
+
+	switch cfg.Provider {
+	case "", "fake":
+		Default = NewFake()
+	default:
+		panic(fmt.Sprintf("unknown payment provider %q", cfg.Provider))
+	}
+
+	if cfg.WebhookSecret == "" {
+		fmt.Println("Payment webhook secret not set, webhooks will be rejected")
+	}
+
+	fmt.Printf("Payments ready (%s)\n", Default.Name())
+}
+
+// Sign returns the signature of a webhook body: "sha256=" followed by the
+// hex HMAC-SHA256 of the body keyed with the webhook secret.
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a webhook signature against the configured
+// secret. Without a secret nothing verifies.
+func VerifySignature(body []byte, signature string) bool {
+	secret := config.App.Payments.WebhookSecret
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(body, secret)))
+}
@@ -0,0 +1,41 @@
+package payments
+
+import (
+	"loginApi/config"
+	"strings"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	previous := config.App.Payments.WebhookSecret
+	t.Cleanup(func() { config.App.Payments.WebhookSecret = previous })
+
+	body := []byte(`{"id":"evt_1","type":"payment.captured","payment_ref":"fake_1","amount":1000}`)
+	valid := Sign(body, "whsec")
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		ok        bool
+	}{
+		{"valid", "whsec", body, valid, true},
+		{"no secret configured", "", body, Sign(body, ""), false},
+		{"other secret", "whsec", body, Sign(body, "other"), false},
+		{"body changed", "whsec", append([]byte(" "), body...), valid, false},
+		{"missing prefix", "whsec", body, strings.TrimPrefix(valid, "sha256="), false},
+		{"other algorithm", "whsec", body, "sha1=" + strings.TrimPrefix(valid, "sha256="), false},
+		{"upper-case hex", "whsec", body, "sha256=" + strings.ToUpper(strings.TrimPrefix(valid, "sha256=")), false},
+		{"truncated", "whsec", body, valid[:len(valid)-2], false},
+		{"empty", "whsec", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.App.Payments.WebhookSecret = tt.secret
+			if got := VerifySignature(tt.body, tt.signature); got != tt.ok {
+				t.Fatalf("VerifySignature = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package pricing
+
+import (
+	"fmt"
+	"loginApi/money"
+	"sort"
+	"time"
+)
+
+// Discount kinds.
+const (
+	Percentage   = "percentage"
+	FixedAmount  = "fixed_amount"
+	FreeShipping = "free_shipping"
+)
+
+// Rule is a discount the engine may apply: a coupon when Code is set, an
+// automatic promotion otherwise. Value is a whole percentage for Percentage
+// and an amount in Currency's minor unit for FixedAmount. MinSubtotal is in
+// Currency too. A rule with ProductIDs or CategoryIDs only discounts the
+// matching lines; CategoryIDs must already include subcategories.
+type Rule struct {
+	ID          int
+	Code        string
+	Name        string
+	Kind        string
+	Value       int64
+	Currency    string
+	MinSubtotal int64
+	ProductIDs  []int
+	CategoryIDs []int
+	StartsAt    *time.Time
+	EndsAt      *time.Time
+}
+
+// Label is how the rule is named in explanations.
+func (rule Rule) Label() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return rule.Code
+}
+
+type Line struct {
+	ProductID  int
+	CategoryID int
+	LineTotal  int64
+}
+
+// Basket is what is being priced. Shipping is the fee before discounts.
+type Basket struct {
+	Currency string
+	Lines    []Line
+	Shipping int64
+}
+
+func (b Basket) Subtotal() int64 {
+	var subtotal int64
+	for _, line := range b.Lines {
+		subtotal += line.LineTotal
+	}
+	return subtotal
+}
+
+// Applied is a rule that took Amount off the basket.
+type Applied struct {
+	Rule        Rule
+	Amount      int64
+	Explanation string
+}
+
+// Rejected is a rule that did not apply, with the reason why.
+type Rejected struct {
+	Rule   Rule
+	Reason string
+}
+
+type Result struct {
+	Subtotal int64
+	Discount int64
+	Shipping int64
+	Total    int64
+	Applied  []Applied
+	Rejected []Rejected
+}
+
+// kindOrder is the order rules are applied in: percentages first, so that
+// fixed amounts come off the already reduced price, then shipping.
+var kindOrder = map[string]int{Percentage: 0, FixedAmount: 1, FreeShipping: 2}
+
+// Evaluate applies every rule that is valid at now to the basket. Each
+// discount comes off what earlier ones left, so lines never go below zero;
+// explanations are formatted for locale.
+func Evaluate(b Basket, rules []Rule, now time.Time, locale string) Result {
+	result := Result{Subtotal: b.Subtotal(), Shipping: b.Shipping}
+
+	sorted := append([]Rule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if kindOrder[sorted[i].Kind] != kindOrder[sorted[j].Kind] {
+			return kindOrder[sorted[i].Kind] < kindOrder[sorted[j].Kind]
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	remaining := make([]int64, len(b.Lines))
+	for i, line := range b.Lines {
+		remaining[i] = line.LineTotal
+	}
+
+	format := func(amount int64) string {
+		return money.Format(money.Money{Amount: amount, Currency: b.Currency}, locale)
+	}
+
+	for _, rule := range sorted {
+		if reason := checkRule(rule, b, result.Subtotal, now, format); reason != "" {
+			result.Rejected = append(result.Rejected, Rejected{Rule: rule, Reason: reason})
+			continue
+		}
+
+		eligible := eligibleLines(rule, b.Lines)
+		scope := "your order"
+		if len(rule.ProductIDs) > 0 || len(rule.CategoryIDs) > 0 {
+			scope = "eligible items"
+		}
+
+		var amount int64
+		var explanation string
+		switch rule.Kind {
+		case Percentage:
+			for _, i := range eligible {
+				cut := remaining[i] * rule.Value / 100
+				remaining[i] -= cut
+				amount += cut
+			}
+			explanation = fmt.Sprintf("%s: %d%% off %s, saving %s", rule.Label(), rule.Value, scope, format(amount))
+		case FixedAmount:
+			left := rule.Value
+			for _, i := range eligible {
+				cut := remaining[i]
+				if cut > left {
+					cut = left
+				}
+				remaining[i] -= cut
+				left -= cut
+				amount += cut
+			}
+			explanation = fmt.Sprintf("%s: %s off %s", rule.Label(), format(amount), scope)
+			if amount < rule.Value {
+				explanation += fmt.Sprintf(" (worth up to %s)", format(rule.Value))
+			}
+		case FreeShipping:
+			amount = result.Shipping
+			result.Shipping = 0
+			explanation = fmt.Sprintf("%s: free shipping, saving %s", rule.Label(), format(amount))
+		}
+
+		if amount == 0 {
+			reason := "None of the items in your cart qualify"
+			if rule.Kind == FreeShipping {
+				reason = "Shipping is already free"
+			}
+			result.Rejected = append(result.Rejected, Rejected{Rule: rule, Reason: reason})
+			continue
+		}
+
+		result.Applied = append(result.Applied, Applied{Rule: rule, Amount: amount, Explanation: explanation})
+		if rule.Kind != FreeShipping {
+			result.Discount += amount
+		}
+	}
+
+	result.Total = result.Subtotal - result.Discount + result.Shipping
+	return result
+}
+
+// checkRule returns why rule cannot be used on the basket, or "" if it can.
+func checkRule(rule Rule, b Basket, subtotal int64, now time.Time, format func(int64) string) string {
+	if rule.StartsAt != nil && now.Before(*rule.StartsAt) {
+		return fmt.Sprintf("Not valid until %s", rule.StartsAt.Format("2 Jan 2006 15:04 MST"))
+	}
+	if rule.EndsAt != nil && !now.Before(*rule.EndsAt) {
+		return fmt.Sprintf("Expired on %s", rule.EndsAt.Format("2 Jan 2006 15:04 MST"))
+	}
+	if rule.Currency != "" && rule.Currency != b.Currency {
+		return fmt.Sprintf("Only valid for orders in %s", rule.Currency)
+	}
+	if subtotal < rule.MinSubtotal {
+		return fmt.Sprintf("Requires an order of at least %s; add %s more", format(rule.MinSubtotal), format(rule.MinSubtotal-subtotal))
+	}
+	if len(eligibleLines(rule, b.Lines)) == 0 {
+		return "None of the items in your cart qualify"
+	}
+	return ""
+}
+
+// eligibleLines returns the indexes of the lines a rule applies to.
+func eligibleLines(rule Rule, lines []Line) []int {
+	var eligible []int
+	for i, line := range lines {
+		if len(rule.ProductIDs) == 0 && len(rule.CategoryIDs) == 0 {
+			eligible = append(eligible, i)
+			continue
+		}
+		if containsInt(rule.ProductIDs, line.ProductID) || containsInt(rule.CategoryIDs, line.CategoryID) {
+			eligible = append(eligible, i)
+		}
+	}
+	return eligible
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package pricing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	// Two lines totalling €30.00 with €5.00 shipping
+	basket := Basket{
+		Currency: "EUR",
+		Lines: []Line{
+			{ProductID: 1, CategoryID: 10, LineTotal: 1000},
+			{ProductID: 2, CategoryID: 20, LineTotal: 2000},
+		},
+		Shipping: 500,
+	}
+
+	type applied struct {
+		id     int
+		amount int64
+	}
+
+	tests := []struct {
+		name        string
+		basket      Basket
+		rules       []Rule
+		discount    int64
+		shipping    int64
+		total       int64
+		applied     []applied
+		rejected    map[int]string
+		explanation string
+	}{
+		{
+			name:     "no rules",
+			basket:   basket,
+			shipping: 500, total: 3500,
+		},
+		{
+			name:     "percentage off the order",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Code: "TEN", Kind: Percentage, Value: 10}},
+			discount: 300, shipping: 500, total: 3200,
+			applied:     []applied{{1, 300}},
+			explanation: "TEN: 10% off your order, saving €3.00",
+		},
+		{
+			name:     "percentage comes off before a fixed amount",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: FixedAmount, Value: 500}, {ID: 2, Kind: Percentage, Value: 10}},
+			discount: 800, shipping: 500, total: 2700,
+			applied: []applied{{2, 300}, {1, 500}},
+		},
+		{
+			name:     "rules of a kind apply by ID",
+			basket:   basket,
+			rules:    []Rule{{ID: 5, Kind: Percentage, Value: 50}, {ID: 3, Kind: Percentage, Value: 10}},
+			discount: 1650, shipping: 500, total: 1850,
+			applied: []applied{{3, 300}, {5, 1350}},
+		},
+		{
+			name:     "fixed amount larger than the basket",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Name: "Gift card", Kind: FixedAmount, Value: 5000}},
+			discount: 3000, shipping: 500, total: 500,
+			applied:     []applied{{1, 3000}},
+			explanation: "Gift card: €30.00 off your order (worth up to €50.00)",
+		},
+		{
+			name:     "product-scoped percentage",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Code: "HALF", Kind: Percentage, Value: 50, ProductIDs: []int{2}}},
+			discount: 1000, shipping: 500, total: 2500,
+			applied:     []applied{{1, 1000}},
+			explanation: "HALF: 50% off eligible items, saving €10.00",
+		},
+		{
+			name:     "category-scoped fixed amount",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: FixedAmount, Value: 1500, CategoryIDs: []int{10}}},
+			discount: 1000, shipping: 500, total: 2500,
+			applied: []applied{{1, 1000}},
+		},
+		{
+			name:     "no line qualifies",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 10, ProductIDs: []int{99}}},
+			shipping: 500, total: 3500,
+			rejected: map[int]string{1: "None of the items in your cart qualify"},
+		},
+		{
+			name:     "percentage rounds down",
+			basket:   Basket{Currency: "EUR", Lines: []Line{{ProductID: 1, LineTotal: 999}}},
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 33}},
+			discount: 329, total: 670,
+			applied: []applied{{1, 329}},
+		},
+		{
+			name:     "free shipping",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Code: "SHIP", Kind: FreeShipping}},
+			discount: 0, shipping: 0, total: 3000,
+			applied:     []applied{{1, 500}},
+			explanation: "SHIP: free shipping, saving €5.00",
+		},
+		{
+			name:     "free shipping when shipping is free",
+			basket:   Basket{Currency: "EUR", Lines: basket.Lines},
+			rules:    []Rule{{ID: 1, Kind: FreeShipping}},
+			total:    3000,
+			rejected: map[int]string{1: "Shipping is already free"},
+		},
+		{
+			name:     "nothing left for a fixed amount",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 100}, {ID: 2, Kind: FixedAmount, Value: 500}},
+			discount: 3000, shipping: 500, total: 500,
+			applied:  []applied{{1, 3000}},
+			rejected: map[int]string{2: "None of the items in your cart qualify"},
+		},
+		{
+			name:     "minimum subtotal not reached",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 10, MinSubtotal: 5000}},
+			shipping: 500, total: 3500,
+			rejected: map[int]string{1: "Requires an order of at least €50.00; add €20.00 more"},
+		},
+		{
+			name:     "minimum subtotal reached exactly",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: FixedAmount, Value: 100, MinSubtotal: 3000}},
+			discount: 100, shipping: 500, total: 3400,
+			applied: []applied{{1, 100}},
+		},
+		{
+			name:     "not started",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 10, StartsAt: &later}},
+			shipping: 500, total: 3500,
+			rejected: map[int]string{1: "Not valid until 1 Mar 2026 13:00 UTC"},
+		},
+		{
+			name:     "started and not ended",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 10, StartsAt: &earlier, EndsAt: &later}},
+			discount: 300, shipping: 500, total: 3200,
+			applied: []applied{{1, 300}},
+		},
+		{
+			name:     "ends now",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: Percentage, Value: 10, EndsAt: &now}},
+			shipping: 500, total: 3500,
+			rejected: map[int]string{1: "Expired on 1 Mar 2026 12:00 UTC"},
+		},
+		{
+			name:     "other currency",
+			basket:   basket,
+			rules:    []Rule{{ID: 1, Kind: FixedAmount, Value: 500, Currency: "USD"}, {ID: 2, Kind: FixedAmount, Value: 500, Currency: "EUR"}},
+			discount: 500, shipping: 500, total: 3000,
+			applied:  []applied{{2, 500}},
+			rejected: map[int]string{1: "Only valid for orders in USD"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Evaluate(tt.basket, tt.rules, now, "en")
+
+			if result.Subtotal != tt.basket.Subtotal() || result.Discount != tt.discount || result.Shipping != tt.shipping || result.Total != tt.total {
+				t.Fatalf("subtotal %d, discount %d, shipping %d, total %d; want discount %d, shipping %d, total %d",
+					result.Subtotal, result.Discount, result.Shipping, result.Total, tt.discount, tt.shipping, tt.total)
+			}
+
+			if len(result.Applied) != len(tt.applied) {
+				t.Fatalf("applied %+v, want %v", result.Applied, tt.applied)
+			}
+			for i, want := range tt.applied {
+				if got := result.Applied[i]; got.Rule.ID != want.id || got.Amount != want.amount {
+					t.Errorf("applied[%d] = rule %d for %d, want rule %d for %d", i, got.Rule.ID, got.Amount, want.id, want.amount)
+				}
+			}
+			if tt.explanation != "" && result.Applied[0].Explanation != tt.explanation {
+				t.Errorf("explanation %q, want %q", result.Applied[0].Explanation, tt.explanation)
+			}
+
+			if len(result.Rejected) != len(tt.rejected) {
+				t.Fatalf("rejected %+v, want %v", result.Rejected, tt.rejected)
+			}
+			for _, rejected := range result.Rejected {
+				if want, ok := tt.rejected[rejected.Rule.ID]; !ok || !strings.Contains(rejected.Reason, want) {
+					t.Errorf("rule %d rejected with %q, want %q", rejected.Rule.ID, rejected.Reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateKeepsRuleOrder(t *testing.T) {
+	rules := []Rule{{ID: 2, Kind: FreeShipping}, {ID: 1, Kind: Percentage, Value: 10}}
+	Evaluate(Basket{Currency: "EUR", Lines: []Line{{LineTotal: 100}}, Shipping: 10}, rules, time.Now(), "en")
+	if rules[0].ID != 2 || rules[1].ID != 1 {
+		t.Fatalf("Evaluate reordered the caller's rules: %+v", rules)
+	}
+}
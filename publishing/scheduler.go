@@ -0,0 +1,81 @@
+package publishing
+
+import (
+	"fmt"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/search"
+	"time"
+)
+
+// checkInterval is how often scheduled drafts are looked for, and so the
+// most a scheduled product can go live late.
+const checkInterval = time.Minute
+
+// StartScheduler publishes scheduled drafts once their publish_at passes.
+func StartScheduler() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			if err := PublishDue(time.Now()); err != nil {
+				fmt.Printf("Error publishing scheduled products: %v\n", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// PublishDue publishes every live draft whose publish_at is at or before
+// now and adds it to the search index. Several server instances may run it
+// at once; the row locks make each product flip exactly once.
+func PublishDue(now time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, name, category_id FROM products WHERE status = 'draft' AND publish_at <= ? AND deleted_at IS NULL FOR UPDATE", now)
+	if err != nil {
+		return err
+	}
+	var docs []search.Document
+	for rows.Next() {
+		var doc search.Document
+		if err := rows.Scan(&doc.ProductID, &doc.Name, &doc.CategoryID); err != nil {
+			rows.Close()
+			return err
+		}
+		docs = append(docs, doc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ProductID
+	}
+	placeholders, args := helpers.InPlaceholders(ids)
+	_, err = tx.Exec(fmt.Sprintf("UPDATE products SET status = 'published', publish_at = NULL, updated_at = ?, version = version + 1 WHERE id IN (%s)", placeholders), append([]interface{}{now}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		if err := search.Default.Put(doc); err != nil {
+			fmt.Printf("Error indexing product %d: %v\n", doc.ProductID, err)
+		}
+	}
+	fmt.Printf("Published %d scheduled products\n", len(docs))
+	return nil
+}
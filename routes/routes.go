@@ -2,26 +2,121 @@ package routes
 
 import (
 	// Adjust the import path as necessary
+	"loginApi/config"
 	"loginApi/controllers"
 	"loginApi/middleware"
+	"loginApi/storage"
 	"net/http"
 )
 
+// RegisterRoutes mounts every endpoint. JWTAuth routes take OAuth2 access
+// tokens only when they name the scope they need with RequireScope; the
+// others, and every RequireAdmin route, are for first-party logins.
 func RegisterRoutes() {
 	// Auth
 	http.HandleFunc("/register", controllers.Register)
 	http.HandleFunc("/login", controllers.Login)
+	http.Handle("/me", middleware.ProtectWrites(middleware.JWTAuth(middleware.RequireScope("profile", http.HandlerFunc(controllers.Profile))), middleware.JWTAuth(middleware.RequireScope("profile", middleware.RequireScope("profile:write", http.HandlerFunc(controllers.Profile))))))
+	http.Handle("/me/sessions", middleware.JWTAuth(http.HandlerFunc(controllers.MySessions)))
+	http.Handle("/me/sessions/", middleware.JWTAuth(http.HandlerFunc(controllers.MySessions)))
+
+	// OpenID Connect login
+	http.HandleFunc("/oidc/login/", controllers.OIDCLogin)
+	http.HandleFunc("/oidc/callback/", controllers.OIDCCallback)
+
+	// OAuth2
+	http.Handle("/oauth/clients", middleware.JWTAuth(http.HandlerFunc(controllers.RegisterOAuthClient)))
+	http.Handle("/oauth/authorize", middleware.JWTAuth(http.HandlerFunc(controllers.OAuthAuthorize)))
+	http.HandleFunc("/oauth/token", controllers.OAuthToken)
+	http.HandleFunc("/oauth/introspect", controllers.OAuthIntrospect)
+	http.HandleFunc("/oauth/revoke", controllers.OAuthRevoke)
 
 	// Products
-	http.HandleFunc("/products", controllers.GetProduct)
-	http.Handle("/create/product", middleware.JWTAuth(http.HandlerFunc(controllers.CreateProduct)))
-	http.Handle("/update/products/", middleware.JWTAuth(http.HandlerFunc(controllers.UpdateProduct)))
+	http.Handle("/products", middleware.OptionalAuth(http.HandlerFunc(controllers.GetProduct)))
+	http.Handle("/products/", middleware.ProtectWrites(middleware.OptionalAuth(http.HandlerFunc(controllers.GetProductDetail)), middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.DeleteProduct)))))
+	http.Handle("/products/search", middleware.OptionalAuth(http.HandlerFunc(controllers.SearchProducts)))
+	http.Handle("/create/product", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.CreateProduct))))
+	http.Handle("/update/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.UpdateProduct))))
+	http.Handle("/batch/products", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.BatchProducts))))
+	http.Handle("/status/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ChangeProductStatus))))
+	http.Handle("/transfer/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.TransferProduct))))
+	http.Handle("/upload/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.UploadProductImage))))
+
+	// Tags
+	http.Handle("/tags/products/", middleware.ProtectWrites(http.HandlerFunc(controllers.ProductTags), middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ProductTags)))))
+	http.HandleFunc("/tags/autocomplete", controllers.TagAutocomplete)
+
+	// Reviews
+	http.Handle("/reviews/products/", middleware.ProtectWrites(middleware.OptionalAuth(http.HandlerFunc(controllers.ProductReviews)), middleware.JWTAuth(middleware.RequireScope("reviews", http.HandlerFunc(controllers.ProductReviews)))))
+	http.Handle("/reviews/", middleware.JWTAuth(middleware.RequireScope("reviews", http.HandlerFunc(controllers.Review))))
+	http.Handle("/moderate/reviews/", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.ModerateReview))))
+
+	// Options and variants
+	http.Handle("/options/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ProductOptions))))
+	http.Handle("/options/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.DeleteOption))))
+	http.Handle("/variants/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ProductVariants))))
+	http.Handle("/variants/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.Variant))))
+
+	// Uploaded files, when they are kept on local disk
+	if config.App.Storage.Driver == "" || config.App.Storage.Driver == "local" {
+		http.Handle("/uploads/", http.StripPrefix("/uploads/", storage.FileServer(config.App.Storage.LocalDir)))
+	}
+
+	// Inventory
+	http.Handle("/stock/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ProductStock))))
+	http.Handle("/reports/low-stock", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.GetLowStockReport))))
+
+	// Bulk catalog import and export
+	http.Handle("/import/products", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ImportProducts))))
+	http.Handle("/export/products", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.ExportProducts))))
+
+	// Shops, their members and invitations to join them. Reading them takes a
+	// first-party login; OAuth2 clients may only make changes, with shops:write
+	http.Handle("/shops", middleware.ProtectWrites(middleware.JWTAuth(http.HandlerFunc(controllers.Shops)), middleware.JWTAuth(middleware.RequireScope("shops:write", http.HandlerFunc(controllers.Shops)))))
+	http.Handle("/shops/", middleware.ProtectWrites(middleware.JWTAuth(http.HandlerFunc(controllers.Shops)), middleware.JWTAuth(middleware.RequireScope("shops:write", http.HandlerFunc(controllers.Shops)))))
+	http.Handle("/invitations", middleware.JWTAuth(http.HandlerFunc(controllers.MyInvitations)))
+	http.Handle("/accept/invitations/", middleware.JWTAuth(middleware.RequireScope("shops:write", http.HandlerFunc(controllers.AcceptInvitation))))
 
 	// Categories
-	http.HandleFunc("/categories", controllers.GetCategory)
-	http.Handle("/create/categories", middleware.JWTAuth(http.HandlerFunc(controllers.CreateCategory)))
-	http.Handle("/update/categories/", middleware.JWTAuth(http.HandlerFunc(controllers.UpdateCategory)))
+	http.Handle("/categories", middleware.OptionalAuth(http.HandlerFunc(controllers.GetCategory)))
+	http.Handle("/categories/", middleware.ProtectWrites(middleware.OptionalAuth(http.HandlerFunc(controllers.Categories)), middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.Categories)))))
+	http.Handle("/create/categories", middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.CreateCategory))))
+	http.Handle("/update/categories/", middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.UpdateCategory))))
+	http.Handle("/move/categories/", middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.MoveCategory))))
+	http.Handle("/merge/categories/", middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.MergeCategory))))
+
+	// Trash
+	http.Handle("/trash", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.GetTrash))))
+	http.Handle("/restore/products/", middleware.JWTAuth(middleware.RequireScope("products:write", http.HandlerFunc(controllers.RestoreProduct))))
+	http.Handle("/restore/categories/", middleware.JWTAuth(middleware.RequireScope("categories:write", http.HandlerFunc(controllers.RestoreCategory))))
+
+	// Cart and orders. Carts work signed in or, with an X-Cart-Token, anonymously
+	http.Handle("/cart", middleware.OptionalAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.Cart))))
+	http.Handle("/cart/items", middleware.OptionalAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.CartItems))))
+	http.Handle("/cart/items/", middleware.OptionalAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.CartItems))))
+	http.Handle("/cart/merge", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.MergeCart))))
+	http.Handle("/checkout", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.Checkout))))
+	http.Handle("/orders", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.Orders))))
+	http.Handle("/orders/", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.Orders))))
+	http.Handle("/pay/orders/", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.PayOrder))))
+	http.Handle("/status/orders/", middleware.JWTAuth(middleware.RequireScope("orders", http.HandlerFunc(controllers.ChangeOrderStatus))))
+	http.HandleFunc("/webhooks/payments", controllers.PaymentWebhook)
+
+	// Wishlists
+	http.Handle("/wishlists", middleware.JWTAuth(middleware.RequireScope("wishlists", http.HandlerFunc(controllers.Wishlists))))
+	http.Handle("/wishlists/", middleware.JWTAuth(middleware.RequireScope("wishlists", http.HandlerFunc(controllers.Wishlists))))
+	http.Handle("/share/wishlists/", middleware.JWTAuth(middleware.RequireScope("wishlists", http.HandlerFunc(controllers.ShareWishlist))))
+	http.Handle("/shared/wishlists/", middleware.OptionalAuth(http.HandlerFunc(controllers.GetSharedWishlist)))
+
+	// Discounts
+	http.Handle("/discounts", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.GetDiscounts))))
+	http.Handle("/discounts/", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.Discount))))
+	http.Handle("/create/discounts", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.CreateDiscount))))
 
+	// Contact messages
 	http.HandleFunc("/create/message", controllers.CreateMessage)
+	http.Handle("/messages", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.GetMessages))))
+	http.Handle("/messages/", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.DeleteMessage))))
+	http.Handle("/restore/messages/", middleware.JWTAuth(middleware.RequireAdmin(http.HandlerFunc(controllers.RestoreMessage))))
 
 }
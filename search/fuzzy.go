@@ -0,0 +1,174 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Match weights: how much a document term counts towards a query term.
+const (
+	exactWeight  = 1.0
+	prefixWeight = 0.8
+	typoWeight   = 0.6
+)
+
+// minPrefixLength keeps one-letter queries from matching half the catalogue.
+const minPrefixLength = 2
+
+// termMatch is a vocabulary term that a query term matches.
+type termMatch struct {
+	term   string
+	weight float64
+}
+
+// vocabulary counts how many documents contain each term. The catalogue is
+// small enough that scanning it for prefix and typo matches is cheap.
+type vocabulary struct {
+	mu    sync.RWMutex
+	terms map[string]int
+}
+
+func newVocabulary() *vocabulary {
+	return &vocabulary{terms: map[string]int{}}
+}
+
+func (v *vocabulary) add(terms []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, term := range uniqueTerms(terms) {
+		v.terms[term]++
+	}
+}
+
+func (v *vocabulary) remove(terms []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, term := range uniqueTerms(terms) {
+		v.terms[term]--
+		if v.terms[term] <= 0 {
+			delete(v.terms, term)
+		}
+	}
+}
+
+// expand returns the vocabulary terms that query term matches: itself,
+// terms it is a prefix of and, when neither exists, terms within the allowed
+// edit distance. corrected is the closest typo match, or "" when the term
+// was found as typed.
+func (v *vocabulary) expand(term string) (matches []termMatch, corrected string) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if _, ok := v.terms[term]; ok {
+		matches = append(matches, termMatch{term, exactWeight})
+	}
+	if len([]rune(term)) >= minPrefixLength {
+		for candidate := range v.terms {
+			if candidate != term && strings.HasPrefix(candidate, term) {
+				matches = append(matches, termMatch{candidate, prefixWeight})
+			}
+		}
+	}
+	if len(matches) > 0 {
+		return matches, ""
+	}
+
+	maxDistance := allowedTypos(term)
+	if maxDistance == 0 {
+		return nil, ""
+	}
+
+	best := maxDistance + 1
+	for candidate := range v.terms {
+		d := editDistance(term, candidate, maxDistance)
+		if d > maxDistance {
+			continue
+		}
+		matches = append(matches, termMatch{candidate, typoWeight / float64(d)})
+		// Prefer the closest and then the most common term as the correction
+		if d < best || (d == best && (v.terms[candidate] > v.terms[corrected] || v.terms[candidate] == v.terms[corrected] && candidate < corrected)) {
+			best, corrected = d, candidate
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].term < matches[j].term })
+	return matches, corrected
+}
+
+// allowedTypos scales typo tolerance with word length; short words have
+// too many near neighbours to correct safely.
+func allowedTypos(term string) int {
+	n := len([]rune(term))
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b. It gives up early and returns max+1 once the
+// distance is known to exceed max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Memory is an in-process inverted index over product names. It is rebuilt
+// from the database on start-up and kept current through Put and Remove, so
+// it only sees changes made through this server instance.
+type Memory struct {
+	mu       sync.RWMutex
+	docs     map[int]memoryDoc
+	postings map[string]map[int]int // term -> product ID -> term frequency
+	vocab    *vocabulary
+}
+
+type memoryDoc struct {
+	Document
+	terms []string
+}
+
+func NewMemory(docs []Document) *Memory {
+	m := &Memory{
+		docs:     map[int]memoryDoc{},
+		postings: map[string]map[int]int{},
+		vocab:    newVocabulary(),
+	}
+	for _, doc := range docs {
+		m.Put(doc)
+	}
+	return m
+}
+
+func (m *Memory) Put(doc Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeLocked(doc.ProductID)
+
+	terms := Tokenize(doc.Name)
+	m.docs[doc.ProductID] = memoryDoc{Document: doc, terms: terms}
+	for _, term := range terms {
+		if m.postings[term] == nil {
+			m.postings[term] = map[int]int{}
+		}
+		m.postings[term][doc.ProductID]++
+	}
+	m.vocab.add(terms)
+	return nil
+}
+
+func (m *Memory) Remove(productID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeLocked(productID)
+	return nil
+}
+
+func (m *Memory) removeLocked(productID int) {
+	doc, ok := m.docs[productID]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		delete(m.postings[term], productID)
+		if len(m.postings[term]) == 0 {
+			delete(m.postings, term)
+		}
+	}
+	m.vocab.remove(doc.terms)
+	delete(m.docs, productID)
+}
+
+// Search scores documents with a TF-IDF sum over the query terms. Every
+// query term must match, exactly, as a prefix or within the typo tolerance.
+func (m *Memory) Search(ctx context.Context, q Query) (*Result, error) {
+	result := &Result{Hits: []Hit{}, Facets: []Facet{}, Corrections: map[string]string{}}
+
+	queryTerms := uniqueTerms(Tokenize(q.Text))
+	if len(queryTerms) == 0 {
+		return result, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var scores map[int]float64
+	var highlightTerms []string
+	for _, queryTerm := range queryTerms {
+		matches, corrected := m.vocab.expand(queryTerm)
+		if corrected != "" {
+			result.Corrections[queryTerm] = corrected
+		}
+
+		termScores := map[int]float64{}
+		for _, match := range matches {
+			postings := m.postings[match.term]
+			idf := math.Log(1 + float64(len(m.docs))/float64(len(postings)))
+			for productID, tf := range postings {
+				length := float64(len(m.docs[productID].terms))
+				score := match.weight * idf * float64(tf) / length
+				if score > termScores[productID] {
+					termScores[productID] = score
+				}
+			}
+			highlightTerms = append(highlightTerms, match.term)
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for productID, score := range scores {
+			if termScore, ok := termScores[productID]; ok {
+				scores[productID] = score + termScore
+			} else {
+				delete(scores, productID)
+			}
+		}
+	}
+
+	facetCounts := map[int]int{}
+	var hits []Hit
+	for productID, score := range scores {
+		doc := m.docs[productID]
+		facetCounts[doc.CategoryID]++
+		if q.CategoryID > 0 && doc.CategoryID != q.CategoryID {
+			continue
+		}
+		hits = append(hits, Hit{ProductID: productID, Score: score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ProductID < hits[j].ProductID
+	})
+
+	result.Total = len(hits)
+	result.Facets = sortedFacets(facetCounts)
+
+	hits = paginate(hits, q.Offset, q.Limit)
+	for i := range hits {
+		hits[i].Snippet = Highlight(m.docs[hits[i].ProductID].Name, highlightTerms)
+	}
+	result.Hits = append(result.Hits, hits...)
+
+	return result, nil
+}
+
+// sortedFacets orders categories by hit count, largest first.
+func sortedFacets(counts map[int]int) []Facet {
+	facets := []Facet{}
+	for categoryID, count := range counts {
+		facets = append(facets, Facet{CategoryID: categoryID, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].CategoryID < facets[j].CategoryID
+	})
+	return facets
+}
+
+func paginate(hits []Hit, offset, limit int) []Hit {
+	if offset >= len(hits) {
+		return nil
+	}
+	hits = hits[offset:]
+	if limit > 0 && limit < len(hits) {
+		hits = hits[:limit]
+	}
+	return hits
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"loginApi/database"
+	"strings"
+	"sync"
+)
+
+// MySQL searches the products table through its FULLTEXT index (migration
+// 009). MySQL has no typo tolerance of its own, so a vocabulary of product
+// name terms is kept in process to correct misspelled query terms before
+// they are sent to MATCH ... AGAINST.
+type MySQL struct {
+	mu    sync.Mutex
+	terms map[int][]string
+	vocab *vocabulary
+}
+
+func NewMySQL(docs []Document) *MySQL {
+	s := &MySQL{terms: map[int][]string{}, vocab: newVocabulary()}
+	for _, doc := range docs {
+		s.Put(doc)
+	}
+	return s
+}
+
+func (s *MySQL) Put(doc Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vocab.remove(s.terms[doc.ProductID])
+	terms := Tokenize(doc.Name)
+	s.terms[doc.ProductID] = terms
+	s.vocab.add(terms)
+	return nil
+}
+
+func (s *MySQL) Remove(productID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vocab.remove(s.terms[productID])
+	delete(s.terms, productID)
+	return nil
+}
+
+func (s *MySQL) Search(ctx context.Context, q Query) (*Result, error) {
+	result := &Result{Hits: []Hit{}, Facets: []Facet{}, Corrections: map[string]string{}}
+
+	queryTerms := uniqueTerms(Tokenize(q.Text))
+	if len(queryTerms) == 0 {
+		return result, nil
+	}
+
+	// Build a boolean-mode query in which every term is required, either
+	// as a prefix or, for unknown terms, as one of its typo corrections.
+	// Tokens only contain letters and digits, so they cannot inject
+	// boolean operators.
+	var groups []string
+	var highlightTerms []string
+	for _, queryTerm := range queryTerms {
+		matches, corrected := s.vocab.expand(queryTerm)
+		if corrected == "" {
+			groups = append(groups, "+"+queryTerm+"*")
+			highlightTerms = append(highlightTerms, queryTerm)
+			continue
+		}
+
+		result.Corrections[queryTerm] = corrected
+		alternatives := make([]string, len(matches))
+		for i, match := range matches {
+			alternatives[i] = match.term
+			highlightTerms = append(highlightTerms, match.term)
+		}
+		groups = append(groups, "+("+strings.Join(alternatives, " ")+")")
+	}
+	against := strings.Join(groups, " ")
+
+	facetCounts := map[int]int{}
+	rows, err := database.DB.QueryContext(ctx, "SELECT category_id, COUNT(*) FROM products WHERE MATCH(name) AGAINST(? IN BOOLEAN MODE) AND deleted_at IS NULL AND status = 'published' GROUP BY category_id", against)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var categoryID, count int
+		if err := rows.Scan(&categoryID, &count); err != nil {
+			return nil, err
+		}
+		facetCounts[categoryID] = count
+		if q.CategoryID == 0 || q.CategoryID == categoryID {
+			result.Total += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.Facets = sortedFacets(facetCounts)
+
+	where := "MATCH(name) AGAINST(? IN BOOLEAN MODE) AND deleted_at IS NULL AND status = 'published'"
+	args := []interface{}{against, against}
+	if q.CategoryID > 0 {
+		where += " AND category_id = ?"
+		args = append(args, q.CategoryID)
+	}
+	query := fmt.Sprintf("SELECT id, name, MATCH(name) AGAINST(? IN BOOLEAN MODE) AS score FROM products WHERE %s ORDER BY score DESC, id", where)
+	if q.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+
+	hitRows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer hitRows.Close()
+	for hitRows.Next() {
+		var hit Hit
+		var name string
+		if err := hitRows.Scan(&hit.ProductID, &name, &hit.Score); err != nil {
+			return nil, err
+		}
+		hit.Snippet = Highlight(name, highlightTerms)
+		result.Hits = append(result.Hits, hit)
+	}
+
+	return result, hitRows.Err()
+}
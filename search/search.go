@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"loginApi/config"
+	"loginApi/database"
+	"strings"
+	"unicode"
+)
+
+// Document is the searchable part of a product. Only live, published
+// products are indexed.
+type Document struct {
+	ProductID  int
+	Name       string
+	CategoryID int
+}
+
+// Query describes a search. CategoryID, when set, restricts hits but not the
+// category facets, so clients can show counts for the other categories too.
+type Query struct {
+	Text       string
+	CategoryID int
+	Limit      int
+	Offset     int
+}
+
+type Hit struct {
+	ProductID int
+	Score     float64
+	Snippet   string
+}
+
+type Facet struct {
+	CategoryID int
+	Count      int
+}
+
+type Result struct {
+	Hits   []Hit
+	Total  int
+	Facets []Facet
+	// Corrections maps misspelled query terms to the terms searched instead.
+	Corrections map[string]string
+}
+
+// Index is a product search backend. Put and Remove keep it in step with the
+// products table; backends that read the table directly may treat them as
+// hints.
+type Index interface {
+	Search(ctx context.Context, q Query) (*Result, error)
+	Put(doc Document) error
+	Remove(productID int) error
+}
+
+// Default is the backend selected by config.App.Search, set by Init.
+var Default Index
+
+// Init builds the configured search backend and loads the current products
+// into it. It must run after database.Connect.
+func Init() {
+	cfg := config.App.Search
+
+	var docs []Document
+	rows, err := database.DB.Query("SELECT id, name, category_id FROM products WHERE deleted_at IS NULL AND status = 'published'")
+	if err != nil {
+		panic(fmt.Errorf("error loading products for search: %w", err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc Document
+		err := rows.Scan(&doc.ProductID, &doc.Name, &doc.CategoryID)
+		if err != nil {
+			panic(fmt.Errorf("error loading products for search: %w", err))
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		panic(fmt.Errorf("error loading products for search: %w", err))
+	}
+
+	switch cfg.Driver {
+	case "", "memory":
+		Default = NewMemory(docs)
+	case "mysql":
+		Default = NewMySQL(docs)
+	default:
+		panic(fmt.Sprintf("unknown search driver %q", cfg.Driver))
+	}
+
+	fmt.Printf("Search ready (%s, %d products)\n", cfg.Driver, len(docs))
+}
+
+// Tokenize lower-cases text and splits it into runs of letters and digits.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Highlight HTML-escapes text and wraps every word that starts with one of
+// terms in <mark> tags.
+func Highlight(text string, terms []string) string {
+	var b strings.Builder
+	word := []rune{}
+
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		lower := strings.ToLower(w)
+		matched := false
+		for _, term := range terms {
+			if term != "" && strings.HasPrefix(lower, term) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package sessions
+
+import (
+	"database/sql"
+	"fmt"
+	"loginApi/database"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheTTL bounds how long another server instance may keep accepting a
+	// session after it was revoked elsewhere.
+	cacheTTL = 30 * time.Second
+
+	// touchInterval limits how often last_seen_at is written per session.
+	touchInterval = time.Minute
+)
+
+type cacheEntry struct {
+	userID    int
+	active    bool
+	cachedAt  time.Time
+	touchedAt time.Time
+}
+
+var (
+	mu    sync.Mutex
+	cache = map[string]*cacheEntry{}
+)
+
+// Create records a new login session for the token with the given jti.
+func Create(jti string, userID int, userAgent, ip string, expiresAt time.Time) error {
+	now := time.Now()
+	query := "INSERT INTO user_sessions (id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := database.DB.Exec(query, jti, userID, userAgent, ip, now, now, expiresAt)
+	return err
+}
+
+// IsActive reports whether the session jti belongs to userID and has not
+// been revoked or expired. Results are cached so most requests do not hit
+// MySQL; last_seen_at is refreshed at most once per touchInterval.
+func IsActive(jti string, userID int) (bool, error) {
+	now := time.Now()
+
+	mu.Lock()
+	entry, ok := cache[jti]
+	mu.Unlock()
+
+	if !ok || now.Sub(entry.cachedAt) >= cacheTTL {
+		var sessionUserID int
+		var active bool
+		query := "SELECT user_id, revoked_at IS NULL AND expires_at > ? FROM user_sessions WHERE id = ?"
+		err := database.DB.QueryRow(query, now, jti).Scan(&sessionUserID, &active)
+		if err != nil && err != sql.ErrNoRows {
+			return false, err
+		}
+
+		fresh := &cacheEntry{userID: sessionUserID, active: active, cachedAt: now}
+		if ok {
+			fresh.touchedAt = entry.touchedAt
+		}
+		entry = fresh
+	}
+
+	mu.Lock()
+	touch := entry.active && now.Sub(entry.touchedAt) >= touchInterval
+	if touch {
+		entry.touchedAt = now
+	}
+	cache[jti] = entry
+	mu.Unlock()
+
+	if touch {
+		touchLastSeen(jti, now)
+	}
+
+	return entry.active && entry.userID == userID, nil
+}
+
+// Revoke ends session jti if it belongs to userID. It reports false when
+// there is no such active session.
+func Revoke(jti string, userID int) (bool, error) {
+	query := "UPDATE user_sessions SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+	result, err := database.DB.Exec(query, time.Now(), jti, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	mu.Lock()
+	delete(cache, jti)
+	mu.Unlock()
+
+	return rowsAffected > 0, nil
+}
+
+// StartCacheJanitor periodically drops stale cache entries so sessions
+// that are never used again do not stay in memory.
+func StartCacheJanitor() {
+	go func() {
+		for range time.Tick(cacheTTL) {
+			now := time.Now()
+			mu.Lock()
+			for jti, entry := range cache {
+				if now.Sub(entry.cachedAt) >= cacheTTL && now.Sub(entry.touchedAt) >= touchInterval {
+					delete(cache, jti)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+}
+
+func touchLastSeen(jti string, now time.Time) {
+	_, err := database.DB.Exec("UPDATE user_sessions SET last_seen_at = ? WHERE id = ?", now, jti)
+	if err != nil {
+		// Losing a last-seen update is harmless; the next one will catch up
+		fmt.Printf("Error updating session last_seen_at: %v\n", err)
+	}
+}
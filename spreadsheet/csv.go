@@ -0,0 +1,99 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = normalizeColumn(name)
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (Record, error) {
+	for {
+		fields, err := c.r.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		line, _ := c.r.FieldPos(0)
+
+		// Spreadsheet programs leave blank lines at the end
+		if len(fields) == 1 && fields[0] == "" {
+			continue
+		}
+
+		if len(fields) > len(c.columns) {
+			return Record{Line: line}, &RowError{Line: line, Err: fmt.Errorf("row has %d fields but the header has %d", len(fields), len(c.columns))}
+		}
+
+		values := make(map[string]string, len(c.columns))
+		for i, value := range fields {
+			values[c.columns[i]] = value
+		}
+		return Record{Line: line, Values: values}, nil
+	}
+}
+
+// Columns returns the header row.
+func (c *csvReader) Columns() []string {
+	return c.columns
+}
+
+type csvWriter struct {
+	w    *csv.Writer
+	rows int
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatValue(value)
+	}
+	err := c.w.Write(record)
+	if err != nil {
+		return err
+	}
+
+	// Flush now and then so the rows reach the client as they are written
+	c.rows++
+	if c.rows%flushEvery == 0 {
+		c.w.Flush()
+		return c.w.Error()
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
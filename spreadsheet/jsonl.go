@@ -0,0 +1,108 @@
+package spreadsheet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// flushEvery is how many rows the streaming writers buffer before flushing.
+const flushEvery = 100
+
+// maxJSONLine bounds a single JSON Lines record.
+const maxJSONLine = 1 << 20
+
+type jsonlReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxJSONLine)
+	return &jsonlReader{s: s}
+}
+
+// Read decodes the next non-blank line. Numbers keep their text so large
+// integers are not rounded through float64; null becomes an empty value.
+func (j *jsonlReader) Read() (Record, error) {
+	for j.s.Scan() {
+		j.line++
+		data := bytes.TrimSpace(j.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return Record{Line: j.line}, &RowError{Line: j.line, Err: fmt.Errorf("invalid JSON: %v", err)}
+		}
+
+		values := make(map[string]string, len(object))
+		for key, value := range object {
+			switch v := value.(type) {
+			case nil:
+				values[normalizeColumn(key)] = ""
+			case string:
+				values[normalizeColumn(key)] = v
+			case json.Number, bool:
+				values[normalizeColumn(key)] = fmt.Sprint(v)
+			default:
+				return Record{Line: j.line}, &RowError{Line: j.line, Err: fmt.Errorf("field %q must be a string, number or boolean", key)}
+			}
+		}
+		return Record{Line: j.line, Values: values}, nil
+	}
+
+	if err := j.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// Columns is nil; each JSON Lines record names its own fields.
+func (j *jsonlReader) Columns() []string {
+	return nil
+}
+
+type jsonlWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+	columns []string
+	rows    int
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	buffered := bufio.NewWriter(w)
+	return &jsonlWriter{w: buffered, encoder: json.NewEncoder(buffered)}
+}
+
+func (j *jsonlWriter) WriteHeader(columns []string) error {
+	j.columns = columns
+	return nil
+}
+
+func (j *jsonlWriter) WriteRow(values []interface{}) error {
+	object := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		object[j.columns[i]] = value
+	}
+	err := j.encoder.Encode(object)
+	if err != nil {
+		return err
+	}
+
+	j.rows++
+	if j.rows%flushEvery == 0 {
+		return j.w.Flush()
+	}
+	return nil
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
@@ -0,0 +1,130 @@
+package spreadsheet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Supported formats.
+const (
+	CSV   = "csv"
+	JSONL = "jsonl"
+	XLSX  = "xlsx"
+)
+
+// ContentTypes maps each format to the media type it is served as.
+var ContentTypes = map[string]string{
+	CSV:   "text/csv; charset=utf-8",
+	JSONL: "application/x-ndjson",
+	XLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+var ErrUnknownFormat = errors.New("format must be csv, jsonl or xlsx")
+
+// FormatFromContentType picks the format for an upload's Content-Type, or
+// "" if it does not name one.
+func FormatFromContentType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mediaType)) {
+	case "text/csv", "application/csv":
+		return CSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return JSONL
+	case ContentTypes[XLSX]:
+		return XLSX
+	}
+	return ""
+}
+
+// Record is one row of input keyed by lower-cased column name. Line is the
+// row's line number in the file (the header being line 1 for CSV and
+// XLSX), for error reports.
+type Record struct {
+	Line   int
+	Values map[string]string
+}
+
+// Reader reads records one at a time; Read returns io.EOF after the last.
+// An error wrapped in RowError concerns only that row and reading may go
+// on; any other error ends the file. Columns returns the header row, or nil
+// for formats whose records name their own fields.
+type Reader interface {
+	Read() (Record, error)
+	Columns() []string
+}
+
+// RowError is a problem with a single row that does not stop the reader.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Writer writes rows under a fixed header. Values may be strings, integers
+// or nil for an empty cell. Close must be called to finish the file.
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewWriter returns a writer for format that streams to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w), nil
+	case JSONL:
+		return newJSONLWriter(w), nil
+	case XLSX:
+		return newXLSXWriter(w), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// NewReader returns a reader for format. CSV and JSON Lines are read as
+// they stream in; XLSX files are zip archives that need random access, so
+// they are read from an io.ReaderAt of the given size.
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case CSV:
+		return newCSVReader(r)
+	case JSONL:
+		return newJSONLReader(r), nil
+	case XLSX:
+		ra, ok := r.(sizedReaderAt)
+		if !ok {
+			return nil, errors.New("xlsx input must be seekable")
+		}
+		size, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		return newXLSXReader(ra, size)
+	}
+	return nil, ErrUnknownFormat
+}
+
+type sizedReaderAt interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+func normalizeColumn(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+}
+
+func formatValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,408 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// xlsxReader streams the rows of a workbook's first sheet. Only the shared
+// strings table is held in memory; the sheet itself is decoded token by
+// token.
+type xlsxReader struct {
+	sheet   io.ReadCloser
+	decoder *xml.Decoder
+	strings []string
+	columns []string
+}
+
+func newXLSXReader(r io.ReaderAt, size int64) (*xlsxReader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("file is not a valid xlsx workbook")
+	}
+
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	sheetFile, ok := files[firstSheetPath(files)]
+	if !ok {
+		return nil, errors.New("workbook has no worksheets")
+	}
+
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheet, err := sheetFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxReader{sheet: sheet, decoder: xml.NewDecoder(sheet), strings: shared}
+
+	line, header, err := x.nextRow()
+	if err == io.EOF {
+		sheet.Close()
+		return nil, errors.New("file is empty")
+	} else if err != nil {
+		sheet.Close()
+		return nil, err
+	}
+	if line != 1 {
+		sheet.Close()
+		return nil, errors.New("the header must be on the first row of the sheet")
+	}
+
+	x.columns = make([]string, len(header))
+	for i, name := range header {
+		x.columns[i] = normalizeColumn(name)
+	}
+	return x, nil
+}
+
+// firstSheetPath follows the workbook's relationships to the part holding
+// its first sheet, falling back to the conventional name.
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(files["xl/workbook.xml"], &workbook); err != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return fallback
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+func decodePart(file *zip.File, v interface{}) error {
+	if file == nil {
+		return errors.New("missing part")
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// readSharedStrings loads the workbook's string table. Rich text runs are
+// joined into plain text.
+func readSharedStrings(file *zip.File) ([]string, error) {
+	if file == nil {
+		return nil, nil
+	}
+
+	var table struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodePart(file, &table); err != nil {
+		return nil, errors.New("workbook has an invalid shared strings table")
+	}
+
+	shared := make([]string, len(table.Items))
+	for i, item := range table.Items {
+		if len(item.Runs) == 0 {
+			shared[i] = item.Text
+			continue
+		}
+		var b strings.Builder
+		for _, run := range item.Runs {
+			b.WriteString(run.Text)
+		}
+		shared[i] = b.String()
+	}
+	return shared, nil
+}
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+// nextRow returns the 1-based row number and cell texts of the next
+// non-empty row, placing each cell at the column its reference names.
+func (x *xlsxReader) nextRow() (int, []string, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return 0, nil, io.EOF
+			}
+			return 0, nil, errors.New("workbook sheet is not valid XML")
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row struct {
+			Number int        `xml:"r,attr"`
+			Cells  []xlsxCell `xml:"c"`
+		}
+		if err := x.decoder.DecodeElement(&row, &start); err != nil {
+			return 0, nil, errors.New("workbook sheet is not valid XML")
+		}
+
+		var cells []string
+		for i, cell := range row.Cells {
+			column := i
+			if cell.Ref != "" {
+				column = columnIndex(cell.Ref)
+			}
+			if column < 0 {
+				continue
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = x.cellText(cell)
+		}
+
+		if len(strings.Join(cells, "")) == 0 {
+			continue
+		}
+		return row.Number, cells, nil
+	}
+}
+
+func (x *xlsxReader) cellText(cell xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return ""
+		}
+		return x.strings[i]
+	case "inlineStr":
+		if len(cell.Inline.Runs) == 0 {
+			return cell.Inline.Text
+		}
+		var b strings.Builder
+		for _, run := range cell.Inline.Runs {
+			b.WriteString(run.Text)
+		}
+		return b.String()
+	case "b":
+		if cell.Value == "1" {
+			return "true"
+		}
+		return "false"
+	}
+
+	// Whole numbers are sometimes stored as "12000.0" or in exponent form;
+	// hand them on as plain integers
+	value := strings.TrimSpace(cell.Value)
+	if cell.Type == "" || cell.Type == "n" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f == float64(int64(f)) && strings.ContainsAny(value, ".eE") {
+			return strconv.FormatInt(int64(f), 10)
+		}
+	}
+	return value
+}
+
+// columnIndex turns the letters of a cell reference such as "AB12" into a
+// 0-based column number.
+func columnIndex(ref string) int {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+	return index - 1
+}
+
+func (x *xlsxReader) Read() (Record, error) {
+	line, cells, err := x.nextRow()
+	if err != nil {
+		x.sheet.Close()
+		return Record{}, err
+	}
+
+	if len(cells) > len(x.columns) {
+		for _, extra := range cells[len(x.columns):] {
+			if extra != "" {
+				return Record{Line: line}, &RowError{Line: line, Err: fmt.Errorf("row has values beyond the %d header columns", len(x.columns))}
+			}
+		}
+		cells = cells[:len(x.columns)]
+	}
+
+	values := make(map[string]string, len(x.columns))
+	for i, value := range cells {
+		values[x.columns[i]] = value
+	}
+	return Record{Line: line, Values: values}, nil
+}
+
+// Columns returns the header row.
+func (x *xlsxReader) Columns() []string {
+	return x.columns
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter streams a single-sheet workbook. The fixed parts are written
+// up front and the sheet last, so rows go straight into the zip stream with
+// strings inline rather than collected into a shared table.
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	row     int
+	err     error
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	x := &xlsxWriter{archive: zip.NewWriter(w)}
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		pw, err := x.archive.Create(part.name)
+		if err != nil {
+			x.err = err
+			return x
+		}
+		if _, err := io.WriteString(pw, part.body); err != nil {
+			x.err = err
+			return x
+		}
+	}
+
+	sheet, err := x.archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		x.err = err
+		return x
+	}
+	x.sheet = bufio.NewWriter(sheet)
+	_, x.err = x.sheet.WriteString(xlsxSheetStart)
+	return x
+}
+
+func (x *xlsxWriter) WriteHeader(columns []string) error {
+	values := make([]interface{}, len(columns))
+	for i, name := range columns {
+		values[i] = name
+	}
+	return x.WriteRow(values)
+}
+
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+	if x.err != nil {
+		return x.err
+	}
+
+	x.row++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(x.row)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int, int64, float64:
+			fmt.Fprintf(x.sheet, `<c r="%s"><v>%v</v></c>`, ref, v)
+		default:
+			fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(x.sheet, []byte(formatValue(v)))
+			x.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, x.err = x.sheet.WriteString(`</row>`)
+	if x.err == nil && x.row%flushEvery == 0 {
+		x.err = x.sheet.Flush()
+		if x.err == nil {
+			x.err = x.archive.Flush()
+		}
+	}
+	return x.err
+}
+
+func (x *xlsxWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.archive.Close()
+}
+
+// columnName is the inverse of columnIndex: 0 is "A", 26 is "AA".
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps files on the local filesystem below Dir. They are expected to
+// be served from PublicURL, e.g. with FileServer.
+type Local struct {
+	Dir       string
+	PublicURL string
+}
+
+func NewLocal(dir, publicURL string) *Local {
+	return &Local{Dir: dir, PublicURL: publicURL}
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+
+	err := os.Remove(filepath.Join(l.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) URL(key string) string {
+	return joinURL(l.PublicURL, key)
+}
+
+// FileServer serves the files below dir. Directories are reported as not
+// found rather than listed, so stored keys cannot be enumerated.
+func FileServer(dir string) http.Handler {
+	return http.FileServer(filesOnly{http.Dir(dir)})
+}
+
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFileServerHidesDirectories(t *testing.T) {
+	dir := t.TempDir()
+	err := NewLocal(dir, "/uploads/").Put(context.Background(), "products/1/original.png", strings.NewReader("png"), 3, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := http.StripPrefix("/uploads/", FileServer(dir))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/uploads/products/1/original.png", http.StatusOK},
+		{"/uploads/", http.StatusNotFound},
+		{"/uploads/products", http.StatusNotFound},
+		{"/uploads/products/", http.StatusNotFound},
+		{"/uploads/products/1/", http.StatusNotFound},
+		{"/uploads/products/1/missing.png", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.status)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != "png" {
+			t.Errorf("GET %s: body %q", tt.path, w.Body)
+		}
+	}
+}
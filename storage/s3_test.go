@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"loginApi/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is a path-style S3 endpoint for one bucket. It checks the SigV4
+// signature of every request against its own derivation and keeps objects
+// in memory.
+type fakeS3 struct {
+	*httptest.Server
+	t         *testing.T
+	bucket    string
+	accessKey string
+	secretKey string
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	body        string
+	contentType string
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	f := &fakeS3{t: t, bucket: "media", accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", objects: map[string]fakeObject{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeS3) storage(secretKey string) *S3 {
+	s := NewS3(config.S3{
+		Endpoint:     f.URL,
+		Region:       "eu-west-1",
+		Bucket:       f.bucket,
+		AccessKey:    f.accessKey,
+		SecretKey:    secretKey,
+		UsePathStyle: true,
+	})
+	s.client = f.Client()
+	return s
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		http.Error(w, "SignatureDoesNotMatch: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if key == r.URL.Path {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = fakeObject{body: string(body), contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify recomputes the request signature the way S3 does.
+func (f *fakeS3) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return fmt.Errorf("bad X-Amz-Date %q", amzDate)
+	}
+	date := amzDate[:8]
+	scope := date + "/eu-west-1/s3/aws4_request"
+	if fields["Credential"] != f.accessKey+"/"+scope {
+		return fmt.Errorf("bad credential %q", fields["Credential"])
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if i := sort.SearchStrings(signed, "host"); !sort.StringsAreSorted(signed) || i == len(signed) || signed[i] != "host" {
+		return fmt.Errorf("bad signed headers %q", fields["SignedHeaders"])
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsURIEncode(r.URL.Path),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + f.secretKey)
+	for _, part := range []string{date, "eu-west-1", "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(fields["Signature"])) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// awsURIEncode encodes every byte of path but unreserved characters and
+// slashes, the canonical form S3 signs regardless of how the client
+// escaped the request line.
+func awsURIEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func TestS3PutAndDelete(t *testing.T) {
+	fake := newFakeS3(t)
+	s := fake.storage(fake.secretKey)
+	ctx := context.Background()
+
+	key := "products/12/a b+c=(1)/original.png"
+	body := "\x89PNG fake image"
+	err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, ok := fake.objects[key]
+	if !ok || stored.body != body || stored.contentType != "image/png" {
+		t.Fatalf("stored %+v, ok %v", stored, ok)
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects[key]; ok {
+		t.Fatal("object still stored after Delete")
+	}
+
+	// Deleting a missing object succeeds, as it does on S3
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestS3RejectedSignature(t *testing.T) {
+	fake := newFakeS3(t)
+	s := fake.storage("not-the-secret")
+
+	err := s.Put(context.Background(), "a.txt", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("error %v, want 403", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Fatal("object stored despite a bad signature")
+	}
+}
+
+func TestS3InvalidKey(t *testing.T) {
+	fake := newFakeS3(t)
+	s := fake.storage(fake.secretKey)
+
+	for _, key := range []string{"", "/abs", "a/../b", "a//b", `a\b`} {
+		if err := s.Put(context.Background(), key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) accepted", key)
+		}
+		if err := s.Delete(context.Background(), key); err == nil {
+			t.Errorf("Delete(%q) accepted", key)
+		}
+	}
+}
+
+func TestS3URL(t *testing.T) {
+	tests := []struct {
+		cfg  config.S3
+		want string
+	}{
+		{config.S3{Bucket: "media", Region: "eu-west-1"}, "https://media.s3.eu-west-1.amazonaws.com/a%20b/c.png"},
+		{config.S3{Bucket: "media", Endpoint: "http://minio:9000", UsePathStyle: true}, "http://minio:9000/media/a%20b/c.png"},
+		{config.S3{Bucket: "media", PublicURL: "https://cdn.example/"}, "https://cdn.example/a%20b/c.png"},
+	}
+	for _, tt := range tests {
+		if got := NewS3(tt.cfg).URL("a b/c.png"); got != tt.want {
+			t.Errorf("URL = %q, want %q", got, tt.want)
+		}
+	}
+	if _, err := url.Parse(NewS3(config.S3{Bucket: "media"}).URL("x")); err != nil {
+		t.Fatal(err)
+	}
+}
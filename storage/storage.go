@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"loginApi/config"
+	"strings"
+)
+
+// Storage stores uploaded files under slash-separated keys such as
+// "products/12/abc/original.png" and knows the public URL for each.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Default is the backend selected by config.App.Storage, set by Init.
+var Default Storage
+
+// Init builds the configured storage backend.
+func Init() {
+	cfg := config.App.Storage
+
+	switch cfg.Driver {
+	case "", "local":
+		Default = NewLocal(cfg.LocalDir, cfg.LocalPublicURL)
+	case "s3":
+		Default = NewS3(cfg.S3)
+	default:
+		panic(fmt.Sprintf("unknown storage driver %q", cfg.Driver))
+	}
+
+	fmt.Printf("Storage ready (%s)\n", cfg.Driver)
+}
+
+// validKey rejects keys that could escape the storage root.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
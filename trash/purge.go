@@ -0,0 +1,223 @@
+package trash
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"loginApi/config"
+	"loginApi/database"
+	"loginApi/helpers"
+	"loginApi/storage"
+	"strings"
+	"time"
+)
+
+// purgeBatchSize bounds how many products one purge transaction removes.
+const purgeBatchSize = 100
+
+// StartPurgeJob permanently removes rows that have been in the trash for
+// longer than the configured retention, checking at the configured
+// interval.
+func StartPurgeJob() {
+	cfg := config.App.Trash
+	if cfg.RetentionDays <= 0 {
+		fmt.Println("Trash purge disabled")
+		return
+	}
+
+	interval := time.Duration(cfg.PurgeIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			cutoff := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+			if err := Purge(context.Background(), cutoff); err != nil {
+				fmt.Printf("Error purging trash: %v\n", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Purge permanently deletes products, categories and messages trashed
+// before cutoff.
+func Purge(ctx context.Context, cutoff time.Time) error {
+	products := 0
+	for {
+		n, err := purgeProducts(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		products += n
+		if n < purgeBatchSize {
+			break
+		}
+	}
+
+	categories, err := purgeCategories(cutoff)
+	if err != nil {
+		return err
+	}
+
+	result, err := database.DB.Exec("DELETE FROM messages WHERE deleted_at < ?", cutoff)
+	if err != nil {
+		return err
+	}
+	messages, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if products+categories > 0 || messages > 0 {
+		fmt.Printf("Trash purged: %d products, %d categories, %d messages\n", products, categories, messages)
+	}
+	return nil
+}
+
+func purgeProducts(ctx context.Context, cutoff time.Time) (int, error) {
+	// Products that were ever ordered stay, since order history refers to them
+	query := `SELECT p.id FROM products p
+		WHERE p.deleted_at < ?
+		AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = p.id)
+		ORDER BY p.id LIMIT ?`
+	rows, err := database.DB.Query(query, cutoff, purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	keys, err := deleteProductRows(tx, ids)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Files go only once the rows are gone, so a rollback never leaves rows
+	// pointing at missing files
+	for _, key := range keys {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			fmt.Printf("Error deleting %s: %v\n", key, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// deleteProductRows removes products together with their images, stock
+// movements, options and variants, and returns the storage keys of the
+// image files.
+func deleteProductRows(tx *sql.Tx, productIDs []int) ([]string, error) {
+	placeholders, args := helpers.InPlaceholders(productIDs)
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT storage_prefix, original_ext, thumb_ext, thumb_sizes FROM product_images WHERE product_id IN (%s)", placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var prefix, ext, thumbExt, sizes string
+		if err := rows.Scan(&prefix, &ext, &thumbExt, &sizes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, fmt.Sprintf("%s/original.%s", prefix, ext))
+		for _, name := range strings.Split(sizes, ",") {
+			if name != "" {
+				keys = append(keys, fmt.Sprintf("%s/%s.%s", prefix, name, thumbExt))
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Variants go before options because variant values reference option
+	// values; both cascade to their value rows
+	for _, table := range []string{"product_images", "product_tags", "reviews", "wishlist_items", "cart_items", "stock_movements", "product_variants", "product_options"} {
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE product_id IN (%s)", table, placeholders), args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM products WHERE id IN (%s)", placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// purgeCategories deletes expired trashed categories leaf first. A category
+// still referenced by a product or a subcategory stays until those are
+// gone, which happens on a later run if they are in the trash too.
+func purgeCategories(cutoff time.Time) (int, error) {
+	purged := 0
+	for {
+		query := `SELECT c.id FROM categories c
+			WHERE c.deleted_at < ?
+			AND NOT EXISTS (SELECT 1 FROM categories child WHERE child.parent_id = c.id)
+			AND NOT EXISTS (SELECT 1 FROM products p WHERE p.category_id = c.id)`
+		rows, err := database.DB.Query(query, cutoff)
+		if err != nil {
+			return purged, err
+		}
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return purged, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return purged, err
+		}
+		if len(ids) == 0 {
+			return purged, nil
+		}
+
+		placeholders, args := helpers.InPlaceholders(ids)
+		result, err := database.DB.Exec(fmt.Sprintf("DELETE FROM categories WHERE id IN (%s)", placeholders), args...)
+		if err != nil {
+			return purged, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		if n == 0 {
+			return purged, nil
+		}
+		purged += int(n)
+	}
+}
@@ -0,0 +1,10 @@
+package utils
+
+import "loginApi/database"
+
+// IsAdmin reports whether userID has the administrator flag.
+func IsAdmin(userID int) (bool, error) {
+	var admin bool
+	err := database.DB.QueryRow("SELECT COALESCE(MAX(is_admin), 0) FROM users WHERE id = ?", userID).Scan(&admin)
+	return admin, err
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SignCartToken returns the token that identifies an anonymous cart:
+// "<cart id>.<nonce>.<signature>". The signature lets forged tokens be
+// rejected without a database lookup; the nonce, stored with the cart,
+// lets a token be invalidated by replacing it.
+func SignCartToken(cartID int, nonce string) string {
+	payload := fmt.Sprintf("%d.%s", cartID, nonce)
+	return payload + "." + cartSignature(payload)
+}
+
+// ParseCartToken verifies a cart token and returns its cart ID and nonce.
+func ParseCartToken(token string) (int, string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, "", false
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(cartSignature(payload))) {
+		return 0, "", false
+	}
+
+	cartID, err := strconv.Atoi(parts[0])
+	if err != nil || cartID <= 0 {
+		return 0, "", false
+	}
+	return cartID, parts[1], true
+}
+
+func cartSignature(payload string) string {
+	mac := hmac.New(sha256.New, jwtKey)
+	mac.Write([]byte("cart:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCartToken(t *testing.T) {
+	valid := SignCartToken(42, "n0nce")
+	signature := strings.TrimPrefix(valid, "42.n0nce.")
+
+	tests := []struct {
+		name   string
+		token  string
+		cartID int
+		nonce  string
+		ok     bool
+	}{
+		{"valid", valid, 42, "n0nce", true},
+		{"other cart", SignCartToken(7, "abc"), 7, "abc", true},
+		{"empty", "", 0, "", false},
+		{"two parts", "42.n0nce", 0, "", false},
+		{"four parts", valid + ".x", 0, "", false},
+		{"cart ID swapped", "43.n0nce." + signature, 0, "", false},
+		{"nonce swapped", "42.other." + signature, 0, "", false},
+		{"signature truncated", valid[:len(valid)-1], 0, "", false},
+		{"signature missing", "42.n0nce.", 0, "", false},
+		{"signature from another key", "42.n0nce.AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", 0, "", false},
+		{"jwt-like", "eyJhbGciOiJIUzI1NiJ9.e30.sig", 0, "", false},
+		{"zero cart signed", SignCartToken(0, "n0nce"), 0, "", false},
+		{"negative cart signed", SignCartToken(-1, "n0nce"), 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cartID, nonce, ok := ParseCartToken(tt.token)
+			if cartID != tt.cartID || nonce != tt.nonce || ok != tt.ok {
+				t.Fatalf("ParseCartToken(%q) = %d, %q, %v; want %d, %q, %v", tt.token, cartID, nonce, ok, tt.cartID, tt.nonce, tt.ok)
+			}
+		})
+	}
+}
@@ -10,21 +10,78 @@ import (
 
 var jwtKey = []byte("your_secret_key") // Change this to a secure key
 
-// GenerateJWT generates a JWT token
-func GenerateJWT(userID int, userName string) (string, error) {
-	claims := &jwt.StandardClaims{
-		Subject:   strconv.Itoa(userID),
-		Issuer:    userName,
-		ExpiresAt: time.Now().Add(24 * time.Hour * 30).Unix(), // Token expires in 24 hours
+// Claims are the claims carried by every token we issue. First-party login
+// tokens leave ClientID and Scope empty; OAuth2 access tokens set both.
+type Claims struct {
+	jwt.StandardClaims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// GenerateJWT generates a JWT token. Its Id (jti) names the login session
+// the token belongs to.
+func GenerateJWT(userID int, userName string) (string, *Claims, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   strconv.Itoa(userID),
+			Issuer:    userName,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(24 * time.Hour * 30).Unix(), // Token expires in 30 days
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(jwtKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// GenerateAccessToken generates an OAuth2 access token issued to clientID.
+// userID is 0 for client-credentials tokens, which carry no user subject.
+func GenerateAccessToken(userID int, clientID string, scope string, ttl time.Duration) (string, *Claims, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  clientID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		ClientID: clientID,
+		Scope:    scope,
+	}
+	if userID > 0 {
+		claims.Subject = strconv.Itoa(userID)
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	signed, err := token.SignedString(jwtKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
 // ParseJWT parses and validates a JWT token
-func ParseJWT(tokenString string) (*jwt.Token, *jwt.StandardClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+func ParseJWT(tokenString string) (*jwt.Token, *Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		return jwtKey, nil
 	})
 
@@ -32,7 +89,7 @@ func ParseJWT(tokenString string) (*jwt.Token, *jwt.StandardClaims, error) {
 		return nil, nil, err
 	}
 
-	if claims, ok := token.Claims.(*jwt.StandardClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
 		return token, claims, nil
 	}
 
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"loginApi/database"
+	"strings"
+	"time"
+)
+
+// OAuthScopes lists every scope a client may request, with the text shown
+// on the consent screen.
+var OAuthScopes = map[string]string{
+	"profile":          "Read your name, email and phone number",
+	"profile:write":    "Change your name and phone number",
+	"products:write":   "Create and update your products",
+	"categories:write": "Create and update categories",
+	"orders":           "Use your cart, place orders and see your order history",
+	"reviews":          "Write, edit and delete reviews in your name",
+	"wishlists":        "See and edit your wishlists and share them",
+	"shops:write":      "Manage your shops, their members and invitations",
+}
+
+// GenerateRandomToken returns n random bytes encoded as unpadded base64url.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of a token so it can be stored and
+// looked up without keeping the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks a code_verifier against the code_challenge stored with
+// an authorization code (RFC 7636). Only S256 and plain are supported.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	var computed string
+	switch method {
+	case "S256":
+		computed = PKCEChallenge(verifier)
+	case "plain", "":
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// PKCEChallenge derives the S256 code_challenge for a code_verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseScope splits a space-delimited scope string, dropping duplicates.
+func ParseScope(scope string) []string {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ScopeSubset reports whether every scope in requested is also in allowed.
+func ScopeSubset(requested, allowed []string) bool {
+	set := map[string]bool{}
+	for _, s := range allowed {
+		set[s] = true
+	}
+	for _, s := range requested {
+		if !set[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsTokenRevoked reports whether the access token with the given jti has
+// been revoked through the revocation endpoint.
+func IsTokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	query := "SELECT EXISTS(SELECT 1 FROM oauth_revoked_tokens WHERE jti = ?)"
+	err := database.DB.QueryRow(query, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// RevokeToken records jti as revoked until the token would have expired anyway.
+func RevokeToken(jti string, expiresAt time.Time) error {
+	query := "INSERT IGNORE INTO oauth_revoked_tokens (jti, expires_at) VALUES (?, ?)"
+	_, err := database.DB.Exec(query, jti, expiresAt)
+	return err
+}